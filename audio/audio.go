@@ -0,0 +1,253 @@
+// Package audio decodes WAV, MP3 and FLAC files in pure Go and converts
+// them to the 16 kHz mono PCM that whisper expects.
+package audio
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WhisperSampleRate is the sample rate whisper models are trained on
+const WhisperSampleRate = 16000
+
+// ErrUnsupportedFormat is matched by every error for a file that is not
+// WAV, MP3 or FLAC, or that uses a codec the decoders do not implement
+var ErrUnsupportedFormat = errors.New("unsupported audio format")
+
+// UnsupportedCodecError names the container and codec of a file that
+// cannot be decoded
+type UnsupportedCodecError struct {
+	Container string
+	Codec     string
+}
+
+func (e *UnsupportedCodecError) Error() string {
+	codec := e.Codec
+	if codec == "" {
+		codec = "unknown codec"
+	}
+	return fmt.Sprintf("unsupported audio: %s in %s container; supported formats are WAV (PCM, float, A-law, µ-law), MP3 and FLAC", codec, e.Container)
+}
+
+func (e *UnsupportedCodecError) Is(target error) bool {
+	return target == ErrUnsupportedFormat
+}
+
+// Format describes an audio stream
+type Format struct {
+	Container  string // WAV, MP3 or FLAC
+	Codec      string // e.g. PCM, IEEE float, MP3, FLAC
+	SampleRate int
+	Channels   int
+	BitDepth   int // Bits per sample, 0 for lossy codecs
+}
+
+func (f Format) String() string {
+	description := fmt.Sprintf("%s %s, %d Hz, %d channels", f.Container, f.Codec, f.SampleRate, f.Channels)
+	if f.BitDepth > 0 {
+		description += fmt.Sprintf(", %d-bit", f.BitDepth)
+	}
+	return description
+}
+
+// Decoder reads interleaved samples scaled to [-1, 1]
+type Decoder interface {
+	// Format describes the decoded stream
+	Format() Format
+
+	// Read fills samples with interleaved frames and returns the number of
+	// samples read, always a multiple of the channel count. It returns
+	// io.EOF once the stream is exhausted.
+	Read(samples []float32) (int, error)
+
+	// Frames returns the total number of frames in the stream, or -1 if
+	// the container does not record it
+	Frames() int64
+
+	Close() error
+}
+
+// sniffSize is how much of a file is inspected to detect its format
+const sniffSize = 4096
+
+// Open detects the format of path from its content and returns a decoder
+// for it. Files in other formats are rejected with an UnsupportedCodecError.
+func Open(path string) (Decoder, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audio file: %v", err)
+	}
+
+	header := make([]byte, sniffSize)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		file.Close()
+		return nil, fmt.Errorf("failed to read audio file: %v", err)
+	}
+	header = header[:n]
+	if n == 0 {
+		file.Close()
+		return nil, fmt.Errorf("audio file is empty")
+	}
+
+	// An ID3v2 tag may precede MP3 or FLAC data; look behind it
+	content := header
+	if behind := readAfterID3(file, header); behind != nil {
+		content = behind
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read audio file: %v", err)
+	}
+
+	switch {
+	case isWAV(header):
+		return newWAVDecoder(file)
+	case bytes.HasPrefix(content, []byte("fLaC")):
+		file.Close()
+		return newFLACDecoder(path)
+	case isMP3(content):
+		return newMP3Decoder(file)
+	}
+	file.Close()
+
+	if unsupported := identifyUnsupported(path, content); unsupported != nil {
+		return nil, unsupported
+	}
+
+	// Some MP3 files start with junk before the first frame
+	if strings.EqualFold(filepath.Ext(path), ".mp3") {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audio file: %v", err)
+		}
+		return newMP3Decoder(file)
+	}
+
+	return nil, fmt.Errorf("%w: file is not WAV, MP3 or FLAC", ErrUnsupportedFormat)
+}
+
+func isWAV(header []byte) bool {
+	return len(header) >= 12 &&
+		(bytes.HasPrefix(header, []byte("RIFF")) || bytes.HasPrefix(header, []byte("RF64"))) &&
+		bytes.Equal(header[8:12], []byte("WAVE"))
+}
+
+// isMP3 reports whether header starts with an MPEG layer III frame header
+func isMP3(header []byte) bool {
+	return len(header) >= 2 && header[0] == 0xFF && header[1]&0xE0 == 0xE0 && header[1]&0x06 == 0x02
+}
+
+// readAfterID3 returns the bytes following an ID3v2 tag at the start of
+// the file, or nil if there is no tag
+func readAfterID3(file *os.File, header []byte) []byte {
+	if len(header) < 10 || !bytes.HasPrefix(header, []byte("ID3")) {
+		return nil
+	}
+
+	// The tag size is a 28-bit syncsafe integer excluding the 10-byte header
+	size := int64(header[6]&0x7F)<<21 | int64(header[7]&0x7F)<<14 | int64(header[8]&0x7F)<<7 | int64(header[9]&0x7F)
+	size += 10
+	if header[5]&0x10 != 0 {
+		size += 10 // Footer
+	}
+
+	behind := make([]byte, 16)
+	n, _ := file.ReadAt(behind, size)
+	return behind[:n]
+}
+
+// identifyUnsupported recognizes common containers the decoders cannot read
+// so the error can name the codec rather than just failing
+func identifyUnsupported(path string, header []byte) error {
+	switch {
+	case bytes.HasPrefix(header, []byte("OggS")):
+		return &UnsupportedCodecError{Container: "Ogg", Codec: oggCodec(header)}
+	case len(header) >= 12 && bytes.Equal(header[4:8], []byte("ftyp")):
+		return &UnsupportedCodecError{Container: "MP4/M4A", Codec: scanCodec(path, mp4Codecs)}
+	case bytes.HasPrefix(header, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		return &UnsupportedCodecError{Container: "Matroska/WebM", Codec: scanCodec(path, matroskaCodecs)}
+	case len(header) >= 12 && bytes.HasPrefix(header, []byte("FORM")) &&
+		(bytes.Equal(header[8:12], []byte("AIFF")) || bytes.Equal(header[8:12], []byte("AIFC"))):
+		return &UnsupportedCodecError{Container: "AIFF", Codec: "big-endian PCM"}
+	case bytes.HasPrefix(header, []byte{0x30, 0x26, 0xB2, 0x75, 0x8E, 0x66, 0xCF, 0x11}):
+		return &UnsupportedCodecError{Container: "ASF", Codec: "WMA"}
+	case bytes.HasPrefix(header, []byte("#!AMR")):
+		return &UnsupportedCodecError{Container: "AMR", Codec: "AMR"}
+	case bytes.HasPrefix(header, []byte("wvpk")):
+		return &UnsupportedCodecError{Container: "WavPack", Codec: "WavPack"}
+	case bytes.HasPrefix(header, []byte("MAC ")):
+		return &UnsupportedCodecError{Container: "APE", Codec: "Monkey's Audio"}
+	case len(header) >= 2 && header[0] == 0xFF && header[1]&0xF6 == 0xF0:
+		return &UnsupportedCodecError{Container: "ADTS", Codec: "AAC"}
+	case len(header) >= 2 && header[0] == 0xFF && header[1]&0xE0 == 0xE0:
+		return &UnsupportedCodecError{Container: "MPEG audio", Codec: "MPEG layer I/II"}
+	}
+	return nil
+}
+
+// oggCodec identifies the codec from the first Ogg page's payload
+func oggCodec(header []byte) string {
+	if len(header) < 27 {
+		return ""
+	}
+	payloadStart := 27 + int(header[26])
+	if payloadStart >= len(header) {
+		return ""
+	}
+	payload := header[payloadStart:]
+	switch {
+	case bytes.HasPrefix(payload, []byte("\x01vorbis")):
+		return "Vorbis"
+	case bytes.HasPrefix(payload, []byte("OpusHead")):
+		return "Opus"
+	case bytes.HasPrefix(payload, []byte("\x7FFLAC")):
+		return "FLAC (Ogg FLAC)"
+	case bytes.HasPrefix(payload, []byte("Speex")):
+		return "Speex"
+	}
+	return ""
+}
+
+// Codec identifiers found in MP4 sample descriptions and Matroska tracks
+var (
+	mp4Codecs = map[string]string{
+		"mp4a": "AAC", "alac": "ALAC", "Opus": "Opus", "fLaC": "FLAC",
+		"ac-3": "AC-3", "ec-3": "E-AC-3", "samr": "AMR",
+	}
+	matroskaCodecs = map[string]string{
+		"A_OPUS": "Opus", "A_VORBIS": "Vorbis", "A_AAC": "AAC", "A_FLAC": "FLAC",
+		"A_MPEG/L3": "MP3", "A_PCM": "PCM", "A_AC3": "AC-3",
+	}
+)
+
+// scanLimit bounds how much of a container is searched for a codec name
+const scanLimit = 1 << 20
+
+// scanCodec searches the start of a file for a known codec identifier
+func scanCodec(path string, codecs map[string]string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(io.LimitReader(file, scanLimit))
+	if err != nil {
+		return ""
+	}
+
+	// Report the identifier that appears first, as that is the first track
+	found, foundAt := "", len(content)
+	for id, codec := range codecs {
+		if idx := bytes.Index(content, []byte(id)); idx >= 0 && idx < foundAt {
+			found, foundAt = codec, idx
+		}
+	}
+	return found
+}
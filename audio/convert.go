@@ -0,0 +1,199 @@
+package audio
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+)
+
+// readFrames is how many frames are decoded at a time
+const readFrames = 8192
+
+// AllChannels selects the average of all channels rather than one channel
+const AllChannels = -1
+
+// Convert decodes src and writes it to dst as 16 kHz mono 16-bit PCM WAV,
+// the input whisper expects. It returns the format of the source file.
+func Convert(ctx context.Context, src, dst string) (Format, error) {
+	return ConvertChannel(ctx, src, dst, AllChannels)
+}
+
+// ConvertChannel is like Convert but keeps only the given channel, counting
+// from 0, or mixes all channels for AllChannels
+func ConvertChannel(ctx context.Context, src, dst string, channel int) (Format, error) {
+	decoder, err := openChannel(src, channel)
+	if err != nil {
+		return Format{}, err
+	}
+	defer decoder.Close()
+
+	writer, err := CreateWAV(dst, WhisperSampleRate, 1)
+	if err != nil {
+		return decoder.Format(), err
+	}
+
+	samples, err := decode(ctx, decoder, channel, writer.Write)
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && samples == 0 {
+		err = fmt.Errorf("audio file contains no samples")
+	}
+	if err != nil {
+		os.Remove(dst)
+		return decoder.Format(), err
+	}
+	return decoder.Format(), nil
+}
+
+// Load decodes src into memory as 16 kHz mono samples, for analysis that
+// needs the whole signal. It returns the format of the source file.
+func Load(ctx context.Context, src string) ([]float32, Format, error) {
+	return LoadChannel(ctx, src, AllChannels)
+}
+
+// LoadChannel is like Load but keeps only the given channel, counting from
+// 0, or mixes all channels for AllChannels
+func LoadChannel(ctx context.Context, src string, channel int) ([]float32, Format, error) {
+	decoder, err := openChannel(src, channel)
+	if err != nil {
+		return nil, Format{}, err
+	}
+	defer decoder.Close()
+
+	var samples []float32
+	if frames := decoder.Frames(); frames > 0 {
+		rate := decoder.Format().SampleRate
+		samples = make([]float32, 0, frames*WhisperSampleRate/int64(rate)+readFrames)
+	}
+	_, err = decode(ctx, decoder, channel, func(block []float32) error {
+		samples = append(samples, block...)
+		return nil
+	})
+	if err == nil && len(samples) == 0 {
+		err = fmt.Errorf("audio file contains no samples")
+	}
+	if err != nil {
+		return nil, decoder.Format(), err
+	}
+	return samples, decoder.Format(), nil
+}
+
+// Stream decodes src and passes it to sink as blocks of 16 kHz mono
+// samples, from one channel counting from 0 or the mix of all channels for
+// AllChannels, so long recordings can be analyzed without holding them in
+// memory. It returns the format of the source file.
+func Stream(ctx context.Context, src string, channel int, sink func([]float32) error) (Format, error) {
+	decoder, err := openChannel(src, channel)
+	if err != nil {
+		return Format{}, err
+	}
+	defer decoder.Close()
+
+	samples, err := decode(ctx, decoder, channel, sink)
+	if err == nil && samples == 0 {
+		err = fmt.Errorf("audio file contains no samples")
+	}
+	return decoder.Format(), err
+}
+
+// openChannel opens src and checks that it has the requested channel
+func openChannel(src string, channel int) (Decoder, error) {
+	decoder, err := Open(src)
+	if err != nil {
+		return nil, err
+	}
+	if channels := decoder.Format().Channels; channel != AllChannels && (channel < 0 || channel >= channels) {
+		decoder.Close()
+		return nil, fmt.Errorf("audio file has no channel %d, only %d channels", channel+1, channels)
+	}
+	return decoder, nil
+}
+
+// decode streams the decoder's audio to sink as 16 kHz mono, taking one
+// channel or the mix of all channels, and returns the number of samples
+// produced. It stops early when ctx is done.
+func decode(ctx context.Context, decoder Decoder, channel int, sink func([]float32) error) (int64, error) {
+	format := decoder.Format()
+
+	var resample *resampler
+	if format.SampleRate != WhisperSampleRate {
+		resample = newResampler(format.SampleRate, WhisperSampleRate)
+	}
+
+	input := make([]float32, readFrames*format.Channels)
+	mono := make([]float32, readFrames)
+	var total int64
+
+	emit := func(samples []float32) error {
+		if len(samples) == 0 {
+			return nil
+		}
+		total += int64(len(samples))
+		return sink(samples)
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+
+		n, err := decoder.Read(input)
+		if n > 0 {
+			var frames int
+			if channel == AllChannels {
+				frames = downmix(input[:n], mono, format.Channels)
+			} else {
+				frames = selectChannel(input[:n], mono, format.Channels, channel)
+			}
+			output := mono[:frames]
+			if resample != nil {
+				output = resample.Process(output)
+			}
+			if err := emit(output); err != nil {
+				return total, err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+
+	if resample != nil {
+		if err := emit(resample.Flush()); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// downmix averages interleaved channels into mono and returns the number
+// of frames written
+func downmix(interleaved, mono []float32, channels int) int {
+	frames := len(interleaved) / channels
+	if channels == 1 {
+		return copy(mono, interleaved)
+	}
+	for i := 0; i < frames; i++ {
+		var sum float32
+		for c := 0; c < channels; c++ {
+			sum += interleaved[i*channels+c]
+		}
+		mono[i] = sum / float32(channels)
+	}
+	return frames
+}
+
+// selectChannel copies one channel of interleaved samples into mono and
+// returns the number of frames written
+func selectChannel(interleaved, mono []float32, channels, channel int) int {
+	frames := len(interleaved) / channels
+	for i := 0; i < frames; i++ {
+		mono[i] = interleaved[i*channels+channel]
+	}
+	return frames
+}
@@ -0,0 +1,143 @@
+package audio
+
+import (
+	"context"
+	"errors"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// sine returns n samples of a sine at frequency Hz
+func sine(n int, frequency float64, sampleRate int) []float32 {
+	samples := make([]float32, n)
+	for i := range samples {
+		samples[i] = float32(0.5 * math.Sin(2*math.Pi*frequency*float64(i)/float64(sampleRate)))
+	}
+	return samples
+}
+
+// rms is the root mean square of samples
+func rms(samples []float32) float64 {
+	var sum float64
+	for _, sample := range samples {
+		sum += float64(sample) * float64(sample)
+	}
+	return math.Sqrt(sum / float64(len(samples)))
+}
+
+// crossings counts the times samples change sign
+func crossings(samples []float32) int {
+	count := 0
+	for i := 1; i < len(samples); i++ {
+		if (samples[i-1] < 0) != (samples[i] < 0) {
+			count++
+		}
+	}
+	return count
+}
+
+func TestResampler(t *testing.T) {
+	input := sine(44100, 1000, 44100)
+	r := newResampler(44100, WhisperSampleRate)
+
+	// Feeding the input in uneven blocks still produces one second, give or
+	// take the rounding of the step
+	var output []float32
+	for start := 0; start < len(input); start += 3001 {
+		output = append(output, r.Process(input[start:min(start+3001, len(input))])...)
+	}
+	output = append(output, r.Flush()...)
+	if len(output) < WhisperSampleRate-1 || len(output) > WhisperSampleRate+1 {
+		t.Fatalf("got %d samples, want about %d", len(output), WhisperSampleRate)
+	}
+
+	// The tone keeps its pitch and level away from the edges
+	middle := output[1000 : len(output)-1000]
+	if got := crossings(middle); got < 1740 || got > 1760 {
+		t.Errorf("%d zero crossings, want about 1750 for 1 kHz", got)
+	}
+	if got := rms(middle); math.Abs(got-0.5/math.Sqrt2) > 0.01 {
+		t.Errorf("rms = %v, want %v", got, 0.5/math.Sqrt2)
+	}
+}
+
+// Frequencies above the new Nyquist limit are filtered out, not folded
+// into the speech band
+func TestResamplerFiltersAliasing(t *testing.T) {
+	r := newResampler(44100, WhisperSampleRate)
+	output := append(r.Process(sine(44100, 12000, 44100)), r.Flush()...)
+	if got := rms(output[1000 : len(output)-1000]); got > 0.01 {
+		t.Errorf("rms of a 12 kHz tone = %v after resampling to 16 kHz", got)
+	}
+}
+
+// writeStereoWAV writes a 44.1 kHz WAV with a constant left and right value
+func writeStereoWAV(t *testing.T, frames int, left, right float32) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "stereo.wav")
+	writer, err := CreateWAV(path, 44100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := make([]float32, 2*frames)
+	for i := 0; i < frames; i++ {
+		samples[2*i], samples[2*i+1] = left, right
+	}
+	if err := writer.Write(samples); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConvertChannel(t *testing.T) {
+	src := writeStereoWAV(t, 44100, 0.5, -0.25)
+	info, err := Probe(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Channels != 2 || info.SampleRate != 44100 || info.Duration.Seconds() != 1 {
+		t.Fatalf("Probe = %v", info)
+	}
+
+	for channel, want := range map[int]float32{0: 0.5, 1: -0.25, AllChannels: 0.125} {
+		dst := filepath.Join(t.TempDir(), "mono.wav")
+		format, err := ConvertChannel(context.Background(), src, dst, channel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if format.Channels != 2 {
+			t.Errorf("source format = %v", format)
+		}
+		converted, samples := readAll(t, dst)
+		if converted.Channels != 1 || converted.SampleRate != WhisperSampleRate || math.Abs(float64(len(samples)-WhisperSampleRate)) > 1 {
+			t.Fatalf("channel %d: %v with %d samples", channel, converted, len(samples))
+		}
+		if got := samples[len(samples)/2]; math.Abs(float64(got-want)) > 0.001 {
+			t.Errorf("channel %d: sample = %v, want %v", channel, got, want)
+		}
+	}
+
+	dst := filepath.Join(t.TempDir(), "mono.wav")
+	if _, err := ConvertChannel(context.Background(), src, dst, 2); err == nil || !strings.Contains(err.Error(), "no channel 3") {
+		t.Errorf("ConvertChannel(2) = %v, want a missing channel error", err)
+	}
+}
+
+func TestStreamStopsWhenCancelled(t *testing.T) {
+	src := writeStereoWAV(t, 44100, 0.5, 0.5)
+	ctx, cancel := context.WithCancel(context.Background())
+	blocks := 0
+	_, err := Stream(ctx, src, AllChannels, func(samples []float32) error {
+		blocks++
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) || blocks != 1 {
+		t.Errorf("Stream = %v after %d blocks, want it cancelled after one", err, blocks)
+	}
+}
@@ -0,0 +1,96 @@
+package audio
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mewkiz/flac"
+)
+
+type flacDecoder struct {
+	file    *os.File
+	stream  *flac.Stream
+	format  Format
+	scale   float32
+	decoded []float32 // Interleaved samples of the current frame
+	offset  int       // Samples of decoded already returned
+}
+
+func newFLACDecoder(path string) (Decoder, error) {
+	// flac.Open does not close the file it opens, so manage it here
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audio file: %v", err)
+	}
+
+	stream, err := flac.New(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("invalid FLAC file: %v", err)
+	}
+
+	info := stream.Info
+	if info.NChannels == 0 || info.SampleRate == 0 || info.BitsPerSample == 0 || info.BitsPerSample > 32 {
+		file.Close()
+		return nil, fmt.Errorf("invalid FLAC file: bad stream info")
+	}
+
+	return &flacDecoder{
+		file:   file,
+		stream: stream,
+		format: Format{
+			Container:  "FLAC",
+			Codec:      "FLAC",
+			SampleRate: int(info.SampleRate),
+			Channels:   int(info.NChannels),
+			BitDepth:   int(info.BitsPerSample),
+		},
+		scale: 1 / float32(uint64(1)<<(info.BitsPerSample-1)),
+	}, nil
+}
+
+func (d *flacDecoder) Format() Format {
+	return d.format
+}
+
+func (d *flacDecoder) Read(samples []float32) (int, error) {
+	for d.offset == len(d.decoded) {
+		// A truncated file ends with a partial frame; keep the complete ones
+		frame, err := d.stream.ParseNext()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return 0, io.EOF
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to decode FLAC: %v", err)
+		}
+		if len(frame.Subframes) != d.format.Channels {
+			return 0, fmt.Errorf("failed to decode FLAC: frame has %d channels, expected %d", len(frame.Subframes), d.format.Channels)
+		}
+
+		// Interleave the per-channel subframes
+		d.decoded, d.offset = d.decoded[:0], 0
+		blockSize := int(frame.BlockSize)
+		for i := 0; i < blockSize; i++ {
+			for _, subframe := range frame.Subframes {
+				d.decoded = append(d.decoded, float32(subframe.Samples[i])*d.scale)
+			}
+		}
+	}
+
+	n := copy(samples[:len(samples)-len(samples)%d.format.Channels], d.decoded[d.offset:])
+	d.offset += n
+	return n, nil
+}
+
+func (d *flacDecoder) Frames() int64 {
+	// Zero means the encoder did not know the length
+	if samples := d.stream.Info.NSamples; samples > 0 {
+		return int64(samples)
+	}
+	return -1
+}
+
+func (d *flacDecoder) Close() error {
+	return d.file.Close()
+}
@@ -0,0 +1,92 @@
+package audio
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/frame"
+	"github.com/mewkiz/flac/meta"
+)
+
+// writeFLAC encodes 16-bit stereo FLAC with verbatim subframes, one frame
+// per block of left and right samples
+func writeFLAC(t *testing.T, sampleRate int, blocks [][2][]int32) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.flac")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &meta.StreamInfo{
+		BlockSizeMin:  16,
+		BlockSizeMax:  4096,
+		SampleRate:    uint32(sampleRate),
+		NChannels:     2,
+		BitsPerSample: 16,
+	}
+	encoder, err := flac.NewEncoder(file, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, block := range blocks {
+		f := &frame.Frame{
+			Header: frame.Header{
+				HasFixedBlockSize: true,
+				BlockSize:         uint16(len(block[0])),
+				SampleRate:        uint32(sampleRate),
+				Channels:          frame.ChannelsLR,
+				BitsPerSample:     16,
+			},
+		}
+		for _, samples := range block {
+			f.Subframes = append(f.Subframes, &frame.Subframe{
+				SubHeader: frame.SubHeader{Pred: frame.PredVerbatim},
+				Samples:   samples,
+				NSamples:  len(samples),
+			})
+		}
+		if err := encoder.WriteFrame(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// constant returns n copies of value
+func constant(n int, value int32) []int32 {
+	samples := make([]int32, n)
+	for i := range samples {
+		samples[i] = value
+	}
+	return samples
+}
+
+func TestFLAC(t *testing.T) {
+	blocks := [][2][]int32{
+		{constant(4096, 16384), constant(4096, -8192)},
+		{constant(4096, 16384), constant(4096, -8192)},
+		{constant(1808, -16384), constant(1808, 8192)},
+	}
+	path := writeFLAC(t, 8000, blocks)
+
+	info, err := Probe(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Container != "FLAC" || info.Channels != 2 || info.SampleRate != 8000 || info.BitDepth != 16 || info.Duration.Seconds() != 1.25 {
+		t.Fatalf("Probe = %v", info)
+	}
+
+	_, samples := readAll(t, path)
+	if len(samples) != 2*10000 {
+		t.Fatalf("decoded %d samples, want %d", len(samples), 2*10000)
+	}
+	if samples[0] != 0.5 || samples[1] != -0.25 || samples[len(samples)-2] != -0.5 || samples[len(samples)-1] != 0.25 {
+		t.Errorf("samples start %v and end %v", samples[:2], samples[len(samples)-2:])
+	}
+}
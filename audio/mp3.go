@@ -0,0 +1,136 @@
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hajimehoshi/go-mp3"
+)
+
+// go-mp3 always produces 16-bit little-endian stereo, even for mono files,
+// whose one channel it copies to both
+const (
+	mp3DecodedChannels = 2
+	mp3BytesPerSample  = 2
+)
+
+// mp3HeaderSearch is how far past any ID3v2 tag the first frame header is
+// looked for
+const mp3HeaderSearch = 64 * 1024
+
+type mp3Decoder struct {
+	file    *os.File
+	decoder *mp3.Decoder
+	format  Format
+	buffer  []byte
+}
+
+func newMP3Decoder(file *os.File) (Decoder, error) {
+	// go-mp3 does not report the channel mode, so it is read from the first
+	// frame header before the decoder moves the file offset
+	channels := mp3Channels(file)
+
+	decoder, err := mp3.NewDecoder(file)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		file.Close()
+		return nil, fmt.Errorf("invalid MP3 file: no complete MPEG audio frame found")
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("invalid MP3 file: %v", err)
+	}
+
+	return &mp3Decoder{
+		file:    file,
+		decoder: decoder,
+		format: Format{
+			Container:  "MP3",
+			Codec:      "MP3",
+			SampleRate: decoder.SampleRate(),
+			Channels:   channels,
+		},
+	}, nil
+}
+
+func (d *mp3Decoder) Format() Format {
+	return d.format
+}
+
+func (d *mp3Decoder) Read(samples []float32) (int, error) {
+	frames := len(samples) / d.format.Channels
+	size := frames * mp3DecodedChannels * mp3BytesPerSample
+	if cap(d.buffer) < size {
+		d.buffer = make([]byte, size)
+	}
+	buffer := d.buffer[:size]
+
+	n, err := io.ReadFull(d.decoder, buffer)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return 0, fmt.Errorf("failed to decode MP3: %v", err)
+	}
+	frames = n / (mp3DecodedChannels * mp3BytesPerSample)
+	if frames == 0 {
+		return 0, io.EOF
+	}
+
+	// Mono files keep only the left of the two identical channels
+	step := mp3DecodedChannels / d.format.Channels
+	count := frames * d.format.Channels
+	for i := 0; i < count; i++ {
+		offset := (i/d.format.Channels*mp3DecodedChannels + i%d.format.Channels*step) * mp3BytesPerSample
+		samples[i] = float32(int16(binary.LittleEndian.Uint16(buffer[offset:]))) / 32768
+	}
+	return count, nil
+}
+
+func (d *mp3Decoder) Frames() int64 {
+	if length := d.decoder.Length(); length >= 0 {
+		return length / (mp3DecodedChannels * mp3BytesPerSample)
+	}
+	return -1
+}
+
+func (d *mp3Decoder) Close() error {
+	return d.file.Close()
+}
+
+// mp3Channels reads the channel mode from the first MPEG audio frame
+// header after any ID3v2 tag: 1 for mono, 2 for stereo, joint stereo and
+// dual channel. Files whose header cannot be found are taken for stereo,
+// as go-mp3 decodes them.
+func mp3Channels(file *os.File) int {
+	offset := int64(0)
+	tag := make([]byte, 10)
+	if _, err := file.ReadAt(tag, 0); err == nil && string(tag[:3]) == "ID3" {
+		// The tag size is stored in 7 bits per byte
+		size := int64(tag[6]&0x7f)<<21 | int64(tag[7]&0x7f)<<14 | int64(tag[8]&0x7f)<<7 | int64(tag[9]&0x7f)
+		offset = 10 + size
+		if tag[5]&0x10 != 0 {
+			offset += 10 // Footer
+		}
+	}
+
+	buffer := make([]byte, mp3HeaderSearch)
+	n, _ := file.ReadAt(buffer, offset)
+	buffer = buffer[:n]
+	for i := 0; i+4 <= len(buffer); i++ {
+		header := buffer[i : i+4]
+		if header[0] != 0xff || header[1]&0xe0 != 0xe0 {
+			continue
+		}
+		version := header[1] >> 3 & 3
+		layer := header[1] >> 1 & 3
+		bitrate := header[2] >> 4
+		sampleRate := header[2] >> 2 & 3
+		if version == 1 || layer == 0 || bitrate == 0 || bitrate == 15 || sampleRate == 3 {
+			continue
+		}
+		if header[3]>>6 == 3 {
+			return 1
+		}
+		return 2
+	}
+	return mp3DecodedChannels
+}
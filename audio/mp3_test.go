@@ -0,0 +1,46 @@
+package audio
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// mp3Header is an MPEG-1 Layer III frame header at 128 kbps and 44.1 kHz
+// with the given channel mode
+func mp3Header(mode byte) []byte {
+	return []byte{0xff, 0xfb, 0x90, mode << 6}
+}
+
+func TestMP3Channels(t *testing.T) {
+	id3 := []byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0, 20}
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"stereo", mp3Header(0), 2},
+		{"joint stereo", mp3Header(1), 2},
+		{"dual channel", mp3Header(2), 2},
+		{"mono", mp3Header(3), 1},
+		{"mono after ID3 tag", append(append(id3, make([]byte, 20)...), mp3Header(3)...), 1},
+		{"mono after junk", append([]byte{0xff, 0x00, 0x12}, mp3Header(3)...), 1},
+		{"no header", []byte("not an mp3 file"), 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.mp3")
+			if err := os.WriteFile(path, append(test.data, make([]byte, 64)...), 0644); err != nil {
+				t.Fatal(err)
+			}
+			file, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			if got := mp3Channels(file); got != test.want {
+				t.Errorf("mp3Channels = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
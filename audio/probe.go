@@ -0,0 +1,78 @@
+package audio
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Info describes an audio file
+type Info struct {
+	Format
+	Duration time.Duration
+	Size     int64 // File size in bytes
+}
+
+func (i Info) String() string {
+	return fmt.Sprintf("%s, %s", i.Format, i.Duration.Round(time.Millisecond))
+}
+
+// Probe inspects an audio file without converting it. Besides parsing the
+// header it decodes the first block of samples, so empty, truncated or
+// corrupt files are rejected before any transcription work starts.
+func Probe(path string) (Info, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Info{}, fmt.Errorf("audio file not found: %s", path)
+		}
+		return Info{}, fmt.Errorf("failed to read audio file: %v", err)
+	}
+	if stat.IsDir() {
+		return Info{}, fmt.Errorf("%s is a directory, not an audio file", path)
+	}
+	if stat.Size() == 0 {
+		return Info{}, fmt.Errorf("audio file is empty")
+	}
+
+	decoder, err := Open(path)
+	if err != nil {
+		return Info{}, err
+	}
+	defer decoder.Close()
+
+	format := decoder.Format()
+	info := Info{
+		Format: format,
+		Size:   stat.Size(),
+	}
+
+	samples := make([]float32, readFrames*format.Channels)
+	n, err := decoder.Read(samples)
+	if err != nil && err != io.EOF {
+		return info, fmt.Errorf("corrupt %s file: %v", format.Container, err)
+	}
+	if n == 0 {
+		return info, fmt.Errorf("audio file contains no samples")
+	}
+
+	// Count the frames by decoding when the container does not record them
+	frames := decoder.Frames()
+	if frames < 0 {
+		frames = int64(n / format.Channels)
+		for {
+			n, err := decoder.Read(samples)
+			frames += int64(n / format.Channels)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return info, fmt.Errorf("corrupt %s file: %v", format.Container, err)
+			}
+		}
+	}
+
+	info.Duration = time.Duration(frames) * time.Second / time.Duration(format.SampleRate)
+	return info, nil
+}
@@ -0,0 +1,54 @@
+package audio
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProbeErrors(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty.wav")
+	headerOnly := filepath.Join(dir, "header.wav")
+	ogg := filepath.Join(dir, "voice.ogg")
+	text := filepath.Join(dir, "notes.txt")
+	files := map[string][]byte{
+		empty: nil,
+		ogg:   append([]byte("OggS\x00\x02"), append(make([]byte, 20), append([]byte{1, 19}, "OpusHead"...)...)...),
+		text:  []byte("not audio at all"),
+	}
+	for path, data := range files {
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writer, err := CreateWAV(headerOnly, WhisperSampleRate, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{filepath.Join(dir, "missing.wav"), "not found"},
+		{dir, "is a directory"},
+		{empty, "empty"},
+		{headerOnly, "no samples"},
+		{ogg, "Opus in Ogg container"},
+		{text, "not WAV, MP3 or FLAC"},
+	}
+	for _, test := range tests {
+		if _, err := Probe(test.path); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("Probe(%s) = %v, want an error containing %q", filepath.Base(test.path), err, test.want)
+		}
+	}
+	if _, err := Probe(ogg); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("Probe(ogg) = %v, want ErrUnsupportedFormat", err)
+	}
+}
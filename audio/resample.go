@@ -0,0 +1,117 @@
+package audio
+
+import "math"
+
+// Resampler filter parameters. Eight zero crossings per side keep the
+// transition band narrow enough for speech while staying fast.
+const (
+	zeroCrossings    = 8
+	kernelResolution = 256  // Kernel table entries per input sample
+	cutoffMargin     = 0.95 // Keep the pass band slightly below Nyquist
+)
+
+// resampler converts a mono stream between sample rates using a windowed
+// sinc low-pass filter, so downsampling does not alias. Input can be fed in
+// arbitrary chunks.
+type resampler struct {
+	step      float64   // Input samples per output sample
+	halfWidth int       // Filter half-width in input samples
+	kernel    []float32 // One side of the filter, kernelResolution entries per input sample
+	buffer    []float32 // Input still needed by the filter
+	position  float64   // Position of the next output sample in buffer
+}
+
+func newResampler(from, to int) *resampler {
+	cutoff := cutoffMargin * math.Min(1, float64(to)/float64(from))
+	halfWidth := int(math.Ceil(zeroCrossings / cutoff))
+
+	// Blackman-windowed sinc, sampled for t in [0, halfWidth]
+	kernel := make([]float32, halfWidth*kernelResolution+2)
+	for i := range kernel {
+		t := float64(i) / kernelResolution
+		if t > float64(halfWidth) {
+			break
+		}
+		x := math.Pi * cutoff * t
+		sinc := 1.0
+		if x != 0 {
+			sinc = math.Sin(x) / x
+		}
+		w := t / float64(halfWidth)
+		window := 0.42 + 0.5*math.Cos(math.Pi*w) + 0.08*math.Cos(2*math.Pi*w)
+		kernel[i] = float32(cutoff * sinc * window)
+	}
+
+	// Start with silence before the first sample so the filter has history
+	return &resampler{
+		step:      float64(from) / float64(to),
+		halfWidth: halfWidth,
+		kernel:    kernel,
+		buffer:    make([]float32, halfWidth),
+		position:  float64(halfWidth),
+	}
+}
+
+// Process consumes input samples and returns the output samples that can
+// be computed so far
+func (r *resampler) Process(input []float32) []float32 {
+	r.buffer = append(r.buffer, input...)
+
+	var output []float32
+	for int(r.position)+r.halfWidth < len(r.buffer) {
+		output = append(output, r.sample(r.position))
+		r.position += r.step
+	}
+
+	// Drop input the filter no longer reaches
+	if drop := int(r.position) - r.halfWidth; drop > 0 {
+		r.buffer = r.buffer[:copy(r.buffer, r.buffer[drop:])]
+		r.position -= float64(drop)
+	}
+	return output
+}
+
+// Flush returns the remaining output, treating the input as followed by
+// silence
+func (r *resampler) Flush() []float32 {
+	end := float64(len(r.buffer))
+	r.buffer = append(r.buffer, make([]float32, r.halfWidth+1)...)
+
+	var output []float32
+	for r.position < end {
+		output = append(output, r.sample(r.position))
+		r.position += r.step
+	}
+	return output
+}
+
+// sample evaluates the filter centred on position. Taps are one input
+// sample apart, so both sides of the kernel are walked with a fixed stride
+// and a fixed interpolation fraction.
+func (r *resampler) sample(position float64) float32 {
+	base := int(position)
+	frac := position - float64(base)
+
+	var sum float32
+	left, leftFrac := kernelIndex(frac)
+	for j := 0; j < r.halfWidth; j++ {
+		i := left + j*kernelResolution
+		tap := r.kernel[i]*(1-leftFrac) + r.kernel[i+1]*leftFrac
+		sum += r.buffer[base-j] * tap
+	}
+	right, rightFrac := kernelIndex(1 - frac)
+	for j := 0; j < r.halfWidth; j++ {
+		i := right + j*kernelResolution
+		tap := r.kernel[i]*(1-rightFrac) + r.kernel[i+1]*rightFrac
+		sum += r.buffer[base+1+j] * tap
+	}
+	return sum
+}
+
+// kernelIndex splits a distance below one input sample into a kernel table
+// index and an interpolation fraction
+func kernelIndex(t float64) (int, float32) {
+	index := t * kernelResolution
+	i := int(index)
+	return i, float32(index - float64(i))
+}
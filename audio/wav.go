@@ -0,0 +1,532 @@
+package audio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// WAV format tags
+const (
+	wavFormatPCM        = 0x0001
+	wavFormatFloat      = 0x0003
+	wavFormatALaw       = 0x0006
+	wavFormatMuLaw      = 0x0007
+	wavFormatExtensible = 0xFFFE
+)
+
+// wavCodecNames names format tags the decoder does not implement
+var wavCodecNames = map[uint16]string{
+	0x0002: "Microsoft ADPCM",
+	0x0011: "IMA ADPCM",
+	0x0031: "GSM 6.10",
+	0x0050: "MPEG layer I/II",
+	0x0055: "MP3",
+	0x00FF: "AAC",
+	0x0160: "WMA",
+	0x0161: "WMA",
+	0x1610: "AAC",
+	0x2000: "AC-3",
+}
+
+// wavSizeUnknown marks a data chunk whose size was not filled in, as written
+// by streaming recorders and RF64 files
+const wavSizeUnknown = 0xFFFFFFFF
+
+type wavDecoder struct {
+	file           *os.File
+	reader         *bufio.Reader
+	format         Format
+	formatTag      uint16
+	bytesPerSample int
+	blockAlign     int
+	remaining      int64 // Bytes left in the data chunk, -1 if unknown
+	frames         int64 // Complete frames in the data chunk
+	dataOffset     int64 // File offset of the first sample
+	buffer         []byte
+}
+
+func newWAVDecoder(file *os.File) (Decoder, error) {
+	d := &wavDecoder{
+		file:   file,
+		reader: bufio.NewReader(file),
+	}
+	dataOffset, err := d.readHeader()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	// The data chunk may claim more bytes than a truncated file holds
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read WAV file: %v", err)
+	}
+	dataSize := stat.Size() - dataOffset
+	if d.remaining >= 0 && d.remaining < dataSize {
+		dataSize = d.remaining
+	}
+	if dataSize < 0 {
+		dataSize = 0
+	}
+	d.frames = dataSize / int64(d.blockAlign)
+	d.dataOffset = dataOffset
+	return d, nil
+}
+
+// readHeader parses chunks up to the start of the sample data and returns
+// the file offset of the first sample
+func (d *wavDecoder) readHeader() (int64, error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(d.reader, riff[:]); err != nil {
+		return 0, fmt.Errorf("invalid WAV file: truncated header")
+	}
+	offset := int64(len(riff))
+
+	haveFormat := false
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(d.reader, chunk[:]); err != nil {
+			if !haveFormat {
+				return 0, fmt.Errorf("invalid WAV file: missing fmt chunk")
+			}
+			return 0, fmt.Errorf("invalid WAV file: missing data chunk")
+		}
+		id := string(chunk[:4])
+		size := binary.LittleEndian.Uint32(chunk[4:])
+		offset += int64(len(chunk))
+
+		switch id {
+		case "fmt ":
+			if err := d.readFormat(size); err != nil {
+				return 0, err
+			}
+			haveFormat = true
+			offset += int64(size) + int64(size&1)
+		case "data":
+			if !haveFormat {
+				return 0, fmt.Errorf("invalid WAV file: data chunk before fmt chunk")
+			}
+			d.remaining = int64(size)
+			if size == wavSizeUnknown {
+				d.remaining = -1
+			}
+			return offset, nil
+		default:
+			// Skip chunks such as LIST, fact or ds64; chunks are word aligned
+			skip := int64(size) + int64(size&1)
+			if _, err := io.CopyN(io.Discard, d.reader, skip); err != nil {
+				return 0, fmt.Errorf("invalid WAV file: truncated %q chunk", id)
+			}
+			offset += skip
+		}
+	}
+}
+
+func (d *wavDecoder) readFormat(size uint32) error {
+	if size < 16 || size > 1024 {
+		return fmt.Errorf("invalid WAV file: bad fmt chunk size %d", size)
+	}
+	chunk := make([]byte, size+size&1)
+	if _, err := io.ReadFull(d.reader, chunk); err != nil {
+		return fmt.Errorf("invalid WAV file: truncated fmt chunk")
+	}
+
+	d.formatTag = binary.LittleEndian.Uint16(chunk[0:])
+	channels := int(binary.LittleEndian.Uint16(chunk[2:]))
+	sampleRate := int(binary.LittleEndian.Uint32(chunk[4:]))
+	d.blockAlign = int(binary.LittleEndian.Uint16(chunk[12:]))
+	bitDepth := int(binary.LittleEndian.Uint16(chunk[14:]))
+
+	// WAVE_FORMAT_EXTENSIBLE stores the real format tag in its sub-format GUID
+	if d.formatTag == wavFormatExtensible {
+		if size < 40 {
+			return fmt.Errorf("invalid WAV file: truncated extensible fmt chunk")
+		}
+		if validBits := int(binary.LittleEndian.Uint16(chunk[18:])); validBits > 0 {
+			bitDepth = validBits
+		}
+		d.formatTag = binary.LittleEndian.Uint16(chunk[24:])
+	}
+
+	var codec string
+	switch d.formatTag {
+	case wavFormatPCM:
+		codec = "PCM"
+	case wavFormatFloat:
+		codec = "IEEE float"
+	case wavFormatALaw:
+		codec = "A-law"
+	case wavFormatMuLaw:
+		codec = "µ-law"
+	default:
+		name, ok := wavCodecNames[d.formatTag]
+		if !ok {
+			name = fmt.Sprintf("format tag 0x%04X", d.formatTag)
+		}
+		return &UnsupportedCodecError{Container: "WAV", Codec: name}
+	}
+
+	if channels < 1 {
+		return fmt.Errorf("invalid WAV file: %d channels", channels)
+	}
+	if sampleRate < 1 {
+		return fmt.Errorf("invalid WAV file: sample rate %d Hz", sampleRate)
+	}
+	if d.blockAlign%channels != 0 || d.blockAlign == 0 {
+		return fmt.Errorf("invalid WAV file: block size %d does not match %d channels", d.blockAlign, channels)
+	}
+	d.bytesPerSample = d.blockAlign / channels
+
+	// Samples may be stored in a wider container, e.g. 20-bit in 3 bytes
+	supported := false
+	switch d.formatTag {
+	case wavFormatPCM:
+		supported = d.bytesPerSample >= 1 && d.bytesPerSample <= 4
+	case wavFormatFloat:
+		supported = d.bytesPerSample == 4 || d.bytesPerSample == 8
+	case wavFormatALaw, wavFormatMuLaw:
+		supported = d.bytesPerSample == 1
+	}
+	if !supported {
+		return &UnsupportedCodecError{Container: "WAV", Codec: fmt.Sprintf("%d-bit %s", bitDepth, codec)}
+	}
+
+	d.format = Format{
+		Container:  "WAV",
+		Codec:      codec,
+		SampleRate: sampleRate,
+		Channels:   channels,
+		BitDepth:   bitDepth,
+	}
+	return nil
+}
+
+func (d *wavDecoder) Format() Format {
+	return d.format
+}
+
+func (d *wavDecoder) Read(samples []float32) (int, error) {
+	frames := len(samples) / d.format.Channels
+	size := int64(frames * d.blockAlign)
+	if d.remaining >= 0 && size > d.remaining {
+		size = d.remaining
+	}
+	if size == 0 {
+		return 0, io.EOF
+	}
+	if int64(cap(d.buffer)) < size {
+		d.buffer = make([]byte, size)
+	}
+	buffer := d.buffer[:size]
+
+	// A truncated file ends with a partial frame; keep the complete ones
+	n, err := io.ReadFull(d.reader, buffer)
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		d.remaining = 0
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to read WAV data: %v", err)
+	} else if d.remaining > 0 {
+		d.remaining -= int64(n)
+	}
+	n -= n % d.blockAlign
+	if n == 0 {
+		return 0, io.EOF
+	}
+
+	count := n / d.bytesPerSample
+	for i := 0; i < count; i++ {
+		samples[i] = d.decodeSample(buffer[i*d.bytesPerSample:])
+	}
+	return count, nil
+}
+
+// decodeSample converts one stored sample to a float in [-1, 1]
+func (d *wavDecoder) decodeSample(b []byte) float32 {
+	switch d.formatTag {
+	case wavFormatFloat:
+		if d.bytesPerSample == 8 {
+			return float32(math.Float64frombits(binary.LittleEndian.Uint64(b)))
+		}
+		return math.Float32frombits(binary.LittleEndian.Uint32(b))
+	case wavFormatALaw:
+		return float32(alawToLinear(b[0])) / 32768
+	case wavFormatMuLaw:
+		return float32(ulawToLinear(b[0])) / 32768
+	}
+
+	switch d.bytesPerSample {
+	case 1:
+		// 8-bit PCM is unsigned
+		return (float32(b[0]) - 128) / 128
+	case 2:
+		return float32(int16(binary.LittleEndian.Uint16(b))) / 32768
+	case 3:
+		value := int32(b[0])<<8 | int32(b[1])<<16 | int32(b[2])<<24
+		return float32(value) / 2147483648
+	default:
+		return float32(int32(binary.LittleEndian.Uint32(b))) / 2147483648
+	}
+}
+
+func (d *wavDecoder) Frames() int64 {
+	return d.frames
+}
+
+func (d *wavDecoder) Close() error {
+	return d.file.Close()
+}
+
+// seek positions the decoder at the given frame
+func (d *wavDecoder) seek(frame int64) error {
+	if frame > d.frames {
+		frame = d.frames
+	}
+	if _, err := d.file.Seek(d.dataOffset+frame*int64(d.blockAlign), io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek in WAV file: %v", err)
+	}
+	d.reader.Reset(d.file)
+	d.remaining = (d.frames - frame) * int64(d.blockAlign)
+	return nil
+}
+
+// alawToLinear expands an ITU-T G.711 A-law sample to 16-bit PCM
+func alawToLinear(a byte) int16 {
+	a ^= 0x55
+	value := int(a&0x0F) << 4
+	segment := (a & 0x70) >> 4
+	switch segment {
+	case 0:
+		value += 8
+	case 1:
+		value += 0x108
+	default:
+		value += 0x108
+		value <<= segment - 1
+	}
+	if a&0x80 != 0 {
+		return int16(value)
+	}
+	return int16(-value)
+}
+
+// ulawToLinear expands an ITU-T G.711 µ-law sample to 16-bit PCM
+func ulawToLinear(u byte) int16 {
+	u = ^u
+	value := (int(u&0x0F) << 3) + 0x84
+	value <<= (u & 0x70) >> 4
+	if u&0x80 != 0 {
+		return int16(0x84 - value)
+	}
+	return int16(value - 0x84)
+}
+
+// WAVWriter writes 16-bit PCM WAV files. The header sizes are filled in
+// when the writer is closed.
+type WAVWriter struct {
+	file       *os.File
+	writer     *bufio.Writer
+	sampleRate int
+	channels   int
+	dataSize   int64
+	buffer     []byte
+}
+
+// CreateWAV creates a 16-bit PCM WAV file at path
+func CreateWAV(path string, sampleRate, channels int) (*WAVWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create WAV file: %v", err)
+	}
+
+	w := &WAVWriter{
+		file:       file,
+		writer:     bufio.NewWriter(file),
+		sampleRate: sampleRate,
+		channels:   channels,
+	}
+	if _, err := w.writer.Write(w.header()); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write WAV header: %v", err)
+	}
+	return w, nil
+}
+
+// header builds the 44-byte canonical WAV header for the data written so far
+func (w *WAVWriter) header() []byte {
+	const bytesPerSample = 2
+	header := make([]byte, 44)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(36+w.dataSize))
+	copy(header[8:], "WAVE")
+	copy(header[12:], "fmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], wavFormatPCM)
+	binary.LittleEndian.PutUint16(header[22:], uint16(w.channels))
+	binary.LittleEndian.PutUint32(header[24:], uint32(w.sampleRate))
+	binary.LittleEndian.PutUint32(header[28:], uint32(w.sampleRate*w.channels*bytesPerSample))
+	binary.LittleEndian.PutUint16(header[32:], uint16(w.channels*bytesPerSample))
+	binary.LittleEndian.PutUint16(header[34:], 8*bytesPerSample)
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], uint32(w.dataSize))
+	return header
+}
+
+// Write appends interleaved samples in [-1, 1], clipping values outside it
+func (w *WAVWriter) Write(samples []float32) error {
+	if cap(w.buffer) < 2*len(samples) {
+		w.buffer = make([]byte, 2*len(samples))
+	}
+	buffer := w.buffer[:2*len(samples)]
+	for i, sample := range samples {
+		value := math.Round(float64(sample) * 32767)
+		value = math.Max(-32768, math.Min(32767, value))
+		binary.LittleEndian.PutUint16(buffer[2*i:], uint16(int16(value)))
+	}
+
+	if _, err := w.writer.Write(buffer); err != nil {
+		return fmt.Errorf("failed to write WAV data: %v", err)
+	}
+	w.dataSize += int64(len(buffer))
+	return nil
+}
+
+// Close writes the final header sizes and closes the file
+func (w *WAVWriter) Close() error {
+	if err := w.writer.Flush(); err != nil {
+		w.file.Close()
+		return fmt.Errorf("failed to write WAV data: %v", err)
+	}
+	if _, err := w.file.WriteAt(w.header(), 0); err != nil {
+		w.file.Close()
+		return fmt.Errorf("failed to write WAV header: %v", err)
+	}
+	return w.file.Close()
+}
+
+// ExtractWAV copies frames [start, end) of the WAV file src into a new 16-bit
+// PCM WAV file dst, e.g. to split a long recording into chunks
+func ExtractWAV(src, dst string, start, end int64) error {
+	decoder, err := Open(src)
+	if err != nil {
+		return err
+	}
+	defer decoder.Close()
+
+	wav, ok := decoder.(*wavDecoder)
+	if !ok {
+		return fmt.Errorf("cannot extract from %s: not a WAV file", src)
+	}
+	if err := wav.seek(start); err != nil {
+		return err
+	}
+
+	format := wav.Format()
+	writer, err := CreateWAV(dst, format.SampleRate, format.Channels)
+	if err != nil {
+		return err
+	}
+
+	samples := make([]float32, readFrames*format.Channels)
+	for remaining := (end - start) * int64(format.Channels); remaining > 0; {
+		block := samples
+		if int64(len(block)) > remaining {
+			block = block[:remaining]
+		}
+		n, readErr := wav.Read(block)
+		if n > 0 {
+			if err := writer.Write(block[:n]); err != nil {
+				writer.Close()
+				os.Remove(dst)
+				return err
+			}
+			remaining -= int64(n)
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			writer.Close()
+			os.Remove(dst)
+			return readErr
+		}
+	}
+	return writer.Close()
+}
+
+// WAVReader reads stretches of a WAV file by position, e.g. the speech in
+// a long recording, without decoding the rest of it
+type WAVReader struct {
+	decoder *wavDecoder
+}
+
+// OpenWAV opens the WAV file at path for reading by position
+func OpenWAV(path string) (*WAVReader, error) {
+	decoder, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	wav, ok := decoder.(*wavDecoder)
+	if !ok {
+		decoder.Close()
+		return nil, fmt.Errorf("cannot read %s by position: not a WAV file", path)
+	}
+	return &WAVReader{decoder: wav}, nil
+}
+
+// Format describes the file's samples
+func (r *WAVReader) Format() Format {
+	return r.decoder.Format()
+}
+
+// Frames returns the number of frames in the file
+func (r *WAVReader) Frames() int64 {
+	return r.decoder.Frames()
+}
+
+// ReadFrames returns the interleaved samples of frames [start, end). Fewer
+// frames are returned when the range runs past the end of the file.
+func (r *WAVReader) ReadFrames(start, end int64) ([]float32, error) {
+	end = min(end, r.decoder.Frames())
+	if start < 0 || start >= end {
+		return nil, nil
+	}
+	if err := r.decoder.seek(start); err != nil {
+		return nil, err
+	}
+	samples := make([]float32, (end-start)*int64(r.decoder.format.Channels))
+	read := 0
+	for read < len(samples) {
+		n, err := r.decoder.Read(samples[read:])
+		read += n
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return samples[:read], nil
+}
+
+// Close closes the file
+func (r *WAVReader) Close() error {
+	return r.decoder.Close()
+}
+
+// WriteWAV writes mono samples to a 16-bit PCM WAV file
+func WriteWAV(path string, samples []float32, sampleRate int) error {
+	w, err := CreateWAV(path, sampleRate, 1)
+	if err != nil {
+		return err
+	}
+	if err := w.Write(samples); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,174 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// ramp returns n samples rising evenly from -1 towards 1
+func ramp(n int) []float32 {
+	samples := make([]float32, n)
+	for i := range samples {
+		samples[i] = -1 + 2*float32(i)/float32(n)
+	}
+	return samples
+}
+
+func TestWAVReaderReadFrames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ramp.wav")
+	samples := ramp(1000)
+	if err := WriteWAV(path, samples, WhisperSampleRate); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := OpenWAV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if reader.Frames() != 1000 || reader.Format().Channels != 1 {
+		t.Fatalf("format = %v, %d frames", reader.Format(), reader.Frames())
+	}
+
+	tests := []struct {
+		start, end int64
+		want       int
+	}{
+		{0, 10, 10},
+		{500, 700, 200},
+		{990, 2000, 10},
+		{100, 50, 0},
+		{1000, 1010, 0},
+	}
+	for _, test := range tests {
+		got, err := reader.ReadFrames(test.start, test.end)
+		if err != nil || len(got) != test.want {
+			t.Errorf("ReadFrames(%d, %d) = %d samples, %v, want %d", test.start, test.end, len(got), err, test.want)
+			continue
+		}
+		for i, sample := range got {
+			if diff := sample - samples[test.start+int64(i)]; diff > 1.0/16384 || diff < -1.0/16384 {
+				t.Errorf("ReadFrames(%d, %d)[%d] = %v, want %v", test.start, test.end, i, sample, samples[test.start+int64(i)])
+				break
+			}
+		}
+	}
+}
+
+// writeRawWAV writes a WAV file with a fmt chunk for the given format tag
+// and the data bytes as they are, preceded by a LIST chunk to skip
+func writeRawWAV(t *testing.T, tag uint16, channels, sampleRate, bytesPerSample int, data []byte) string {
+	t.Helper()
+	blockAlign := channels * bytesPerSample
+	header := make([]byte, 0, 64)
+	header = append(header, "RIFF\x00\x00\x00\x00WAVE"...)
+	header = append(header, "LIST\x03\x00\x00\x00abc\x00"...)
+	header = append(header, "fmt \x10\x00\x00\x00"...)
+	header = binary.LittleEndian.AppendUint16(header, tag)
+	header = binary.LittleEndian.AppendUint16(header, uint16(channels))
+	header = binary.LittleEndian.AppendUint32(header, uint32(sampleRate))
+	header = binary.LittleEndian.AppendUint32(header, uint32(sampleRate*blockAlign))
+	header = binary.LittleEndian.AppendUint16(header, uint16(blockAlign))
+	header = binary.LittleEndian.AppendUint16(header, uint16(8*bytesPerSample))
+	header = append(header, "data"...)
+	header = binary.LittleEndian.AppendUint32(header, uint32(len(data)))
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(header)-8+len(data)))
+
+	path := filepath.Join(t.TempDir(), "test.wav")
+	if err := os.WriteFile(path, append(header, data...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// readAll decodes every sample of path
+func readAll(t *testing.T, path string) (Format, []float32) {
+	t.Helper()
+	decoder, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer decoder.Close()
+	var samples []float32
+	block := make([]float32, 6*decoder.Format().Channels)
+	for {
+		n, err := decoder.Read(block)
+		samples = append(samples, block[:n]...)
+		if err == io.EOF {
+			return decoder.Format(), samples
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWAVFormats(t *testing.T) {
+	float32Bytes := binary.LittleEndian.AppendUint32(nil, math.Float32bits(0.25))
+	float32Bytes = binary.LittleEndian.AppendUint32(float32Bytes, math.Float32bits(-0.5))
+	tests := []struct {
+		name           string
+		tag            uint16
+		bytesPerSample int
+		data           []byte
+		codec          string
+		want           []float32
+	}{
+		{"8-bit PCM", wavFormatPCM, 1, []byte{128, 192, 64}, "PCM", []float32{0, 0.5, -0.5}},
+		{"16-bit PCM", wavFormatPCM, 2, []byte{0x00, 0x40, 0x00, 0xC0}, "PCM", []float32{0.5, -0.5}},
+		{"24-bit PCM", wavFormatPCM, 3, []byte{0x00, 0x00, 0x40, 0x00, 0x00, 0xE0}, "PCM", []float32{0.5, -0.25}},
+		{"32-bit PCM", wavFormatPCM, 4, []byte{0, 0, 0, 0x40, 0, 0, 0, 0x80}, "PCM", []float32{0.5, -1}},
+		{"32-bit float", wavFormatFloat, 4, float32Bytes, "IEEE float", []float32{0.25, -0.5}},
+		{"µ-law", wavFormatMuLaw, 1, []byte{0xFF, 0x7F}, "µ-law", []float32{0, 0}},
+		{"A-law", wavFormatALaw, 1, []byte{0xD5, 0x55}, "A-law", []float32{8.0 / 32768, -8.0 / 32768}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeRawWAV(t, test.tag, 1, 8000, test.bytesPerSample, test.data)
+			format, samples := readAll(t, path)
+			if format.Codec != test.codec || format.SampleRate != 8000 || format.BitDepth != 8*test.bytesPerSample {
+				t.Errorf("format = %v", format)
+			}
+			if len(samples) != len(test.want) {
+				t.Fatalf("samples = %v, want %v", samples, test.want)
+			}
+			for i := range samples {
+				if math.Abs(float64(samples[i]-test.want[i])) > 1e-6 {
+					t.Errorf("samples = %v, want %v", samples, test.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestWAVUnsupportedCodec(t *testing.T) {
+	path := writeRawWAV(t, 0x0011, 1, 8000, 1, make([]byte, 16))
+	_, err := Open(path)
+	var codecErr *UnsupportedCodecError
+	if !errors.As(err, &codecErr) || codecErr.Codec != "IMA ADPCM" || !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("Open = %v, want an unsupported IMA ADPCM error", err)
+	}
+}
+
+// A file cut off in the middle of a frame keeps the complete frames
+func TestWAVTruncated(t *testing.T) {
+	path := writeRawWAV(t, wavFormatPCM, 2, 8000, 2, []byte{0, 0x40, 0, 0xC0, 0, 0x20})
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Claim more data than the file holds
+	binary.LittleEndian.PutUint32(data[len(data)-10:], 1000)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	format, samples := readAll(t, path)
+	if format.Channels != 2 || len(samples) != 2 || samples[0] != 0.5 || samples[1] != -0.5 {
+		t.Errorf("samples = %v, want one stereo frame", samples)
+	}
+}
@@ -17,9 +17,12 @@ echo.
 echo Downloading dependencies...
 go mod tidy
 
+REM Shared sources compiled into every front-end
+set SOURCES=whisper.go resources.go engine.go fake_engine.go progress.go whisper_json.go languages.go prompt.go options.go speech.go chunk.go jobs.go checkpoint.go cache.go speakers.go channels.go config.go processors.go resegment.go hallucinations.go redact.go glossary.go clean.go
+
 echo.
 echo Building CLI version...
-go build -ldflags "-s -w" -o OfflineTranscribe-cli.exe cli.go whisper.go
+go build -ldflags "-s -w" -o OfflineTranscribe-cli.exe cli.go %SOURCES%
 if %ERRORLEVEL% NEQ 0 (
     echo Error: Failed to build CLI version
     pause
@@ -27,7 +30,7 @@ if %ERRORLEVEL% NEQ 0 (
 )
 
 echo Building web version...
-go build -ldflags "-s -w" -o OfflineTranscribe-web.exe web.go whisper.go
+go build -ldflags "-s -w" -o OfflineTranscribe-web.exe web.go %SOURCES%
 if %ERRORLEVEL% NEQ 0 (
     echo Error: Failed to build web version
     pause
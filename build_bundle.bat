@@ -26,9 +26,12 @@ echo.
 echo Step 2: Downloading dependencies...
 go mod tidy
 
+REM Shared sources compiled into every front-end
+set SOURCES=whisper.go resources.go engine.go fake_engine.go progress.go whisper_json.go languages.go prompt.go options.go speech.go chunk.go jobs.go checkpoint.go cache.go speakers.go channels.go config.go processors.go resegment.go hallucinations.go redact.go glossary.go clean.go
+
 echo.
 echo Step 3: Building self-contained CLI version...
-go build -ldflags "-s -w" -o OfflineTranscribe-Bundle-CLI.exe cli.go whisper.go resources.go
+go build -ldflags "-s -w" -o OfflineTranscribe-Bundle-CLI.exe cli.go %SOURCES%
 if %ERRORLEVEL% NEQ 0 (
     echo Error: Failed to build CLI version
     pause
@@ -36,7 +39,7 @@ if %ERRORLEVEL% NEQ 0 (
 )
 
 echo Building self-contained web version...
-go build -ldflags "-s -w" -o OfflineTranscribe-Bundle-Web.exe web.go whisper.go resources.go
+go build -ldflags "-s -w" -o OfflineTranscribe-Bundle-Web.exe web.go %SOURCES%
 if %ERRORLEVEL% NEQ 0 (
     echo Error: Failed to build web version
     pause
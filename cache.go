@@ -0,0 +1,367 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultCacheSize is the size the transcript cache is trimmed to when
+// OFFLINETRANSCRIBE_CACHE_SIZE is not set
+const defaultCacheSize = 1 << 30
+
+// cacheEntryName matches the file names of cache entries: a hex SHA-256
+// key. Other files in the directory are never listed or removed.
+var cacheEntryName = regexp.MustCompile(`^[0-9a-f]{64}\.json$`)
+
+// TranscriptCache keeps finished transcriptions keyed by the audio content,
+// the model file and the normalized options, so re-running the same
+// recording with the same settings skips whisper. Entries are evicted least
+// recently used first once the cache grows beyond its size limit. A nil
+// cache stores nothing.
+type TranscriptCache struct {
+	dir     string
+	maxSize int64
+
+	// Models are large and rarely change; their hashes are computed once
+	mu          sync.Mutex
+	modelHashes map[string]string
+}
+
+// CacheEntry describes a cached transcription
+type CacheEntry struct {
+	Key      string
+	Input    string
+	Model    string
+	Size     int64
+	LastUsed time.Time
+}
+
+// cacheFile is what is stored for each entry
+type cacheFile struct {
+	Input   string      `json:"input"`
+	Created time.Time   `json:"created"`
+	Result  cacheResult `json:"result"`
+}
+
+// cacheResult is the part of a transcription that depends only on the key;
+// options, audio details and the model path are filled in on every run
+type cacheResult struct {
+	Text                string     `json:"text"`
+	Segments            []Segment  `json:"segments"`
+	Language            string     `json:"language"`
+	LanguageProbability float64    `json:"languageProbability"`
+	Task                string     `json:"task"`
+	Model               ModelInfo  `json:"model"`
+	VAD                 *VADReport `json:"vad,omitempty"`
+}
+
+// DefaultCacheDir returns OFFLINETRANSCRIBE_CACHE_DIR if set, or a directory
+// in the user's cache directory
+func DefaultCacheDir() (string, error) {
+	if dir := os.Getenv("OFFLINETRANSCRIBE_CACHE_DIR"); dir != "" {
+		return dir, nil
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot locate a directory for the transcript cache: %v", err)
+	}
+	return filepath.Join(cacheDir, "OfflineTranscribe", "transcripts"), nil
+}
+
+// DefaultCacheSize returns the size limit from OFFLINETRANSCRIBE_CACHE_SIZE,
+// e.g. "500MB"; 0 or "off" disables the cache
+func DefaultCacheSize() (int64, error) {
+	value := strings.TrimSpace(os.Getenv("OFFLINETRANSCRIBE_CACHE_SIZE"))
+	switch strings.ToLower(value) {
+	case "":
+		return defaultCacheSize, nil
+	case "off":
+		return 0, nil
+	}
+	size, err := parseSize(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid OFFLINETRANSCRIBE_CACHE_SIZE: %v", err)
+	}
+	return size, nil
+}
+
+// parseSize parses a byte count with an optional KB, MB or GB suffix
+func parseSize(value string) (int64, error) {
+	units := []struct {
+		suffix string
+		scale  int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+
+	number, scale := strings.ToUpper(strings.TrimSpace(value)), int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(number, unit.suffix) {
+			number, scale = strings.TrimSpace(strings.TrimSuffix(number, unit.suffix)), unit.scale
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a size such as 500MB", value)
+	}
+	return int64(n * float64(scale)), nil
+}
+
+// OpenDefaultCache opens the cache in DefaultCacheDir with DefaultCacheSize.
+// It returns nil when the cache is disabled.
+func OpenDefaultCache() (*TranscriptCache, error) {
+	size, err := DefaultCacheSize()
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	dir, err := DefaultCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	return OpenCache(dir, size)
+}
+
+// OpenCache opens the cache directory, creating it if needed. Transcripts
+// are private, so the directory is only readable by the user.
+func OpenCache(dir string, maxSize int64) (*TranscriptCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %v", err)
+	}
+	return &TranscriptCache{
+		dir:         dir,
+		maxSize:     maxSize,
+		modelHashes: make(map[string]string),
+	}, nil
+}
+
+// Dir returns the cache directory
+func (c *TranscriptCache) Dir() string {
+	return c.dir
+}
+
+// MaxSize returns the size the cache is trimmed to
+func (c *TranscriptCache) MaxSize() int64 {
+	return c.maxSize
+}
+
+// Key identifies a transcription of inputFile with the model at modelPath
+// and the normalized opts. It returns "" when the cache is disabled or a
+// file cannot be read, in which case nothing is cached.
+func (c *TranscriptCache) Key(inputFile, modelPath string, opts TranscribeOptions) string {
+	if c == nil {
+		return ""
+	}
+	audioHash, err := hashFile(inputFile)
+	if err != nil {
+		return ""
+	}
+	modelHash, err := c.modelHash(modelPath)
+	if err != nil {
+		return ""
+	}
+
+	// Threads only change how fast whisper runs, not what it writes, and
+	// results are cached before the processors run. Of the workers, whose
+	// default depends on the CPUs, only whether the file may be chunked
+	// matters, and the chunk length only when it may.
+	opts.Threads = 0
+	opts.PostProcessing = nil
+	if opts.Workers >= 2 {
+		opts.Workers = 2
+	} else {
+		opts.Workers, opts.ChunkSeconds = 1, 0
+	}
+	options, err := json.Marshal(opts)
+	if err != nil {
+		return ""
+	}
+
+	key := sha256.New()
+	fmt.Fprintf(key, "audio %s\nmodel %s\noptions %s\n", audioHash, modelHash, options)
+	return hex.EncodeToString(key.Sum(nil))
+}
+
+// modelHash hashes a model file once per path, size and modification time
+func (c *TranscriptCache) modelHash(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	id := fmt.Sprintf("%s|%d|%d", path, info.Size(), info.ModTime().UnixNano())
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if hash, ok := c.modelHashes[id]; ok {
+		return hash, nil
+	}
+	hash, err := hashFile(path)
+	if err != nil {
+		return "", err
+	}
+	c.modelHashes[id] = hash
+	return hash, nil
+}
+
+// hashFile returns the hex SHA-256 of a file's content
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (c *TranscriptCache) path(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+// Get returns the cached transcription for key and marks it as recently used
+func (c *TranscriptCache) Get(key string) (*TranscriptionResult, bool) {
+	if c == nil || key == "" {
+		return nil, false
+	}
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+	var entry cacheFile
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false
+	}
+
+	now := time.Now()
+	os.Chtimes(c.path(key), now, now)
+	saved := entry.Result
+	return &TranscriptionResult{
+		Text:                saved.Text,
+		Segments:            saved.Segments,
+		Language:            saved.Language,
+		LanguageProbability: saved.LanguageProbability,
+		Task:                saved.Task,
+		Model:               saved.Model,
+		VAD:                 saved.VAD,
+	}, true
+}
+
+// Put stores a finished transcription under key and evicts the least
+// recently used entries if the cache has grown beyond its size limit
+func (c *TranscriptCache) Put(key, inputName string, result *TranscriptionResult) error {
+	if c == nil || key == "" {
+		return nil
+	}
+	model := result.Model
+	model.Path = ""
+	data, err := json.Marshal(cacheFile{
+		Input:   inputName,
+		Created: time.Now(),
+		Result: cacheResult{
+			Text:                result.Text,
+			Segments:            result.Segments,
+			Language:            result.Language,
+			LanguageProbability: result.LanguageProbability,
+			Task:                result.Task,
+			Model:               model,
+			VAD:                 result.VAD,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to cache transcript: %v", err)
+	}
+	if err := writeFileAtomic(c.path(key), data); err != nil {
+		return fmt.Errorf("failed to cache transcript: %v", err)
+	}
+	_, err = c.Prune(c.maxSize)
+	return err
+}
+
+// List returns the cached transcriptions, most recently used first. Only
+// files named like an entry are listed, so Prune and Clear leave anything
+// else in the directory alone.
+func (c *TranscriptCache) List() ([]CacheEntry, error) {
+	files, err := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cache: %v", err)
+	}
+
+	var entries []CacheEntry
+	for _, file := range files {
+		if !cacheEntryName.MatchString(filepath.Base(file)) {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		entry := CacheEntry{
+			Key:      strings.TrimSuffix(filepath.Base(file), ".json"),
+			Size:     info.Size(),
+			LastUsed: info.ModTime(),
+		}
+		// A corrupt entry is still listed so it can be pruned or cleared
+		if data, err := os.ReadFile(file); err == nil {
+			var saved cacheFile
+			if json.Unmarshal(data, &saved) == nil {
+				entry.Input = saved.Input
+				entry.Model = saved.Result.Model.Name
+			}
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsed.After(entries[j].LastUsed)
+	})
+	return entries, nil
+}
+
+// Prune removes the least recently used entries until the cache holds at
+// most maxSize bytes, and returns how many were removed
+func (c *TranscriptCache) Prune(maxSize int64) (int, error) {
+	entries, err := c.List()
+	if err != nil {
+		return 0, err
+	}
+
+	var size int64
+	for _, entry := range entries {
+		size += entry.Size
+	}
+	removed := 0
+	for i := len(entries) - 1; i >= 0 && size > maxSize; i-- {
+		if err := os.Remove(c.path(entries[i].Key)); err != nil && !os.IsNotExist(err) {
+			return removed, fmt.Errorf("failed to evict cache entry: %v", err)
+		}
+		size -= entries[i].Size
+		removed++
+	}
+	return removed, nil
+}
+
+// Clear removes every cached transcription and returns how many there were
+func (c *TranscriptCache) Clear() (int, error) {
+	entries, err := c.List()
+	if err != nil {
+		return 0, err
+	}
+	for i, entry := range entries {
+		if err := os.Remove(c.path(entry.Key)); err != nil && !os.IsNotExist(err) {
+			return i, fmt.Errorf("failed to clear cache: %v", err)
+		}
+	}
+	return len(entries), nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeCacheInputs writes an audio and a model file for cache keys
+func writeCacheInputs(t *testing.T) (audioFile, modelFile string) {
+	t.Helper()
+	dir := t.TempDir()
+	audioFile, modelFile = filepath.Join(dir, "talk.wav"), filepath.Join(dir, "model.bin")
+	if err := os.WriteFile(audioFile, []byte("audio"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(modelFile, []byte("model"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return audioFile, modelFile
+}
+
+func TestCacheKey(t *testing.T) {
+	cache, err := OpenCache(t.TempDir(), defaultCacheSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	audioFile, modelFile := writeCacheInputs(t)
+	opts := TranscribeOptions{Language: "en"}
+
+	key := cache.Key(audioFile, modelFile, opts)
+	if !cacheEntryName.MatchString(key + ".json") {
+		t.Fatalf("key %q is not a hex SHA-256", key)
+	}
+
+	faster := opts
+	faster.Threads = 8
+	faster.PostProcessing = []ProcessorConfig{{Name: "casing"}}
+	if cache.Key(audioFile, modelFile, faster) != key {
+		t.Error("threads or processors changed the key")
+	}
+	for _, workers := range []int{4, 16} {
+		chunked, otherCPUs := opts, opts
+		chunked.Workers, otherCPUs.Workers = 2, workers
+		if cache.Key(audioFile, modelFile, chunked) != cache.Key(audioFile, modelFile, otherCPUs) {
+			t.Errorf("%d workers changed the key", workers)
+		}
+	}
+	single, singleOtherChunks := opts, opts
+	single.Workers, singleOtherChunks.Workers, singleOtherChunks.ChunkSeconds = 1, 1, 60
+	if cache.Key(audioFile, modelFile, single) != cache.Key(audioFile, modelFile, singleOtherChunks) {
+		t.Error("the chunk length changed the key of a single pass")
+	}
+	chunked, otherChunks := opts, opts
+	chunked.Workers, otherChunks.Workers, otherChunks.ChunkSeconds = 4, 4, 60
+	if cache.Key(audioFile, modelFile, single) == cache.Key(audioFile, modelFile, chunked) ||
+		cache.Key(audioFile, modelFile, chunked) == cache.Key(audioFile, modelFile, otherChunks) {
+		t.Error("chunking or the chunk length kept the key")
+	}
+	translated := opts
+	translated.Task = TaskTranslate
+	if cache.Key(audioFile, modelFile, translated) == key {
+		t.Error("options that change the transcript kept the key")
+	}
+	if err := os.WriteFile(audioFile, []byte("other audio"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if cache.Key(audioFile, modelFile, opts) == key {
+		t.Error("other audio kept the key")
+	}
+	if cache.Key(filepath.Join(t.TempDir(), "missing.wav"), modelFile, opts) != "" {
+		t.Error("a missing file has a key")
+	}
+
+	var disabled *TranscriptCache
+	if disabled.Key(audioFile, modelFile, opts) != "" || disabled.Put("key", "talk.wav", &TranscriptionResult{}) != nil {
+		t.Error("a nil cache stores entries")
+	}
+}
+
+func TestCacheRoundTrip(t *testing.T) {
+	cache, err := OpenCache(t.TempDir(), defaultCacheSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	audioFile, modelFile := writeCacheInputs(t)
+	key := cache.Key(audioFile, modelFile, TranscribeOptions{})
+	result := &TranscriptionResult{Text: "Hello.", Language: "en", Segments: []Segment{{Start: 0, End: 1, Text: "Hello."}},
+		Model: ModelInfo{Name: "base", Path: "/models/base.bin"}}
+	if err := cache.Put(key, "talk.wav", result); err != nil {
+		t.Fatal(err)
+	}
+
+	cached, ok := cache.Get(key)
+	if !ok || cached.Text != "Hello." || len(cached.Segments) != 1 || cached.Model.Name != "base" {
+		t.Fatalf("Get = %+v, %v", cached, ok)
+	}
+	if cached.Model.Path != "" {
+		t.Errorf("the model path %q was cached", cached.Model.Path)
+	}
+	entries, err := cache.List()
+	if err != nil || len(entries) != 1 || entries[0].Input != "talk.wav" || entries[0].Model != "base" {
+		t.Errorf("List = %+v, %v", entries, err)
+	}
+}
+
+// Files in the cache directory that are not entries are never listed or
+// removed, since the directory may be one the user chose
+func TestCacheIgnoresOtherFiles(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := OpenCache(dir, defaultCacheSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	others := []string{"settings.json", "abc.json", strings.Repeat("A", 64) + ".json", strings.Repeat("a", 64) + ".txt"}
+	for _, name := range others {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	key := strings.Repeat("0123456789abcdef", 4)
+	if err := cache.Put(key, "talk.wav", &TranscriptionResult{Text: "Hello."}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := cache.List()
+	if err != nil || len(entries) != 1 || entries[0].Key != key {
+		t.Fatalf("List = %+v, %v", entries, err)
+	}
+	if removed, err := cache.Clear(); err != nil || removed != 1 {
+		t.Errorf("Clear = %d, %v", removed, err)
+	}
+	for _, name := range others {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s was removed", name)
+		}
+	}
+}
+
+func TestCachePruneEvictsLeastRecentlyUsed(t *testing.T) {
+	cache, err := OpenCache(t.TempDir(), defaultCacheSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, recent := strings.Repeat("a", 64), strings.Repeat("b", 64)
+	for _, key := range []string{old, recent} {
+		if err := cache.Put(key, key[:1], &TranscriptionResult{Text: "Hello."}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(cache.path(old), past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, _ := cache.List()
+	removed, err := cache.Prune(entries[0].Size)
+	if err != nil || removed != 1 {
+		t.Fatalf("Prune = %d, %v", removed, err)
+	}
+	if _, ok := cache.Get(old); ok {
+		t.Error("the least recently used entry was kept")
+	}
+	if _, ok := cache.Get(recent); !ok {
+		t.Error("the most recently used entry was evicted")
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for value, want := range map[string]int64{"500MB": 500 << 20, "1.5GB": 3 << 29, "2kb": 2048, "100": 100} {
+		if got, err := parseSize(value); err != nil || got != want {
+			t.Errorf("parseSize(%q) = %d, %v, want %d", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"", "lots", "-1MB"} {
+		if _, err := parseSize(value); err == nil {
+			t.Errorf("parseSize(%q) accepted", value)
+		}
+	}
+}
+
+func TestNewEngineWithoutCache(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The cache directory cannot be created under a file
+	t.Setenv("OFFLINETRANSCRIBE_CACHE_DIR", filepath.Join(file, "cache"))
+	engine, err := NewEngine(EngineConfig{Backend: EngineWhisperCLI}, &ResourceManager{})
+	if err != nil {
+		t.Fatalf("NewEngine failed without a cache: %v", err)
+	}
+	if transcriber, ok := engine.(*WhisperTranscriber); !ok || transcriber.cache != nil {
+		t.Errorf("engine = %#v, want a whisper transcriber without a cache", engine)
+	}
+}
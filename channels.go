@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"localtts/vad"
+)
+
+// channelSpeaker names the speaker recorded on a channel, counting from 0
+func channelSpeaker(channel int) string {
+	return fmt.Sprintf("CHANNEL_%d", channel+1)
+}
+
+// transcribeChannels transcribes every channel of a recording on its own,
+// e.g. the agent and customer of a call, and merges the segments into one
+// time-ordered transcript labeled by channel. Channels are transcribed one
+// after another; each may still be split into parallel chunks.
+func (run whisperRun) transcribeChannels(ctx context.Context, inputFile, jobDir string, channels int) (*TranscriptionResult, error) {
+	if channels < 2 {
+		return nil, fmt.Errorf("cannot split channels of %s: it has only one channel", filepath.Base(inputFile))
+	}
+
+	start := time.Now()
+	results := make([]*TranscriptionResult, channels)
+	for channel := 0; channel < channels; channel++ {
+		channelRun := run
+		if run.opts.CheckpointDir != "" {
+			channelRun.opts.CheckpointDir = filepath.Join(run.opts.CheckpointDir, fmt.Sprintf("channel-%d", channel+1))
+		}
+		if onProgress := run.opts.Progress; onProgress != nil {
+			done := float64(channel)
+			channelRun.opts.Progress = func(p Progress) {
+				onProgress(newProgress((done*100+p.Percent)/float64(channels), start))
+			}
+		}
+
+		result, err := channelRun.transcribeAudio(ctx, inputFile, jobDir, channel)
+		if err != nil {
+			return nil, fmt.Errorf("channel %d: %w", channel+1, err)
+		}
+		results[channel] = result
+	}
+	return mergeChannels(results), nil
+}
+
+// mergeChannels interleaves the segments of each channel's result by start
+// time. The language is the one spoken for longest across the channels.
+func mergeChannels(results []*TranscriptionResult) *TranscriptionResult {
+	merged := &TranscriptionResult{}
+	seconds := make(map[string]float64)
+	probability := make(map[string]float64)
+	var reports []*VADReport
+
+	for channel, result := range results {
+		for _, segment := range result.Segments {
+			segment.Channel = channel + 1
+			segment.Speaker = channelSpeaker(channel)
+			merged.Segments = append(merged.Segments, segment)
+		}
+		if merged.Model.Type == "" {
+			merged.Model = result.Model
+		}
+		if result.VAD != nil {
+			reports = append(reports, result.VAD)
+		}
+
+		if result.Language == "" {
+			continue
+		}
+		var speech float64
+		for _, segment := range result.Segments {
+			speech += segment.End - segment.Start
+		}
+		seconds[result.Language] += speech
+		probability[result.Language] += result.LanguageProbability * speech
+	}
+
+	sort.SliceStable(merged.Segments, func(i, j int) bool {
+		return merged.Segments[i].Start < merged.Segments[j].Start
+	})
+	merged.Text = segmentsText(merged.Segments)
+	merged.VAD = mergeVADReports(reports)
+
+	var longest float64
+	for language, speech := range seconds {
+		if speech > longest || merged.Language == "" {
+			merged.Language, longest = language, speech
+		}
+	}
+	if longest > 0 {
+		merged.LanguageProbability = probability[merged.Language] / longest
+	}
+	return merged
+}
+
+// mergeVADReports combines the speech regions found on each channel: a
+// moment counts as speech when anyone is speaking
+func mergeVADReports(reports []*VADReport) *VADReport {
+	if len(reports) == 0 {
+		return nil
+	}
+
+	merged := &VADReport{}
+	var regions []vad.Region
+	for _, report := range reports {
+		regions = append(regions, report.Regions...)
+		merged.TotalSeconds = math.Max(merged.TotalSeconds, report.TotalSeconds)
+	}
+	sort.Slice(regions, func(i, j int) bool {
+		return regions[i].Start < regions[j].Start
+	})
+
+	merged.Regions = []vad.Region{}
+	for _, region := range regions {
+		if n := len(merged.Regions); n > 0 && region.Start <= merged.Regions[n-1].End {
+			merged.Regions[n-1].End = math.Max(merged.Regions[n-1].End, region.End)
+			continue
+		}
+		merged.Regions = append(merged.Regions, region)
+	}
+	for _, region := range merged.Regions {
+		merged.SpeechSeconds += region.Duration()
+	}
+	merged.SpeechSeconds = math.Round(merged.SpeechSeconds*1000) / 1000
+	return merged
+}
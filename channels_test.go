@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"localtts/audio"
+	"localtts/vad"
+)
+
+func TestMergeChannels(t *testing.T) {
+	agent := &TranscriptionResult{
+		Language:            "en",
+		LanguageProbability: 0.9,
+		Model:               ModelInfo{Type: "base"},
+		Segments: []Segment{
+			{Start: 0, End: 2, Text: "Thanks for calling."},
+			{Start: 5, End: 6, Text: "Sure."},
+			{Start: 9, End: 12, Text: "Anything else?"},
+		},
+		VAD: &VADReport{TotalSeconds: 12, Regions: []vad.Region{{Start: 0, End: 6}, {Start: 9, End: 12}}},
+	}
+	customer := &TranscriptionResult{
+		Language:            "en",
+		LanguageProbability: 0.6,
+		Segments: []Segment{
+			{Start: 2.5, End: 4.5, Text: "Can you help me?"},
+			{Start: 5, End: 8, Text: "My card was blocked."},
+		},
+		VAD: &VADReport{TotalSeconds: 12, Regions: []vad.Region{{Start: 2, End: 8}}},
+	}
+
+	merged := mergeChannels([]*TranscriptionResult{agent, customer})
+	want := []struct {
+		text    string
+		channel int
+	}{
+		{"Thanks for calling.", 1},
+		{"Can you help me?", 2},
+		{"Sure.", 1},
+		{"My card was blocked.", 2},
+		{"Anything else?", 1},
+	}
+	if len(merged.Segments) != len(want) {
+		t.Fatalf("segments = %+v", merged.Segments)
+	}
+	for i, segment := range merged.Segments {
+		if segment.Text != want[i].text || segment.Channel != want[i].channel || segment.Speaker != channelSpeaker(want[i].channel-1) {
+			t.Errorf("segment %d = %q on channel %d as %s, want %q on channel %d", i, segment.Text, segment.Channel, segment.Speaker, want[i].text, want[i].channel)
+		}
+	}
+	if merged.Text != "Thanks for calling. Can you help me? Sure. My card was blocked. Anything else?" {
+		t.Errorf("text = %q", merged.Text)
+	}
+
+	// 6s of agent speech at 0.9 and 5s of customer speech at 0.6
+	if merged.Language != "en" || math.Abs(merged.LanguageProbability-(6*0.9+5*0.6)/11) > 1e-9 || merged.Model.Type != "base" {
+		t.Errorf("language = %s (%v), model = %+v", merged.Language, merged.LanguageProbability, merged.Model)
+	}
+	if merged.VAD == nil || len(merged.VAD.Regions) != 2 || merged.VAD.Regions[0] != (vad.Region{Start: 0, End: 8}) || merged.VAD.SpeechSeconds != 11 {
+		t.Errorf("VAD = %+v", merged.VAD)
+	}
+
+	// The channels' own results are left as they were
+	if agent.Segments[0].Channel != 0 || agent.Segments[0].Speaker != "" {
+		t.Errorf("channel result changed: %+v", agent.Segments[0])
+	}
+}
+
+// writeTwoChannelWAV writes a stereo recording with a tone on each channel
+func writeTwoChannelWAV(t *testing.T, seconds float64) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "call.wav")
+	w, err := audio.CreateWAV(path, audio.WhisperSampleRate, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := make([]float32, 2*int(seconds*audio.WhisperSampleRate))
+	for i := range samples {
+		samples[i] = float32(0.3 * math.Sin(2*math.Pi*200*float64(i/2)/audio.WhisperSampleRate))
+	}
+	if err := w.Write(samples); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Each channel is transcribed on its own and labeled with its channel
+func TestTranscribeSplitChannels(t *testing.T) {
+	wt, _ := newStubTranscriber(t, `n=$(ls "$dir"/run-* 2>/dev/null | wc -l)
+touch "$dir/run-$n"
+if [ "$n" -eq 0 ]; then
+	printf '1\n00:00:00,000 --> 00:00:02,000\n Hello.\n\n2\n00:00:04,000 --> 00:00:05,000\n Bye.\n' > "$of.srt"
+else
+	printf '1\n00:00:02,000 --> 00:00:03,000\n Hi there.\n' > "$of.srt"
+fi
+`)
+	result, err := wt.TranscribeContext(context.Background(), writeTwoChannelWAV(t, 6), TranscribeOptions{SplitChannels: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var labels []string
+	for _, segment := range result.Segments {
+		labels = append(labels, segment.Speaker+":"+segment.Text)
+	}
+	if got := strings.Join(labels, "|"); got != "CHANNEL_1:Hello.|CHANNEL_2:Hi there.|CHANNEL_1:Bye." {
+		t.Errorf("segments = %s", got)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// checkpoint persists the results of a job's whisper runs, one file per
+// chunk, so an interrupted transcription resumes where it stopped. A nil
+// checkpoint stores nothing.
+type checkpoint struct {
+	dir string
+}
+
+// checkpointPlan identifies the work the saved results belong to
+type checkpointPlan struct {
+	// Key hashes the model, the options and the audio whisper hears
+	Key    string  `json:"key"`
+	Chunks []chunk `json:"chunks"`
+}
+
+// checkpointResult is the part of a whisper run's result that is saved
+type checkpointResult struct {
+	Text                string    `json:"text"`
+	Segments            []Segment `json:"segments"`
+	Language            string    `json:"language"`
+	LanguageProbability float64   `json:"languageProbability"`
+	Model               ModelInfo `json:"model"`
+}
+
+// openCheckpoint prepares dir for transcribing input with the model at
+// modelPath, opts and the given chunk plan, which is empty for a single
+// pass. Results saved for a different model, options, audio or plan are
+// discarded, as they would not stitch into the same transcript.
+func openCheckpoint(dir, input, modelPath string, opts TranscribeOptions, chunks []chunk) (*checkpoint, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create checkpoint directory: %v", err)
+	}
+
+	key, err := checkpointKey(input, modelPath, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save checkpoint plan: %v", err)
+	}
+	plan, err := json.Marshal(checkpointPlan{Key: key, Chunks: chunks})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save checkpoint plan: %v", err)
+	}
+	planFile := filepath.Join(dir, "plan.json")
+	if saved, err := os.ReadFile(planFile); err == nil && bytes.Equal(saved, plan) {
+		return &checkpoint{dir: dir}, nil
+	}
+
+	// Start over: remove stale results before recording the new plan
+	stale, _ := filepath.Glob(filepath.Join(dir, "*.result.json"))
+	for _, file := range stale {
+		os.Remove(file)
+	}
+	if err := writeFileAtomic(planFile, plan); err != nil {
+		return nil, fmt.Errorf("failed to save checkpoint plan: %v", err)
+	}
+	return &checkpoint{dir: dir}, nil
+}
+
+// checkpointKey hashes what decides whisper's output: the model file, by
+// path, size and modification time, the options and the decoded audio.
+// Threads do not change the output, and workers and the chunk length only
+// through the chunk plan, which is compared on its own.
+func checkpointKey(input, modelPath string, opts TranscribeOptions) (string, error) {
+	audioHash, err := hashFile(input)
+	if err != nil {
+		return "", err
+	}
+	model, err := os.Stat(modelPath)
+	if err != nil {
+		return "", err
+	}
+
+	opts.Threads = 0
+	opts.PostProcessing = nil
+	opts.Workers, opts.ChunkSeconds = 0, 0
+	options, err := json.Marshal(opts)
+	if err != nil {
+		return "", err
+	}
+
+	key := sha256.New()
+	fmt.Fprintf(key, "audio %s\nmodel %s %d %d\noptions %s\n", audioHash, modelPath, model.Size(), model.ModTime().UnixNano(), options)
+	return hex.EncodeToString(key.Sum(nil)), nil
+}
+
+// checkpointProgress counts the saved results in dir against the plan.
+// Channels transcribed separately each have a plan in a subdirectory; they
+// count once their plan exists.
+func checkpointProgress(dir string) (done, total int) {
+	data, err := os.ReadFile(filepath.Join(dir, "plan.json"))
+	if os.IsNotExist(err) {
+		channels, _ := filepath.Glob(filepath.Join(dir, "channel-*"))
+		for _, channel := range channels {
+			channelDone, channelTotal := checkpointProgress(channel)
+			done += channelDone
+			total += channelTotal
+		}
+		return done, total
+	}
+	if err != nil {
+		return 0, 0
+	}
+	var plan checkpointPlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return 0, 0
+	}
+
+	// A plan without chunks is a single pass
+	total = len(plan.Chunks)
+	if total == 0 {
+		total = 1
+	}
+	saved, _ := filepath.Glob(filepath.Join(dir, "*.result.json"))
+	return len(saved), total
+}
+
+func (c *checkpoint) path(name string) string {
+	return filepath.Join(c.dir, name+".result.json")
+}
+
+// load returns the saved result of the named run, if there is one
+func (c *checkpoint) load(name string) (*TranscriptionResult, bool) {
+	if c == nil {
+		return nil, false
+	}
+	data, err := os.ReadFile(c.path(name))
+	if err != nil {
+		return nil, false
+	}
+
+	var saved checkpointResult
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, false
+	}
+	return &TranscriptionResult{
+		Text:                saved.Text,
+		Segments:            saved.Segments,
+		Language:            saved.Language,
+		LanguageProbability: saved.LanguageProbability,
+		Model:               saved.Model,
+	}, true
+}
+
+// save records the result of the named run
+func (c *checkpoint) save(name string, result *TranscriptionResult) error {
+	if c == nil {
+		return nil
+	}
+	data, err := json.Marshal(checkpointResult{
+		Text:                result.Text,
+		Segments:            result.Segments,
+		Language:            result.Language,
+		LanguageProbability: result.LanguageProbability,
+		Model:               result.Model,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save checkpoint: %v", err)
+	}
+	if err := writeFileAtomic(c.path(name), data); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// chunkedStub is a whisper-cli that logs each run and writes two segments
+// naming its chunk; with $dir/interrupt present the second chunk fails
+const chunkedStub = `name=$(basename "$of")
+echo "$name" >> "$dir/runs"
+if [ "$name" = chunk-001 ] && [ -e "$dir/interrupt" ]; then sleep 0.5; exit 1; fi
+printf '1\n00:00:05,000 --> 00:00:09,000\n First part of %s.\n\n2\n00:00:20,000 --> 00:00:24,000\n Second part of %s.\n' "$name" "$name" > "$of.srt"
+`
+
+// takeRuns returns the chunks whisper ran on since the last call
+func takeRuns(t *testing.T, dir string) []string {
+	t.Helper()
+	data, _ := os.ReadFile(filepath.Join(dir, "runs"))
+	os.Remove(filepath.Join(dir, "runs"))
+	return strings.Fields(string(data))
+}
+
+// An interrupted job resumes from its saved chunks and gives the same
+// transcript as a job that was never interrupted
+func TestCheckpointResumesInterruptedJob(t *testing.T) {
+	wt, dir := newStubTranscriber(t, chunkedStub)
+	input := writeSpeechWAV(t, 70, 0, 70)
+	opts := TranscribeOptions{Workers: 2, ChunkSeconds: 30}
+
+	opts.CheckpointDir = filepath.Join(t.TempDir(), "uninterrupted")
+	want, err := wt.TranscribeContext(context.Background(), input, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runs := takeRuns(t, dir); len(runs) != 2 || !strings.Contains(want.Text, "chunk-001") {
+		t.Fatalf("runs = %v, text = %q", runs, want.Text)
+	}
+
+	opts.CheckpointDir = filepath.Join(t.TempDir(), "checkpoint")
+	if err := os.WriteFile(filepath.Join(dir, "interrupt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wt.TranscribeContext(context.Background(), input, opts); err == nil || errors.Is(err, ErrTranscriptionCanceled) {
+		t.Fatalf("interrupted job = %v, want the chunk's failure", err)
+	}
+	takeRuns(t, dir)
+	if done, total := checkpointProgress(opts.CheckpointDir); done != 1 || total != 2 {
+		t.Fatalf("checkpoint progress = %d of %d, want 1 of 2", done, total)
+	}
+
+	os.Remove(filepath.Join(dir, "interrupt"))
+	got, err := wt.TranscribeContext(context.Background(), input, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runs := takeRuns(t, dir); !reflect.DeepEqual(runs, []string{"chunk-001"}) {
+		t.Errorf("resumed job ran %v, want only the unfinished chunk", runs)
+	}
+	if got.Text != want.Text || !reflect.DeepEqual(got.Segments, want.Segments) {
+		t.Errorf("resumed transcript = %q, want %q", got.Text, want.Text)
+	}
+}
+
+// Saved results are discarded when the options change, even for a single
+// pass whose plan has no chunks
+func TestCheckpointDiscardsResultsForOtherOptions(t *testing.T) {
+	wt, dir := newStubTranscriber(t, chunkedStub)
+	input := writeSpeechWAV(t, 10, 0, 10)
+	opts := TranscribeOptions{Workers: 1, CheckpointDir: t.TempDir()}
+
+	for _, test := range []struct {
+		prompt string
+		runs   int
+	}{
+		{"", 1},
+		{"", 0},
+		{"A product meeting.", 1},
+		{"A product meeting.", 0},
+	} {
+		opts.Prompt = test.prompt
+		if _, err := wt.TranscribeContext(context.Background(), input, opts); err != nil {
+			t.Fatal(err)
+		}
+		if runs := takeRuns(t, dir); len(runs) != test.runs {
+			t.Errorf("prompt %q: whisper ran %d time(s), want %d", test.prompt, len(runs), test.runs)
+		}
+	}
+
+	// The thread count does not change the transcript
+	opts.Threads = 1
+	if _, err := wt.TranscribeContext(context.Background(), input, opts); err != nil {
+		t.Fatal(err)
+	}
+	if runs := takeRuns(t, dir); len(runs) != 0 {
+		t.Errorf("whisper ran again for another thread count: %v", runs)
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"localtts/audio"
+	"localtts/vad"
+)
+
+// chunkOverlap is how much audio each chunk shares with its neighbours, so
+// words at a cut are heard whole by at least one whisper process
+const chunkOverlap = 3.0
+
+// chunk is one piece of a long recording, in seconds. Whisper hears Start
+// to End; the chunk owns the segments whose midpoint falls between KeepStart
+// and KeepEnd, or after KeepStart for the last chunk.
+type chunk struct {
+	Start     float64 `json:"start"`
+	End       float64 `json:"end"`
+	KeepStart float64 `json:"keepStart"`
+	KeepEnd   float64 `json:"keepEnd"`
+}
+
+// planChunks decides how to split the 16 kHz mono WAV at path. It returns
+// nil when the file is short enough, or there is only one worker, to be
+// transcribed in a single pass. Cuts are placed at the quietest point near
+// each multiple of opts.ChunkSeconds so they fall in pauses.
+func planChunks(path string, opts TranscribeOptions) ([]chunk, error) {
+	chunkSeconds := float64(opts.ChunkSeconds)
+	if opts.Workers < 2 {
+		return nil, nil
+	}
+
+	decoder, err := audio.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer decoder.Close()
+	format := decoder.Format()
+	if float64(decoder.Frames()) < 1.5*chunkSeconds*float64(format.SampleRate) {
+		return nil, nil
+	}
+
+	// Measure the energy of the whole file to find the pauses
+	meter := vad.NewMeter(format.SampleRate, vad.DefaultConfig().FrameSize)
+	samples := make([]float32, 8192)
+	for {
+		n, err := decoder.Read(samples)
+		meter.Write(samples[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read decoded audio: %v", err)
+		}
+	}
+	total := meter.Duration()
+
+	// Search for a pause within a tenth of a chunk of each target cut; the
+	// last chunk ends up between half and one and a half chunks long
+	search := chunkSeconds / 10
+	cuts := []float64{0}
+	for total-cuts[len(cuts)-1] > 1.5*chunkSeconds {
+		target := cuts[len(cuts)-1] + chunkSeconds
+		cuts = append(cuts, meter.Quietest(target-search, target+search))
+	}
+	cuts = append(cuts, total)
+
+	chunks := make([]chunk, len(cuts)-1)
+	for i := range chunks {
+		chunks[i] = chunk{
+			Start:     math.Max(0, cuts[i]-chunkOverlap),
+			End:       math.Min(total, cuts[i+1]+chunkOverlap),
+			KeepStart: cuts[i],
+			KeepEnd:   cuts[i+1],
+		}
+	}
+	return chunks, nil
+}
+
+// transcribeChunks transcribes the chunks of input with a bounded pool of
+// whisper processes and stitches the results into one transcript. The first
+// failure stops the remaining chunks.
+func (run whisperRun) transcribeChunks(ctx context.Context, input, jobDir string, chunks []chunk) (*TranscriptionResult, error) {
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	progress := newChunkProgress(chunks, run.opts.Progress)
+	results := make([]*TranscriptionResult, len(chunks))
+	errs := make([]error, len(chunks))
+
+	jobs := make(chan int)
+	workers := run.opts.Workers
+	if workers > len(chunks) {
+		workers = len(chunks)
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i], errs[i] = run.transcribeChunk(ctx, input, jobDir, i, chunks[i], progress)
+				if errs[i] != nil {
+					cancel()
+				}
+			}
+		}()
+	}
+
+feed:
+	for i := range chunks {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	// Report the failure that stopped the job rather than the cancellations
+	// it caused in the other chunks
+	if parent.Err() != nil {
+		return nil, canceledError(parent)
+	}
+	for i, err := range errs {
+		if err != nil && !errors.Is(err, ErrTranscriptionCanceled) {
+			return nil, fmt.Errorf("chunk %d of %d (%s-%s): %w", i+1, len(chunks),
+				formatTimestampMillis(chunks[i].Start), formatTimestampMillis(chunks[i].End), err)
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return stitchChunks(chunks, results), nil
+}
+
+// transcribeChunk extracts one chunk to its own WAV file and transcribes it,
+// shifting the timestamps onto the full recording's timeline
+func (run whisperRun) transcribeChunk(ctx context.Context, input, jobDir string, index int, c chunk, progress *chunkProgress) (*TranscriptionResult, error) {
+	name := fmt.Sprintf("chunk-%03d", index)
+	if result, ok := run.checkpoint.load(name); ok {
+		if progress != nil {
+			progress.update(index, 100)
+		}
+		return result, nil
+	}
+
+	chunkFile := filepath.Join(jobDir, name+".wav")
+	rate := float64(audio.WhisperSampleRate)
+	if err := audio.ExtractWAV(input, chunkFile, int64(c.Start*rate), int64(c.End*rate)); err != nil {
+		return nil, err
+	}
+	defer os.Remove(chunkFile)
+
+	var onProgress ProgressFunc
+	if progress != nil {
+		onProgress = func(p Progress) {
+			progress.update(index, p.Percent)
+		}
+	}
+	result, err := run.transcribe(ctx, chunkFile, filepath.Join(jobDir, name), onProgress)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range result.Segments {
+		shiftSegment(&result.Segments[i], c.Start)
+	}
+	if err := run.checkpoint.save(name, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// shiftSegment moves a segment and its words and tokens by offset seconds
+func shiftSegment(segment *Segment, offset float64) {
+	segment.Start += offset
+	segment.End += offset
+	for i := range segment.Words {
+		segment.Words[i].Start += offset
+		segment.Words[i].End += offset
+	}
+	for i := range segment.Tokens {
+		segment.Tokens[i].Start += offset
+		segment.Tokens[i].End += offset
+	}
+}
+
+// stitchChunks joins chunk results in order. Each chunk contributes the
+// segments centred in the part it owns, and a segment repeating the one
+// before it across the overlap is dropped.
+func stitchChunks(chunks []chunk, results []*TranscriptionResult) *TranscriptionResult {
+	stitched := &TranscriptionResult{Model: results[0].Model}
+
+	var segments []Segment
+	for i, c := range chunks {
+		for _, segment := range results[i].Segments {
+			middle := (segment.Start + segment.End) / 2
+			last := i == len(chunks)-1
+			if middle < c.KeepStart || (!last && middle >= c.KeepEnd) {
+				continue
+			}
+			if n := len(segments); n > 0 && segment.Start < segments[n-1].End {
+				if sameText(segment.Text, segments[n-1].Text) {
+					continue
+				}
+				// Keep timestamps in order where overlapping chunks disagree
+				segment.Start = math.Min(segments[n-1].End, segment.End)
+			}
+			segments = append(segments, segment)
+		}
+	}
+	stitched.Segments = segments
+	stitched.Text = segmentsText(segments)
+	stitched.Language, stitched.LanguageProbability = chunkLanguage(chunks, results)
+	return stitched
+}
+
+// sameText reports whether two segment texts are equal, or one contains
+// the other, ignoring case, punctuation and spacing
+func sameText(a, b string) bool {
+	normalize := func(text string) string {
+		return strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return unicode.ToLower(r)
+			}
+			return -1
+		}, text)
+	}
+	a, b = normalize(a), normalize(b)
+	if a == "" || b == "" {
+		return a == b
+	}
+	return strings.Contains(a, b) || strings.Contains(b, a)
+}
+
+// chunkLanguage picks the language detected for most of the audio and its
+// average probability over those chunks
+func chunkLanguage(chunks []chunk, results []*TranscriptionResult) (string, float64) {
+	seconds := map[string]float64{}
+	probability := map[string]float64{}
+	for i, result := range results {
+		if result.Language == "" {
+			continue
+		}
+		length := chunks[i].End - chunks[i].Start
+		seconds[result.Language] += length
+		probability[result.Language] += result.LanguageProbability * length
+	}
+
+	best := ""
+	for language, total := range seconds {
+		if best == "" || total > seconds[best] || (total == seconds[best] && language < best) {
+			best = language
+		}
+	}
+	if best == "" {
+		return "", 0
+	}
+	return best, probability[best] / seconds[best]
+}
+
+// chunkProgress combines the progress of concurrently running chunks into
+// one report weighted by chunk length
+type chunkProgress struct {
+	mu         sync.Mutex
+	start      time.Time
+	weights    []float64
+	percents   []float64
+	last       float64
+	onProgress ProgressFunc
+}
+
+// newChunkProgress returns nil when no progress was requested
+func newChunkProgress(chunks []chunk, onProgress ProgressFunc) *chunkProgress {
+	if onProgress == nil {
+		return nil
+	}
+
+	var total float64
+	for _, c := range chunks {
+		total += c.End - c.Start
+	}
+	weights := make([]float64, len(chunks))
+	for i, c := range chunks {
+		weights[i] = (c.End - c.Start) / total
+	}
+	return &chunkProgress{
+		start:      time.Now(),
+		weights:    weights,
+		percents:   make([]float64, len(chunks)),
+		onProgress: onProgress,
+	}
+}
+
+// update records a chunk's progress. Reports are serialized so callers
+// such as the web progress stream never see concurrent calls.
+func (cp *chunkProgress) update(index int, percent float64) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	cp.percents[index] = percent
+	var total float64
+	for i, p := range cp.percents {
+		total += p * cp.weights[i]
+	}
+	total = math.Min(total, 100)
+	if total > cp.last {
+		cp.last = total
+		cp.onProgress(newProgress(total, cp.start))
+	}
+}
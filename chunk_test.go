@@ -0,0 +1,129 @@
+package main
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+
+	"localtts/audio"
+)
+
+func TestPlanChunksCutsInPauses(t *testing.T) {
+	// 75 seconds of tone with pauses at 27-28s and 58-59s
+	samples := make([]float32, 75*audio.WhisperSampleRate)
+	for i := range samples {
+		seconds := float64(i) / audio.WhisperSampleRate
+		if (seconds >= 27 && seconds < 28) || (seconds >= 58 && seconds < 59) {
+			continue
+		}
+		samples[i] = float32(0.3 * math.Sin(2*math.Pi*200*seconds))
+	}
+	path := filepath.Join(t.TempDir(), "long.wav")
+	if err := audio.WriteWAV(path, samples, audio.WhisperSampleRate); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := TranscribeOptions{ChunkSeconds: 30, Workers: 2}
+	chunks, err := planChunks(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 3 {
+		t.Fatalf("chunks = %+v, want 3", chunks)
+	}
+	for i, pause := range []float64{27, 58} {
+		cut := chunks[i].KeepEnd
+		if cut < pause || cut > pause+1 || chunks[i+1].KeepStart != cut {
+			t.Errorf("cut %d at %v, want it in the pause at %vs", i, cut, pause)
+		}
+		if chunks[i].End != cut+chunkOverlap || chunks[i+1].Start != cut-chunkOverlap {
+			t.Errorf("chunks %+v and %+v do not overlap by %vs", chunks[i], chunks[i+1], chunkOverlap)
+		}
+	}
+	if chunks[0].Start != 0 || chunks[2].End != 75 || chunks[2].KeepEnd != 75 {
+		t.Errorf("chunks = %+v, want them to cover the whole file", chunks)
+	}
+
+	// One worker, or a short file, is transcribed in one pass
+	if chunks, err := planChunks(path, TranscribeOptions{ChunkSeconds: 30, Workers: 1}); chunks != nil || err != nil {
+		t.Errorf("one worker: chunks = %+v, %v", chunks, err)
+	}
+	if chunks, err := planChunks(path, TranscribeOptions{ChunkSeconds: 60, Workers: 2}); chunks != nil || err != nil {
+		t.Errorf("short file: chunks = %+v, %v", chunks, err)
+	}
+}
+
+func TestStitchChunks(t *testing.T) {
+	chunks := []chunk{
+		{Start: 0, End: 13, KeepStart: 0, KeepEnd: 10},
+		{Start: 7, End: 20, KeepStart: 10, KeepEnd: 20},
+	}
+	results := []*TranscriptionResult{
+		{Model: ModelInfo{Name: "base"}, Language: "en", LanguageProbability: 0.9, Segments: []Segment{
+			{Start: 0, End: 4, Text: "First part."},
+			{Start: 4, End: 9.8, Text: "Across the cut."},
+			{Start: 10.5, End: 13, Text: "Beyond what it owns."},
+		}},
+		{Language: "en", LanguageProbability: 0.5, Segments: []Segment{
+			{Start: 7, End: 9, Text: "Heard again before the cut."},
+			{Start: 9.6, End: 12, Text: "across the cut"},
+			{Start: 9.7, End: 15, Text: "A different sentence."},
+			{Start: 15, End: 20, Text: "The end."},
+		}},
+	}
+
+	stitched := stitchChunks(chunks, results)
+	want := []string{"First part.", "Across the cut.", "A different sentence.", "The end."}
+	if got := sentenceTexts(stitched.Segments); len(got) != len(want) {
+		t.Fatalf("segments = %q, want %q", got, want)
+	}
+	for i, segment := range stitched.Segments {
+		if segment.Text != want[i] {
+			t.Errorf("segment %d = %q, want %q", i, segment.Text, want[i])
+		}
+	}
+	// The overlapping segment starts where the one before it ends
+	if stitched.Segments[2].Start != 9.8 {
+		t.Errorf("segment 2 starts at %v, want 9.8", stitched.Segments[2].Start)
+	}
+	if stitched.Model.Name != "base" || stitched.Text != "First part. Across the cut. A different sentence. The end." {
+		t.Errorf("stitched = %+v", stitched)
+	}
+	// Weighted by chunk length: (0.9*13 + 0.5*13) / 26
+	if stitched.Language != "en" || math.Abs(stitched.LanguageProbability-0.7) > 1e-9 {
+		t.Errorf("language = %s at %v", stitched.Language, stitched.LanguageProbability)
+	}
+}
+
+func TestChunkLanguage(t *testing.T) {
+	chunks := []chunk{{Start: 0, End: 10}, {Start: 10, End: 40}, {Start: 40, End: 50}}
+	results := []*TranscriptionResult{
+		{Language: "en", LanguageProbability: 0.8},
+		{Language: "de", LanguageProbability: 0.6},
+		{Language: "en", LanguageProbability: 0.4},
+	}
+	if language, probability := chunkLanguage(chunks, results); language != "de" || probability != 0.6 {
+		t.Errorf("chunkLanguage = %s, %v, want the language heard longest", language, probability)
+	}
+	if language, _ := chunkLanguage(chunks[:1], []*TranscriptionResult{{}}); language != "" {
+		t.Errorf("chunkLanguage = %q without a detected language", language)
+	}
+}
+
+func TestSameText(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"Hello, world.", "hello world", true},
+		{"and then we left", "Then we left.", true},
+		{"Hello.", "Goodbye.", false},
+		{"...", "", true},
+		{"Hi.", "", false},
+	}
+	for _, test := range tests {
+		if got := sameText(test.a, test.b); got != test.want {
+			t.Errorf("sameText(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,467 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// cleanProcessor is the name the clean verbatim processor is registered
+// under
+const cleanProcessor = "clean"
+
+// maxFalseStart is the longest phrase, in words, that is dropped when it is
+// said twice in a row, e.g. "I think I think"
+const maxFalseStart = 4
+
+// fillerList holds the fillers of one language. Words are hesitation sounds
+// that are always removed. Phrases carry meaning in other places, so they
+// are only removed when set off by commas or sentence boundaries, e.g. "it
+// was, you know, hard" but not "do you know her".
+type fillerList struct {
+	words   []string
+	phrases []string
+	// doubles are words that are correctly said twice in a row, e.g. "had
+	// had"
+	doubles []string
+}
+
+// fillers lists the fillers of each language by its code. Hesitation
+// sounds such as "um" are shared by most languages, so other languages use
+// the English sounds without its phrases.
+var fillers = map[string]fillerList{
+	"en": {
+		words:   []string{"um", "umm", "uh", "uhh", "uhm", "er", "erm", "ah", "ahh", "hmm", "hm", "mm", "mmm"},
+		phrases: []string{"you know", "i mean", "like", "you see", "sort of", "kind of", "basically"},
+		doubles: []string{"had", "that", "is"},
+	},
+	"de": {
+		words:   []string{"äh", "ähm", "öh", "öhm", "hm", "hmm", "mm", "äm"},
+		phrases: []string{"also", "halt", "sozusagen", "weißt du", "quasi"},
+		doubles: []string{"die", "der", "das"},
+	},
+	"es": {
+		words:   []string{"eh", "em", "ehm", "mmm", "hmm", "este"},
+		phrases: []string{"o sea", "pues", "sabes", "bueno", "vale"},
+	},
+	"fr": {
+		words:   []string{"euh", "heu", "hum", "hmm", "ben", "bah"},
+		phrases: []string{"tu sais", "tu vois", "genre", "en fait", "quoi", "bon"},
+		doubles: []string{"nous", "vous"},
+	},
+	"it": {
+		words:   []string{"ehm", "eh", "uhm", "mmm", "hmm"},
+		phrases: []string{"cioè", "tipo", "diciamo", "insomma"},
+	},
+	"pt": {
+		words:   []string{"hã", "ahn", "hum", "hmm", "éé"},
+		phrases: []string{"tipo", "né", "sabe", "então"},
+	},
+	"nl": {
+		words:   []string{"eh", "ehm", "uh", "uhm", "hm", "hmm"},
+		phrases: []string{"zeg maar", "weet je", "eigenlijk"},
+	},
+}
+
+// stutterPrefixes are word beginnings written with a hyphen that are part
+// of the word, not a stutter, e.g. "re-read"
+var stutterPrefixes = map[string]bool{
+	"re": true, "co": true, "de": true, "un": true, "bi": true, "ex": true, "pre": true, "pro": true,
+	"non": true, "sub": true, "mid": true, "mis": true,
+}
+
+func init() {
+	RegisterProcessor(cleanProcessor, "Clean verbatim: remove fillers such as um and you know, stutters and repeated words: fillers=<more|fillers>, language=<code>", newCleanProcessor)
+}
+
+// cleanVerbatimProcessor turns a verbatim transcript into a clean verbatim
+// one for publishing: hesitation sounds, filler phrases, stutters and words
+// or phrases said twice in a row are removed. Words keep their timestamps
+// and segments are shortened to the words they keep.
+type cleanVerbatimProcessor struct {
+	// fillers are added to the language's list; single words are removed
+	// anywhere and phrases when set off by punctuation
+	fillers  []string
+	language string
+}
+
+func newCleanProcessor(options map[string]string) (Processor, error) {
+	if err := checkProcessorOptions(options, "fillers", "language"); err != nil {
+		return nil, err
+	}
+	processor := &cleanVerbatimProcessor{language: strings.ToLower(options["language"])}
+	for _, filler := range splitList(options["fillers"]) {
+		processor.fillers = append(processor.fillers, strings.ToLower(filler))
+	}
+	return processor, nil
+}
+
+// cleanToken is a word of a segment being cleaned
+type cleanToken struct {
+	text string
+	// word is the index of the token's word, or -1 when the segment's
+	// words could not be lined up with its text
+	word    int
+	dropped bool
+}
+
+// cleanCounts tallies what the processor removed
+type cleanCounts struct {
+	fillers, stutters, repeats, segments int
+}
+
+// Process cleans every segment and reports how much it removed. Segments
+// left without words, e.g. a lone "Um.", are removed.
+func (p *cleanVerbatimProcessor) Process(result *TranscriptionResult, step *ProcessingStep) error {
+	language := p.language
+	if language == "" {
+		language = result.Language
+	}
+	list, ok := fillers[language]
+	if !ok {
+		list = fillerList{words: fillers["en"].words}
+	}
+	words, phrases := append([]string{}, list.words...), append([]string{}, list.phrases...)
+	for _, filler := range p.fillers {
+		if strings.Contains(filler, " ") {
+			phrases = append(phrases, filler)
+		} else {
+			words = append(words, filler)
+		}
+	}
+	doubles := make(map[string]bool)
+	for _, double := range list.doubles {
+		doubles[double] = true
+	}
+	separator := " "
+	if spacelessLanguages[language] {
+		separator = ""
+	}
+
+	var counts cleanCounts
+	kept := make([]Segment, 0, len(result.Segments))
+	for _, segment := range result.Segments {
+		tokens, aligned := cleanTokens(segment)
+		before := counts
+		dropAll(tokens, words, phrases, doubles, &counts)
+		if counts == before {
+			kept = append(kept, segment)
+			continue
+		}
+		step.Changes++
+
+		cleaned, empty := rebuildSegment(segment, tokens, aligned, separator)
+		if empty {
+			counts.segments++
+			continue
+		}
+		if !aligned && len(segment.Words) > 0 {
+			// Words that no longer match the text, e.g. after a replace,
+			// are cleaned on their own so they cannot bring fillers back
+			cleaned.Words = cleanWords(segment.Words, words, phrases, doubles)
+		}
+		kept = append(kept, cleaned)
+	}
+	result.Segments = kept
+
+	if step.Changes > 0 {
+		step.Details = append(step.Details, fmt.Sprintf("removed %d fillers, %d stutters and %d repeated words or phrases; %d segments were left empty and removed",
+			counts.fillers, counts.stutters, counts.repeats, counts.segments))
+	}
+	return nil
+}
+
+// dropAll drops fillers, stutters and repeats from tokens and adds what it
+// dropped to counts
+func dropAll(tokens []cleanToken, words, phrases []string, doubles map[string]bool, counts *cleanCounts) {
+	counts.fillers += dropFillers(tokens, words, phrases)
+	counts.stutters += dropStutters(tokens)
+	counts.repeats += dropRepeats(tokens, doubles)
+}
+
+// cleanWords cleans a segment's words by themselves and returns the words
+// kept
+func cleanWords(segmentWords []Word, words, phrases []string, doubles map[string]bool) []Word {
+	tokens := make([]cleanToken, len(segmentWords))
+	for i, word := range segmentWords {
+		tokens[i] = cleanToken{text: strings.TrimSpace(word.Text), word: i}
+	}
+	var counts cleanCounts
+	dropAll(tokens, words, phrases, doubles, &counts)
+	cleaned, empty := rebuildSegment(Segment{Words: segmentWords}, tokens, true, " ")
+	if empty {
+		return nil
+	}
+	return cleaned.Words
+}
+
+// cleanTokens splits a segment into tokens, one per word when its words
+// can be lined up with its text
+func cleanTokens(segment Segment) ([]cleanToken, bool) {
+	if _, aligned := wordSpans(segment.Text, segment.Words); aligned {
+		tokens := make([]cleanToken, len(segment.Words))
+		for i, word := range segment.Words {
+			tokens[i] = cleanToken{text: strings.TrimSpace(word.Text), word: i}
+		}
+		return tokens, true
+	}
+	var tokens []cleanToken
+	for _, field := range strings.Fields(segment.Text) {
+		tokens = append(tokens, cleanToken{text: field, word: -1})
+	}
+	return tokens, false
+}
+
+// dropFillers drops filler words anywhere and filler phrases set off by
+// punctuation, and returns how many it dropped
+func dropFillers(tokens []cleanToken, words, phrases []string) int {
+	isFiller := make(map[string]bool, len(words))
+	for _, word := range words {
+		isFiller[glossaryLetters(word)] = true
+	}
+	dropped := 0
+	for i := range tokens {
+		if letters := glossaryLetters(tokens[i].text); letters != "" && isFiller[letters] {
+			tokens[i].dropped = true
+			dropped++
+		}
+	}
+
+	for _, phrase := range phrases {
+		parts := strings.Fields(phrase)
+		for i := 0; i+len(parts) <= len(tokens); i++ {
+			last := i + len(parts) - 1
+			if !matchesPhrase(tokens[i:last+1], parts) || !setOff(tokens, i, last) {
+				continue
+			}
+			for j := i; j <= last; j++ {
+				tokens[j].dropped = true
+			}
+			dropped++
+			i = last
+		}
+	}
+	return dropped
+}
+
+// matchesPhrase reports whether tokens spell the words of a phrase,
+// ignoring case and punctuation
+func matchesPhrase(tokens []cleanToken, parts []string) bool {
+	for i, part := range parts {
+		if tokens[i].dropped || glossaryLetters(tokens[i].text) != glossaryLetters(part) {
+			return false
+		}
+	}
+	return true
+}
+
+// setOff reports whether the tokens first to last stand apart from the
+// sentence around them: they start the segment, follow punctuation or
+// follow only dropped tokens, and end the segment or end with punctuation
+func setOff(tokens []cleanToken, first, last int) bool {
+	previous := previousKept(tokens, first)
+	before := previous == "" || trailingPunctuation(previous) != ""
+	after := last == len(tokens)-1 || trailingPunctuation(tokens[last].text) != ""
+	// Inside a token, e.g. "know," in "you know,", only the last may carry
+	// punctuation
+	for i := first; i < last; i++ {
+		if trailingPunctuation(tokens[i].text) != "" {
+			return false
+		}
+	}
+	return before && after
+}
+
+// previousKept returns the text of the last kept token before i, or ""
+func previousKept(tokens []cleanToken, i int) string {
+	for j := i - 1; j >= 0; j-- {
+		if !tokens[j].dropped {
+			return tokens[j].text
+		}
+	}
+	return ""
+}
+
+// dropStutters drops cut-off starts of the next word, e.g. "I- I" or
+// "th- the", and repairs stutters written as one word, e.g. "th-the", and
+// returns how many it fixed
+func dropStutters(tokens []cleanToken) int {
+	fixed := 0
+	for i := range tokens {
+		token := &tokens[i]
+		if token.dropped {
+			continue
+		}
+		// A stutter written as one word keeps the word after the hyphen
+		if start, rest, ok := strings.Cut(token.text, "-"); ok && isStutter(start, rest) {
+			token.text = matchCase(start, rest)
+			fixed++
+			continue
+		}
+		if !strings.HasSuffix(token.text, "-") || i+1 >= len(tokens) {
+			continue
+		}
+		if isStutter(strings.TrimSuffix(token.text, "-"), tokens[i+1].text) {
+			token.dropped = true
+			fixed++
+		}
+	}
+	return fixed
+}
+
+// isStutter reports whether start is a cut-off beginning of word
+func isStutter(start, word string) bool {
+	start, word = glossaryLetters(start), glossaryLetters(word)
+	if start == "" || word == "" || utf8.RuneCountInString(start) > 3 || stutterPrefixes[start] && start != word {
+		return false
+	}
+	return strings.HasPrefix(word, start)
+}
+
+// matchCase capitalizes word when start was capitalized, so "Th-the" becomes
+// "The"
+func matchCase(start, word string) string {
+	first, _ := utf8.DecodeRuneInString(start)
+	if !unicode.IsUpper(first) {
+		return word
+	}
+	return capitalize(word)
+}
+
+// capitalize upper-cases the first letter of text
+func capitalize(text string) string {
+	for i, r := range text {
+		if unicode.IsLetter(r) {
+			return text[:i] + string(unicode.ToUpper(r)) + text[i+utf8.RuneLen(r):]
+		}
+	}
+	return text
+}
+
+// dropRepeats drops words and phrases said twice in a row, keeping the
+// second occurrence, and returns how many it dropped. A phrase is only a
+// false start when no sentence ends within it.
+func dropRepeats(tokens []cleanToken, doubles map[string]bool) int {
+	dropped := 0
+	for n := 1; n <= maxFalseStart; n++ {
+		var indexes []int
+		for i, token := range tokens {
+			if !token.dropped {
+				indexes = append(indexes, i)
+			}
+		}
+		for i := 0; i+2*n <= len(indexes); i++ {
+			first, second := indexes[i:i+n], indexes[i+n:i+2*n]
+			if !sameTokens(tokens, first, second) || n == 1 && doubles[glossaryLetters(tokens[first[0]].text)] {
+				continue
+			}
+			for _, j := range first {
+				tokens[j].dropped = true
+			}
+			dropped++
+			i += n - 1
+		}
+	}
+	return dropped
+}
+
+// sameTokens reports whether the tokens at a and b spell the same words and
+// no sentence ends within a
+func sameTokens(tokens []cleanToken, a, b []int) bool {
+	for k := range a {
+		letters := glossaryLetters(tokens[a[k]].text)
+		if letters == "" || letters != glossaryLetters(tokens[b[k]].text) {
+			return false
+		}
+		if strings.ContainsAny(trailingPunctuation(tokens[a[k]].text), ".?!") {
+			return false
+		}
+	}
+	return true
+}
+
+// trailingPunctuation returns the characters after the last letter or digit
+// of text
+func trailingPunctuation(text string) string {
+	trimmed := strings.TrimRightFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return text[len(trimmed):]
+}
+
+// rebuildSegment joins the kept tokens into the segment's text and words.
+// Punctuation ending a removed run moves to the word before it, so "went
+// there, um." becomes "went there.", and a removed run that began a
+// sentence passes its capital letter on. empty is set when no word was kept.
+func rebuildSegment(segment Segment, tokens []cleanToken, aligned bool, separator string) (cleaned Segment, empty bool) {
+	var texts []string
+	var words []Word
+	lastKept := -1
+	sentenceStart := true
+	capitalizeNext := false
+	for i := 0; i < len(tokens); {
+		if !tokens[i].dropped {
+			text := tokens[i].text
+			if capitalizeNext {
+				text = capitalize(text)
+				capitalizeNext = false
+			}
+			texts = append(texts, text)
+			lastKept = len(texts) - 1
+			sentenceStart = endsSentenceWord(text)
+			if aligned {
+				word := segment.Words[tokens[i].word]
+				word.Text = leadingSpace(word.Text) + text
+				words = append(words, word)
+			}
+			i++
+			continue
+		}
+
+		// A run of dropped tokens
+		first := i
+		for i < len(tokens) && tokens[i].dropped {
+			i++
+		}
+		last := tokens[i-1].text
+		punctuation := trailingPunctuation(last)
+		if r, _ := utf8.DecodeRuneInString(tokens[first].text); sentenceStart && unicode.IsUpper(r) {
+			capitalizeNext = true
+		}
+		if lastKept < 0 {
+			continue
+		}
+		previous := texts[lastKept]
+		switch {
+		case strings.ContainsAny(punctuation, ".?!"):
+			// The sentence still ends here
+			previous = strings.TrimRight(previous, ",;:") + strings.TrimLeft(punctuation, ",;: ")
+			sentenceStart = true
+			capitalizeNext = false
+		case strings.HasSuffix(punctuation, ",") && strings.HasSuffix(previous, ",") && i < len(tokens):
+			// A filler set off by commas takes its commas with it
+			previous = strings.TrimSuffix(previous, ",")
+		}
+		texts[lastKept] = previous
+		if aligned {
+			words[len(words)-1].Text = leadingSpace(words[len(words)-1].Text) + previous
+		}
+	}
+	if len(texts) == 0 {
+		return segment, true
+	}
+
+	segment.Text = strings.Join(texts, separator)
+	if aligned {
+		segment.Words = words
+		segment.Start = words[0].Start
+		segment.End = words[len(words)-1].End
+	}
+	return segment, false
+}
+
+// leadingSpace returns the whitespace a word's text starts with
+func leadingSpace(text string) string {
+	return text[:len(text)-len(strings.TrimLeftFunc(text, unicode.IsSpace))]
+}
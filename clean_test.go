@@ -0,0 +1,115 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func clean(t *testing.T, options map[string]string, segments ...Segment) *TranscriptionResult {
+	t.Helper()
+	result := &TranscriptionResult{Language: "en", Segments: segments}
+	if err := RunProcessors(result, []ProcessorConfig{{Name: cleanProcessor, Options: options}}); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func wordTexts(words []Word) string {
+	texts := make([]string, len(words))
+	for i, word := range words {
+		texts[i] = word.Text
+	}
+	return strings.Join(texts, " ")
+}
+
+func TestCleanVerbatim(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Um, so we, uh, started the the project.", "So we started the project."},
+		{"It was, you know, hard.", "It was hard."},
+		{"Do you know her?", "Do you know her?"},
+		{"I- I think th-the plan works.", "I think the plan works."},
+		{"I think I think we should go.", "I think we should go."},
+		{"He had had enough.", "He had had enough."},
+		{"We went there, um.", "We went there."},
+		{"We re-read the brief.", "We re-read the brief."},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			result := clean(t, nil, timedSegment(0, 0.5, test.text))
+			segment := result.Segments[0]
+			if segment.Text != test.want {
+				t.Errorf("text = %q, want %q", segment.Text, test.want)
+			}
+			if words := wordTexts(segment.Words); words != segment.Text {
+				t.Errorf("words = %q, want them to spell the text", words)
+			}
+		})
+	}
+}
+
+func TestCleanKeepsTimestamps(t *testing.T) {
+	result := clean(t, nil, timedSegment(0, 1, "Um, hello there."))
+	segment := result.Segments[0]
+	if segment.Start != 1 || segment.End != 3 || segment.Words[0].Start != 1 {
+		t.Errorf("segment = %+v, want it trimmed to the kept words", segment)
+	}
+}
+
+func TestCleanRemovesEmptySegments(t *testing.T) {
+	result := clean(t, nil, timedSegment(0, 0.5, "Um."), timedSegment(1, 0.5, "Hello."))
+	if len(result.Segments) != 1 || result.Text != "Hello." {
+		t.Fatalf("segments = %q", sentenceTexts(result.Segments))
+	}
+	if details := result.Processing[0].Details; len(details) != 1 || !strings.Contains(details[0], "1 segments were left empty") {
+		t.Errorf("details = %q", details)
+	}
+}
+
+func TestCleanOptions(t *testing.T) {
+	result := clean(t, map[string]string{"fillers": "right|at the end of the day"},
+		timedSegment(0, 0.5, "Right, at the end of the day, it works."))
+	if got := result.Segments[0].Text; got != "It works." {
+		t.Errorf("custom fillers: got %q", got)
+	}
+
+	result = clean(t, map[string]string{"language": "de"}, timedSegment(0, 0.5, "Das ist, äh, gut."))
+	if got := result.Segments[0].Text; got != "Das ist gut." {
+		t.Errorf("german: got %q", got)
+	}
+
+	if _, err := newProcessor(ProcessorConfig{Name: cleanProcessor, Options: map[string]string{"level": "high"}}); err == nil {
+		t.Error("unknown option accepted")
+	}
+}
+
+// Words left stale by a text-only edit are cleaned too, so fillers do not
+// come back in word output
+func TestCleanWordsThatDisagreeWithText(t *testing.T) {
+	segment := timedSegment(0, 0.5, "Um, we use cooper netties, uh, daily.")
+	segment.Text = "Um, we use Kubernetes, uh, daily."
+	result := clean(t, nil, segment)
+
+	got := result.Segments[0]
+	if got.Text != "We use Kubernetes daily." {
+		t.Errorf("text = %q", got.Text)
+	}
+	if words := wordTexts(got.Words); words != "We use cooper netties daily." {
+		t.Errorf("words = %q, want the fillers removed", words)
+	}
+}
+
+func TestCleanOnceFromCLIFlags(t *testing.T) {
+	pipeline := withProcessor(withProcessor([]ProcessorConfig{{Name: "casing"}}, cleanProcessor), cleanProcessor)
+	count := 0
+	for _, config := range pipeline {
+		if config.Name == cleanProcessor {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("pipeline %s runs clean %d times", processorNames(pipeline), count)
+	}
+}
@@ -2,19 +2,27 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
+
+	"localtts/audio"
 )
 
 type OfflineTranscribe struct {
 	currentFile     string
 	resourceManager *ResourceManager
-	transcriber     *WhisperTranscriber
+	transcriber     Engine
 }
 
-func NewOfflineTranscribe() (*OfflineTranscribe, error) {
+func NewOfflineTranscribe(config EngineConfig) (*OfflineTranscribe, error) {
 	// Initialize resource manager and extract embedded files
 	rm, err := NewResourceManager()
 	if err != nil {
@@ -22,13 +30,19 @@ func NewOfflineTranscribe() (*OfflineTranscribe, error) {
 	}
 
 	// Verify resources were extracted correctly
-	if err := rm.VerifyResources(); err != nil {
-		rm.Cleanup()
-		return nil, fmt.Errorf("resource verification failed: %v", err)
+	if config.NeedsResources() {
+		if err := rm.VerifyResources(); err != nil {
+			rm.Cleanup()
+			return nil, fmt.Errorf("resource verification failed: %v", err)
+		}
 	}
 
-	// Create transcriber with resource manager
-	transcriber := NewWhisperTranscriber(rm)
+	// Create the configured transcription engine
+	transcriber, err := NewEngine(config, rm)
+	if err != nil {
+		rm.Cleanup()
+		return nil, err
+	}
 
 	return &OfflineTranscribe{
 		resourceManager: rm,
@@ -36,32 +50,102 @@ func NewOfflineTranscribe() (*OfflineTranscribe, error) {
 	}, nil
 }
 
-func (ot *OfflineTranscribe) processAudio(inputFile, modelSize string) (string, error) {
+func (ot *OfflineTranscribe) processAudio(ctx context.Context, inputFile string, opts TranscribeOptions, format FormatOptions) (string, error) {
+	opts, err := opts.Normalize()
+	if err != nil {
+		return "", err
+	}
+	modelSize := opts.ModelSize
 	fmt.Printf("Processing audio file: %s\n", inputFile)
 	fmt.Printf("Model size: %s\n", modelSize)
+	if opts.Language != "" {
+		fmt.Printf("Language: %s\n", opts.Language)
+	}
+	if opts.Task == TaskTranslate {
+		fmt.Println("Task: translate to English")
+	}
+	if len(opts.Glossary) > 0 {
+		if terms, err := promptGlossary(opts.Prompt, opts.Glossary); err == nil && len(terms) < len(opts.Glossary) {
+			fmt.Printf("Glossary: %d terms, %d of them fit in the prompt\n", len(opts.Glossary), len(terms))
+		} else {
+			fmt.Printf("Glossary: %d terms\n", len(opts.Glossary))
+		}
+	}
+	fmt.Printf("Decoding: %s\n", opts)
+	if len(opts.PostProcessing) > 0 {
+		fmt.Printf("Post-processing: %s\n", processorNames(opts.PostProcessing))
+	}
 	
-	// Check if file exists
-	if _, err := os.Stat(inputFile); os.IsNotExist(err) {
-		return "", fmt.Errorf("file does not exist: %s", inputFile)
+	// Inspect the file so empty or corrupt audio fails before the model loads
+	info, err := audio.Probe(inputFile)
+	if err != nil {
+		return "", err
 	}
+	fmt.Printf("Audio: %s\n", info.Format)
+	fmt.Printf("Duration: %s\n", formatTimestampMillis(info.Duration.Seconds()))
+	opts.AudioInfo = &info
 	
-	fmt.Printf("Loading Whisper model: %s...\n", modelSize)
+	fmt.Printf("Loading %s model: %s...\n", ot.transcriber.Capabilities().Name, modelSize)
 	
 	// Load the model
 	if err := ot.transcriber.LoadModel(modelSize); err != nil {
 		return "", fmt.Errorf("failed to load model: %v", err)
 	}
 	
-	fmt.Println("Transcribing audio...")
+	fmt.Println("Transcribing audio... (press Ctrl-C to cancel)")
 	
-	// Transcribe the audio
-	result, err := ot.transcriber.TranscribeFile(inputFile, modelSize)
+	// Stop whisper when the user presses Ctrl-C or the process is terminated
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	
+	// Transcribe the audio, redrawing a single progress line as whisper advances
+	opts.Progress = func(p Progress) {
+		fmt.Printf("\rProgress: %-40s", p)
+	}
+	result, err := ot.transcriber.TranscribeContext(ctx, inputFile, opts)
+	fmt.Println()
 	if err != nil {
-		return "", fmt.Errorf("transcription failed: %v", err)
+		return "", fmt.Errorf("transcription failed: %w", err)
+	}
+	
+	if result.Cached {
+		fmt.Println("Transcript taken from the cache (use -no-cache to transcribe again)")
+	}
+	
+	if result.VAD != nil {
+		if len(result.VAD.Regions) == 0 {
+			fmt.Println("Voice activity: no speech detected")
+		} else {
+			fmt.Printf("Voice activity: %d speech regions, %s of %s transcribed\n", len(result.VAD.Regions),
+				formatTimestampMillis(result.VAD.SpeechSeconds), formatTimestampMillis(result.VAD.TotalSeconds))
+		}
+	}
+	
+	if speakers := resultSpeakers(result); len(speakers) > 0 {
+		fmt.Printf("Speakers: %s\n", strings.Join(speakers, ", "))
+	}
+	
+	if result.LanguageProbability > 0 {
+		fmt.Printf("Detected language: %s (%s, %.0f%% confidence)\n", languageName(result.Language), result.Language, result.LanguageProbability*100)
+	}
+	
+	for _, step := range result.Processing {
+		fmt.Printf("Processor %s: %d segment(s) changed\n", step.Name, step.Changes)
+		for _, detail := range step.Details {
+			fmt.Printf("  %s\n", detail)
+		}
+	}
+	
+	// The map holds the redacted originals, so it is only written on request
+	if format.RedactionMap != "" {
+		if err := WriteRedactionMap(format.RedactionMap, result.Redactions); err != nil {
+			return "", err
+		}
+		fmt.Printf("Redaction map saved to: %s\n", format.RedactionMap)
 	}
 	
 	// Format the results
-	formattedOutput := ot.transcriber.FormatResults(result)
+	formattedOutput := FormatResults(result, format)
 	
 	fmt.Println("Transcription complete!")
 	return formattedOutput, nil
@@ -82,7 +166,7 @@ func (ot *OfflineTranscribe) saveResults(results, outputFile string) error {
 	return nil
 }
 
-func (ot *OfflineTranscribe) interactive() {
+func (ot *OfflineTranscribe) interactive(ctx context.Context) {
 	fmt.Println("===========================================")
 	fmt.Println("OfflineTranscribe - Offline Speech-to-Text Tool")
 	fmt.Println("===========================================")
@@ -91,7 +175,7 @@ func (ot *OfflineTranscribe) interactive() {
 	scanner := bufio.NewScanner(os.Stdin)
 	
 	// Get input file
-	fmt.Print("Enter path to audio file (WAV, MP3, MP4): ")
+	fmt.Print("Enter path to audio file (WAV, MP3, FLAC): ")
 	scanner.Scan()
 	inputFile := strings.TrimSpace(scanner.Text())
 	
@@ -119,10 +203,42 @@ func (ot *OfflineTranscribe) interactive() {
 		modelSize = "base"
 	}
 	
+	// Get language
+	fmt.Print("\nLanguage code, e.g. en, de, es, or auto to detect [auto]: ")
+	scanner.Scan()
+	language, err := normalizeLanguage(scanner.Text())
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	
+	// Get task
+	fmt.Print("\nTranslate to English? (y/N): ")
+	scanner.Scan()
+	task := TaskTranscribe
+	if answer := strings.ToLower(strings.TrimSpace(scanner.Text())); answer == "y" || answer == "yes" {
+		task = TaskTranslate
+	}
+	
+	// Get timestamp granularity
+	fmt.Print("\nTimestamps (paragraph/sentence/word) [sentence]: ")
+	scanner.Scan()
+	granularity := strings.ToLower(strings.TrimSpace(scanner.Text()))
+	if !validGranularity(granularity) {
+		granularity = GranularitySentence
+	}
+	
 	fmt.Println()
 	
-	// Process audio
-	results, err := ot.processAudio(inputFile, modelSize)
+	// Process audio with the project's post-processing
+	config, err := LoadProjectConfig(".")
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	opts := TranscribeOptions{ModelSize: modelSize, Language: language, Task: task, Glossary: config.Glossary, PostProcessing: config.PostProcessing}
+	format := FormatOptions{Granularity: granularity}
+	results, err := ot.processAudio(ctx, inputFile, opts, format)
 	if err != nil {
 		fmt.Printf("Error: %v\n", err)
 		return
@@ -164,19 +280,121 @@ func printUsage() {
 	fmt.Println("Usage:")
 	fmt.Println("  OfflineTranscribe                                    - Interactive mode")
 	fmt.Println("  OfflineTranscribe <input> [options]                  - CLI mode")
+	fmt.Println("  OfflineTranscribe jobs [remove <id>]                 - List or remove unfinished jobs")
+	fmt.Println("  OfflineTranscribe resume <id>                        - Resume an interrupted job")
+	fmt.Println("  OfflineTranscribe cache ls|clear|prune [-max <size>] - Manage the transcript cache")
+	fmt.Println("  OfflineTranscribe speakers <transcript> <id>=<name>… - Name the speakers in a transcript")
 	fmt.Println()
 	fmt.Println("Options:")
 	fmt.Println("  -model <size>    Model size: tiny, base (default: base)")
 	fmt.Println("  -output <file>   Output file (default: <input>_transcription.txt)")
+	fmt.Println("  -lang <code>     Spoken language, e.g. en, de, es, or auto to detect (default: auto)")
+	fmt.Println("  -task <task>     transcribe, or translate speech into English (default: transcribe)")
+	fmt.Println("  -prompt <text>   Initial prompt to guide spelling and style")
+	fmt.Println("  -glossary <file> Glossary file with one term per line (names, acronyms)")
+	fmt.Println("  -timestamps <t>  Timestamp granularity: paragraph, sentence, word (default: sentence)")
+	fmt.Println("  -diarize         Label speakers, with a tinydiarize model such as small.en-tdrz if installed")
+	fmt.Println("  -speakers <n>    Number of speakers to tell apart, enables -diarize (default: estimate)")
+	fmt.Println("  -split-channels  Transcribe each channel of a stereo file separately, labeled CHANNEL_1, CHANNEL_2")
+	fmt.Println("  -speaker-names <names>  Name speakers, e.g. SPEAKER_1=Alice,SPEAKER_2=Bob")
+	fmt.Println("  -timeout <dur>   Abort transcription after a duration, e.g. 30m (default: none)")
+	fmt.Println("  -no-cache        Transcribe even if the transcript cache has a result for this file")
+	fmt.Println("  -config <file>   Project config file (default: nearest " + ProjectConfigFile + ")")
+	fmt.Println()
+	fmt.Println("Post-processing:")
+	fmt.Println("  -post-process <list>     Processors run in order on the transcript, replacing those of the")
+	fmt.Println("                           project config, e.g. replace:find=gonna;with=going to,casing")
+	fmt.Println("                           Quote values holding , or ; e.g. replace:find=\"\\d{3,4}\";regex=true")
+	fmt.Println("                           May be repeated; use -post-process none to run no processors.")
+	fmt.Println("  -filter-hallucinations   Remove repetition loops and phrases whisper invented over silence")
+	fmt.Println("  -correct-glossary        Replace words that sound like a glossary term, e.g. Cooper Netties with Kubernetes")
+	fmt.Println("  -clean                   Clean verbatim transcript: remove fillers such as um and you know, stutters")
+	fmt.Println("                           and repeated words (default: verbatim)")
+	fmt.Println("  -redact <detectors>      Mask personal data, run after every other processor: all, or any of")
+	fmt.Println("                           email, phone, card, profanity separated by commas")
+	fmt.Println("  -redact-mask <style>     How redacted text is shown: label ([PHONE]), stars or remove (default: label)")
+	fmt.Println("  -redact-map <file>       Save the redacted originals with their times as JSON (keep it private)")
+	for _, name := range ProcessorNames() {
+		fmt.Printf("  %-24s %s\n", name, ProcessorDescription(name))
+	}
+	fmt.Println()
+	fmt.Println("Decoding options:")
+	fmt.Println("  -threads <n>             Threads per processor (default: min(4, CPUs))")
+	fmt.Println("  -processors <n>          Parallel processors (default: 1)")
+	fmt.Println("  -beam-size <n>           Beam search width (default: 5)")
+	fmt.Println("  -best-of <n>             Candidates sampled when temperature > 0 (default: 5)")
+	fmt.Println("  -temperature <t>         Sampling temperature between 0 and 1 (default: 0)")
+	fmt.Println("  -entropy-threshold <t>   Entropy threshold for decoder fallback (default: 2.4)")
+	fmt.Println("  -logprob-threshold <t>   Log probability threshold for decoder fallback (default: -1.0)")
+	fmt.Println("  -max-len <n>             Maximum segment length in characters (default: 0, no limit)")
+	fmt.Println("  -split-on-word           Split segments on words rather than tokens (needs -max-len)")
+	fmt.Println()
+	fmt.Println("Long recordings:")
+	fmt.Println("  -workers <n>             Whisper processes run in parallel on chunks (default: CPUs / threads)")
+	fmt.Println("  -chunk <seconds>         Approximate chunk length; shorter files are not split (default: 600)")
+	fmt.Println("  Use -workers 1 to transcribe the whole file in a single pass.")
+	fmt.Println()
+	fmt.Println("Voice activity detection:")
+	fmt.Println("  -vad                     Transcribe only speech, skipping silence")
+	fmt.Println("  -vad-threshold <dB>      Level above the noise floor that counts as speech (default: 10)")
+	fmt.Println("  -vad-min-speech <ms>     Ignore sounds shorter than this (default: 250)")
+	fmt.Println("  -vad-min-silence <ms>    Keep pauses shorter than this inside speech (default: 700)")
+	fmt.Println("  -vad-padding <ms>        Audio kept before and after speech (default: 200)")
+	fmt.Println("  Setting any -vad-* value enables -vad.")
+	fmt.Println()
+	fmt.Println("Environment:")
+	fmt.Println("  OFFLINETRANSCRIBE_ENGINE     Transcription engine: whisper-cli, fake (default: whisper-cli)")
+	fmt.Println("  OFFLINETRANSCRIBE_JOBS_DIR   Where unfinished jobs are kept (default: user cache directory)")
+	fmt.Println("  OFFLINETRANSCRIBE_CACHE_DIR  Where transcripts are cached (default: user cache directory)")
+	fmt.Println("  OFFLINETRANSCRIBE_CACHE_SIZE Size the transcript cache is trimmed to, e.g. 500MB, or off (default: 1GB)")
+	fmt.Println("  OFFLINETRANSCRIBE_CONFIG     Project config file used instead of the nearest " + ProjectConfigFile)
 	fmt.Println()
 	fmt.Println("Examples:")
 	fmt.Println("  OfflineTranscribe recording.wav")
 	fmt.Println("  OfflineTranscribe recording.wav -model tiny")
 	fmt.Println("  OfflineTranscribe recording.wav -output transcript.txt")
+	fmt.Println("  OfflineTranscribe recording.wav -timestamps word")
+	fmt.Println("  OfflineTranscribe interview.wav -timestamps paragraph")
+	fmt.Println("  OfflineTranscribe meeting.wav -lang de")
+	fmt.Println("  OfflineTranscribe meeting.wav -lang de -task translate")
+	fmt.Println("  OfflineTranscribe standup.wav -glossary product_terms.txt")
+	fmt.Println("  OfflineTranscribe lecture.wav -beam-size 8 -max-len 60 -split-on-word")
+	fmt.Println("  OfflineTranscribe meeting.wav -vad -vad-min-silence 1000")
+	fmt.Println("  OfflineTranscribe interview.wav -model small.en -diarize")
+	fmt.Println("  OfflineTranscribe panel.mp3 -speakers 4")
+	fmt.Println("  OfflineTranscribe call.wav -split-channels -speaker-names CHANNEL_1=Agent,CHANNEL_2=Customer")
+	fmt.Println("  OfflineTranscribe speakers interview_transcription.txt SPEAKER_1=Alice SPEAKER_2=Bob")
+	fmt.Println("  OfflineTranscribe lecture.mp3 -threads 2 -workers 8")
+	fmt.Println("  OfflineTranscribe noisy_call.wav -filter-hallucinations")
+	fmt.Println("  OfflineTranscribe standup.wav -glossary terms.txt -correct-glossary")
+	fmt.Println("  OfflineTranscribe interview.wav -clean -timestamps paragraph")
+	fmt.Println("  OfflineTranscribe support_call.wav -redact phone,email,card -redact-map call_redactions.json")
+	fmt.Println("  OfflineTranscribe podcast.mp3 -post-process \"replace:find=open ai;with=OpenAI;ignorecase=true,casing\"")
+}
+
+// parseIntOption parses the value of a numeric command line option
+func parseIntOption(option, value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %s for %s: expected an integer", value, option)
+	}
+	return n, nil
+}
+
+// parseFloatOption parses the value of a decimal command line option
+func parseFloatOption(option, value string) (float64, error) {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %s for %s: expected a number", value, option)
+	}
+	return f, nil
 }
 
 // Cleanup releases all resources
 func (ot *OfflineTranscribe) Cleanup() error {
+	if ot.transcriber != nil {
+		ot.transcriber.Close()
+	}
 	if ot.resourceManager != nil {
 		return ot.resourceManager.Cleanup()
 	}
@@ -184,16 +402,24 @@ func (ot *OfflineTranscribe) Cleanup() error {
 }
 
 func main() {
-	ot, err := NewOfflineTranscribe()
+	ot, err := NewOfflineTranscribe(LoadEngineConfig())
 	if err != nil {
 		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
 	defer ot.Cleanup()
 	
+	// os.Exit skips deferred calls, so remove extracted resources first
+	exit := func(code int) {
+		ot.Cleanup()
+		os.Exit(code)
+	}
+	
+	ctx := context.Background()
+	
 	if len(os.Args) == 1 {
 		// Interactive mode
-		ot.interactive()
+		ot.interactive(ctx)
 		return
 	}
 	
@@ -202,49 +428,499 @@ func main() {
 		return
 	}
 	
+	// Job commands
+	switch {
+	case os.Args[1] == "jobs":
+		if err := jobsCommand(os.Args[2:]); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			exit(1)
+		}
+		return
+	case os.Args[1] == "cache":
+		if err := cacheCommand(os.Args[2:]); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			exit(1)
+		}
+		return
+	case os.Args[1] == "speakers":
+		if err := speakersCommand(os.Args[2:]); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			exit(1)
+		}
+		return
+	case os.Args[1] == "resume" && len(os.Args) == 3:
+		if code := ot.resumeJob(ctx, os.Args[2]); code != 0 {
+			exit(code)
+		}
+		return
+	}
+	
 	// CLI mode
 	inputFile := os.Args[1]
-	modelSize := "base"
+	// Defaults are filled in after parsing, as some depend on other
+	// options, e.g. the worker count on the threads per process
+	var opts TranscribeOptions
 	outputFile := ""
+	granularity := GranularitySentence
+	var speakerNames map[string]string
+	var timeout time.Duration
+	var processors []ProcessorConfig
+	processorsSet := false
+	filterHallucinations := false
+	correctGlossary := false
+	clean := false
+	configFile := ""
+	redact, redactMask, redactionMap := "", "", ""
 	
-	// Parse command line arguments
-	for i := 2; i < len(os.Args); i += 2 {
-		if i+1 >= len(os.Args) {
-			fmt.Printf("Error: option %s requires a value\n", os.Args[i])
-			os.Exit(1)
+	// Parse command line arguments. Switches take no value; every other
+	// option is followed by exactly one value.
+	args := os.Args[2:]
+	for len(args) > 0 {
+		option := args[0]
+		args = args[1:]
+		
+		switch option {
+		case "-split-on-word":
+			opts.SplitOnWord = true
+			continue
+		case "-vad":
+			opts.VAD = true
+			continue
+		case "-no-cache":
+			opts.NoCache = true
+			continue
+		case "-diarize":
+			opts.Diarize = true
+			continue
+		case "-split-channels":
+			opts.SplitChannels = true
+			continue
+		case "-filter-hallucinations":
+			filterHallucinations = true
+			continue
+		case "-correct-glossary":
+			correctGlossary = true
+			continue
+		case "-clean":
+			clean = true
+			continue
+		}
+		
+		if len(args) == 0 {
+			fmt.Printf("Error: option %s requires a value\n", option)
+			exit(1)
 		}
+		value := args[0]
+		args = args[1:]
 		
-		switch os.Args[i] {
+		switch option {
 		case "-model":
-			modelSize = os.Args[i+1]
+			opts.ModelSize = value
 		case "-output":
-			outputFile = os.Args[i+1]
+			outputFile = value
+		case "-lang":
+			opts.Language = value
+		case "-task":
+			opts.Task = value
+		case "-prompt":
+			opts.Prompt = value
+		case "-glossary":
+			opts.Glossary, err = LoadGlossary(value)
+		case "-speakers":
+			opts.Diarize = true
+			opts.Speakers, err = parseIntOption(option, value)
+		case "-speaker-names":
+			speakerNames, err = ParseSpeakerNames(value)
+		case "-post-process":
+			var more []ProcessorConfig
+			more, err = ParseProcessors(value)
+			processors = append(processors, more...)
+			processorsSet = true
+		case "-config":
+			configFile = value
+		case "-redact":
+			redact = value
+		case "-redact-mask":
+			redactMask = value
+		case "-redact-map":
+			redactionMap = value
+		case "-timestamps":
+			granularity = value
+			if !validGranularity(granularity) {
+				err = fmt.Errorf("invalid timestamps %s (use paragraph, sentence or word)", granularity)
+			}
+		case "-timeout":
+			timeout, err = time.ParseDuration(value)
+			if err != nil || timeout <= 0 {
+				err = fmt.Errorf("invalid timeout %s", value)
+			}
+		case "-threads":
+			opts.Threads, err = parseIntOption(option, value)
+		case "-processors":
+			opts.Processors, err = parseIntOption(option, value)
+		case "-beam-size":
+			opts.BeamSize, err = parseIntOption(option, value)
+		case "-best-of":
+			opts.BestOf, err = parseIntOption(option, value)
+		case "-temperature":
+			opts.Temperature, err = parseFloatOption(option, value)
+		case "-entropy-threshold":
+			if opts.EntropyThreshold, err = parseFloatOption(option, value); err == nil {
+				err = checkThreshold(option, opts.EntropyThreshold, defaultEntropyThreshold)
+			}
+		case "-logprob-threshold":
+			if opts.LogprobThreshold, err = parseFloatOption(option, value); err == nil {
+				err = checkThreshold(option, opts.LogprobThreshold, defaultLogprobThreshold)
+			}
+		case "-max-len":
+			opts.MaxSegmentLength, err = parseIntOption(option, value)
+		case "-workers":
+			opts.Workers, err = parseIntOption(option, value)
+		case "-chunk":
+			opts.ChunkSeconds, err = parseIntOption(option, value)
+		case "-vad-threshold":
+			opts.VAD = true
+			opts.VADThreshold, err = parseFloatOption(option, value)
+		case "-vad-min-speech":
+			opts.VAD = true
+			opts.VADMinSpeechMs, err = parseIntOption(option, value)
+		case "-vad-min-silence":
+			opts.VAD = true
+			opts.VADMinSilenceMs, err = parseIntOption(option, value)
+		case "-vad-padding":
+			opts.VAD = true
+			opts.VADPaddingMs, err = parseIntOption(option, value)
 		default:
-			fmt.Printf("Error: unknown option %s\n", os.Args[i])
+			fmt.Printf("Error: unknown option %s\n", option)
 			printUsage()
-			os.Exit(1)
+			exit(1)
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			exit(1)
+		}
+	}
+	
+	// Processors given on the command line replace those of the project
+	config, err := loadCLIConfig(configFile)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		exit(1)
+	}
+	if len(opts.Glossary) == 0 {
+		opts.Glossary = config.Glossary
+	}
+	opts.PostProcessing = config.PostProcessing
+	if processorsSet {
+		opts.PostProcessing = processors
+	}
+	if clean {
+		opts.PostProcessing = withProcessor(opts.PostProcessing, cleanProcessor)
+	}
+	if correctGlossary {
+		if len(opts.Glossary) == 0 {
+			fmt.Println("Error: -correct-glossary requires -glossary or a glossary in the project config")
+			exit(1)
+		}
+		opts.PostProcessing = withProcessor(opts.PostProcessing, glossaryProcessor)
+	}
+	if filterHallucinations {
+		opts.PostProcessing = withProcessor(opts.PostProcessing, hallucinationsProcessor)
+	}
+	if redact == "" && (redactMask != "" || redactionMap != "") {
+		fmt.Println("Error: -redact-mask and -redact-map require -redact")
+		exit(1)
+	}
+	if redact != "" {
+		redaction, err := RedactionConfig(redact, redactMask)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			exit(1)
+		}
+		opts.PostProcessing = withRedaction(opts.PostProcessing, redaction)
+	}
+	if redactionMap != "" {
+		if redactionMap, err = filepath.Abs(redactionMap); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			exit(1)
 		}
 	}
 	
+	// Validate everything up front, e.g. English-only models cannot translate
+	opts, err = opts.Normalize()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		exit(1)
+	}
+	
 	// Set default output file if not specified
 	if outputFile == "" {
 		baseName := strings.TrimSuffix(filepath.Base(inputFile), filepath.Ext(inputFile))
 		outputFile = fmt.Sprintf("%s_transcription.txt", baseName)
 	}
 	
-	// Process audio
-	results, err := ot.processAudio(inputFile, modelSize)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	
+	// Run the transcription as a job so an interrupted run can be resumed
+	job, err := newCLIJob(inputFile, outputFile, opts, FormatOptions{Granularity: granularity, SpeakerNames: speakerNames, RedactionMap: redactionMap})
 	if err != nil {
 		fmt.Printf("Error: %v\n", err)
-		os.Exit(1)
+		exit(1)
+	}
+	if code := ot.runAndReport(ctx, job, timeout); code != 0 {
+		exit(code)
+	}
+}
+
+// loadCLIConfig reads the project config given with -config, or the one
+// found from the working directory
+func loadCLIConfig(path string) (*ProjectConfig, error) {
+	if path != "" {
+		return ReadProjectConfig(path)
+	}
+	return LoadProjectConfig(".")
+}
+
+// newCLIJob records a command line transcription in the job store
+func newCLIJob(inputFile, outputFile string, opts TranscribeOptions, format FormatOptions) (*Job, error) {
+	store, err := OpenDefaultJobStore()
+	if err != nil {
+		return nil, err
+	}
+	job, err := store.Create(JobSourceCLI, opts, format)
+	if err != nil {
+		return nil, err
+	}
+	if job.OutputFile, err = filepath.Abs(outputFile); err == nil {
+		err = job.SetInput(inputFile, filepath.Base(inputFile))
+	}
+	if err != nil {
+		job.Remove()
+		return nil, err
+	}
+	return job, nil
+}
+
+// runJob transcribes a job and saves the transcript to its output file. The
+// job is removed once the transcript is saved. When a run is interrupted, or
+// fails after some chunks were transcribed, the job is kept for resuming.
+func (ot *OfflineTranscribe) runJob(ctx context.Context, job *Job) error {
+	fmt.Printf("Job: %s\n", job.ID)
+	opts := job.Options
+	opts.CheckpointDir = job.CheckpointDir()
+	
+	results, err := ot.processAudio(ctx, job.InputFile, opts, job.Format)
+	if err == nil {
+		err = ot.saveResults(results, job.OutputFile)
+	}
+	if err == nil {
+		return job.Remove()
 	}
 	
-	// Save results
-	err = ot.saveResults(results, outputFile)
+	if errors.Is(err, ErrTranscriptionCanceled) || job.HasCheckpoints() {
+		job.Fail(err)
+	} else {
+		job.Remove()
+	}
+	return err
+}
+
+// runAndReport runs a job, reports the outcome and returns the exit code
+func (ot *OfflineTranscribe) runAndReport(ctx context.Context, job *Job, timeout time.Duration) int {
+	err := ot.runJob(ctx, job)
+	if err == nil {
+		fmt.Printf("Transcription saved to: %s\n", job.OutputFile)
+		return 0
+	}
+	
+	exitCode := 1
+	if errors.Is(err, ErrTranscriptionCanceled) {
+		if errors.Is(err, context.DeadlineExceeded) {
+			fmt.Printf("Transcription timed out after %s\n", timeout)
+		} else {
+			fmt.Println("Transcription canceled")
+			exitCode = 130
+		}
+	} else {
+		fmt.Printf("Error: %v\n", err)
+	}
+	if _, statErr := os.Stat(job.Dir()); statErr == nil {
+		fmt.Printf("The job was kept. Resume it with: OfflineTranscribe resume %s\n", job.ID)
+	}
+	return exitCode
+}
+
+// resumeJob continues an interrupted command line job where it stopped
+func (ot *OfflineTranscribe) resumeJob(ctx context.Context, id string) int {
+	store, err := OpenDefaultJobStore()
+	if err == nil {
+		var job *Job
+		if job, err = store.Load(id); err == nil {
+			err = checkResumable(job)
+			if err == nil {
+				return ot.runAndReport(ctx, job, 0)
+			}
+		}
+	}
+	fmt.Printf("Error: %v\n", err)
+	return 1
+}
+
+// checkResumable verifies a job can be resumed from the command line and
+// marks it as running again
+func checkResumable(job *Job) error {
+	switch {
+	case job.Source != JobSourceCLI:
+		return fmt.Errorf("job %s belongs to the web server, which resumes it when it starts", job.ID)
+	case job.Status == JobCompleted:
+		return fmt.Errorf("job %s has already completed", job.ID)
+	}
+	if err := job.CheckInput(); err != nil {
+		return err
+	}
+	job.Status = JobRunning
+	job.Error = ""
+	return job.Save()
+}
+
+// jobsCommand lists unfinished jobs, or removes one with "jobs remove <id>"
+func jobsCommand(args []string) error {
+	store, err := OpenDefaultJobStore()
 	if err != nil {
-		fmt.Printf("Error saving file: %v\n", err)
-		os.Exit(1)
+		return err
+	}
+	
+	if len(args) == 2 && args[0] == "remove" {
+		job, err := store.Load(args[1])
+		if err != nil {
+			return err
+		}
+		if err := job.Remove(); err != nil {
+			return fmt.Errorf("failed to remove job %s: %v", job.ID, err)
+		}
+		fmt.Printf("Removed job %s\n", job.ID)
+		return nil
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("usage: OfflineTranscribe jobs [remove <id>]")
+	}
+	
+	jobs, err := store.List()
+	if err != nil {
+		return err
+	}
+	if len(jobs) == 0 {
+		fmt.Println("No unfinished jobs")
+		return nil
+	}
+	fmt.Printf("%-23s %-6s %-10s %-16s %-12s %s\n", "ID", "SOURCE", "STATUS", "STARTED", "CHUNKS DONE", "INPUT")
+	for _, job := range jobs {
+		done, total := job.CheckpointProgress()
+		fmt.Printf("%-23s %-6s %-10s %-16s %-12s %s\n", job.ID, job.Source, job.Status,
+			job.Created.Format("2006-01-02 15:04"), fmt.Sprintf("%d/%d", done, total), job.InputName)
+		if job.Error != "" {
+			fmt.Printf("  %s\n", strings.SplitN(job.Error, "\n", 2)[0])
+		}
+	}
+	return nil
+}
+
+// cacheCommand lists, clears or prunes the transcript cache
+func cacheCommand(args []string) error {
+	size, err := DefaultCacheSize()
+	if err != nil {
+		return err
+	}
+	dir, err := DefaultCacheDir()
+	if err != nil {
+		return err
+	}
+	cache, err := OpenCache(dir, size)
+	if err != nil {
+		return err
+	}
+	
+	usage := fmt.Errorf("usage: OfflineTranscribe cache ls|clear|prune [-max <size>]")
+	if len(args) == 0 {
+		return usage
+	}
+	switch {
+	case args[0] == "ls" && len(args) == 1:
+		entries, err := cache.List()
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			fmt.Printf("The transcript cache in %s is empty\n", cache.Dir())
+			return nil
+		}
+		var total int64
+		fmt.Printf("%-16s %-10s %-10s %-16s %s\n", "KEY", "MODEL", "SIZE", "LAST USED", "INPUT")
+		for _, entry := range entries {
+			total += entry.Size
+			fmt.Printf("%-16s %-10s %-10s %-16s %s\n", entry.Key[:16], entry.Model, formatSize(entry.Size),
+				entry.LastUsed.Format("2006-01-02 15:04"), entry.Input)
+		}
+		fmt.Printf("%d transcripts, %s of %s in %s\n", len(entries), formatSize(total), formatSize(cache.MaxSize()), cache.Dir())
+	case args[0] == "clear" && len(args) == 1:
+		removed, err := cache.Clear()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Removed %d cached transcripts\n", removed)
+	case args[0] == "prune" && (len(args) == 1 || len(args) == 3 && args[1] == "-max"):
+		maxSize := cache.MaxSize()
+		if len(args) == 3 {
+			if maxSize, err = parseSize(args[2]); err != nil {
+				return err
+			}
+		}
+		removed, err := cache.Prune(maxSize)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Removed %d cached transcripts to fit in %s\n", removed, formatSize(maxSize))
+	default:
+		return usage
+	}
+	return nil
+}
+
+// formatSize formats a byte count for display, e.g. "1.5 MB"
+func formatSize(bytes int64) string {
+	switch {
+	case bytes >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(bytes)/(1<<30))
+	case bytes >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(bytes)/(1<<20))
+	case bytes >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(bytes)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", bytes)
+}
+
+// speakersCommand names the speakers of a transcript that was already saved,
+// rewriting its speaker labels in place
+func speakersCommand(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: OfflineTranscribe speakers <transcript> SPEAKER_1=Alice [SPEAKER_2=Bob ...]")
+	}
+	names, err := ParseSpeakerNames(strings.Join(args[1:], ","))
+	if err != nil {
+		return err
 	}
 	
-	fmt.Printf("Transcription saved to: %s\n", outputFile)
+	content, err := os.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to read transcript: %v", err)
+	}
+	if err := os.WriteFile(args[0], []byte(RenameSpeakers(string(content), names)), 0644); err != nil {
+		return fmt.Errorf("failed to write transcript: %v", err)
+	}
+	fmt.Printf("Named %d speakers in %s\n", len(names), args[0])
+	return nil
 }
\ No newline at end of file
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newFakeCLI returns the command line front-end on the fake engine, with
+// jobs kept in a temporary directory
+func newFakeCLI(t *testing.T) (*OfflineTranscribe, *FakeEngine) {
+	t.Helper()
+	t.Setenv("OFFLINETRANSCRIBE_JOBS_DIR", t.TempDir())
+	engine := NewFakeEngine()
+	return &OfflineTranscribe{transcriber: engine}, engine
+}
+
+func TestCLITranscribesWithFakeEngine(t *testing.T) {
+	ot, engine := newFakeCLI(t)
+	input := writeSpeechWAV(t, 2, 0, 2)
+	output := filepath.Join(t.TempDir(), "speech_transcription.txt")
+
+	opts := TranscribeOptions{ModelSize: "tiny", PostProcessing: []ProcessorConfig{{Name: "casing", Options: map[string]string{"style": "upper"}}}}
+	job, err := newCLIJob(input, output, opts, FormatOptions{Granularity: GranularitySentence})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := ot.runAndReport(context.Background(), job, 0); code != 0 {
+		t.Fatalf("exit code %d", code)
+	}
+
+	transcript, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"FAKE TRANSCRIPTION OF SPEECH.", "MODEL TINY WAS REQUESTED."} {
+		if !strings.Contains(string(transcript), want) {
+			t.Errorf("transcript %q does not contain %q", transcript, want)
+		}
+	}
+	if len(engine.Calls) != 1 || engine.Calls[0] != job.InputFile {
+		t.Errorf("engine calls = %v", engine.Calls)
+	}
+	// A finished job leaves nothing behind
+	if _, err := os.Stat(job.Dir()); !os.IsNotExist(err) {
+		t.Errorf("job directory kept after success: %v", err)
+	}
+}
+
+func TestCLIKeepsCanceledJob(t *testing.T) {
+	ot, engine := newFakeCLI(t)
+	engine.Delay = time.Minute
+	input := writeSpeechWAV(t, 2, 0, 2)
+	output := filepath.Join(t.TempDir(), "speech_transcription.txt")
+	job, err := newCLIJob(input, output, TranscribeOptions{}, FormatOptions{Granularity: GranularitySentence})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if code := ot.runAndReport(ctx, job, 50*time.Millisecond); code != 1 {
+		t.Errorf("exit code %d after a timeout, want 1", code)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Error("transcript written for a canceled job")
+	}
+
+	// The job is kept for resuming and finishes once the engine is quick
+	store, err := OpenDefaultJobStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, err := store.Load(job.ID)
+	if err != nil || kept.Status != JobFailed {
+		t.Fatalf("job = %+v, %v, want it kept as failed", kept, err)
+	}
+	engine.Delay = 0
+	if code := ot.resumeJob(context.Background(), job.ID); code != 0 {
+		t.Fatalf("resume exit code %d", code)
+	}
+	if _, err := os.Stat(output); err != nil {
+		t.Errorf("transcript not written on resume: %v", err)
+	}
+}
+
+func TestCLIRejectsInvalidAudio(t *testing.T) {
+	ot, engine := newFakeCLI(t)
+	input := filepath.Join(t.TempDir(), "notes.wav")
+	if err := os.WriteFile(input, []byte("not audio"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ot.processAudio(context.Background(), input, TranscribeOptions{}, FormatOptions{}); err == nil {
+		t.Fatal("processAudio accepted a file that is not audio")
+	}
+	if len(engine.Calls) != 0 {
+		t.Errorf("engine called for invalid audio: %v", engine.Calls)
+	}
+}
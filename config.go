@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ProjectConfigFile is the name of the per-project settings file. It is
+// looked up in the working directory and then in its parents, so every
+// recording below a project directory shares the same settings.
+const ProjectConfigFile = ".offlinetranscribe.json"
+
+// ProjectConfig holds per-project settings, e.g.
+//
+//	{
+//	  "glossary": ["Kubernetes", "OpenAI"],
+//	  "postProcessing": [
+//	    {"name": "glossary"},
+//	    {"name": "replace", "options": {"find": "gonna", "with": "going to"}},
+//	    {"name": "casing"}
+//	  ]
+//	}
+type ProjectConfig struct {
+	// Glossary lists the project's names and terms, used to prompt whisper
+	// and by the glossary processor, unless the command line or request
+	// gives a glossary of its own
+	Glossary []string `json:"glossary,omitempty"`
+
+	// PostProcessing is the pipeline of processors run on every transcript
+	// unless the command line or request chooses another
+	PostProcessing []ProcessorConfig `json:"postProcessing,omitempty"`
+
+	// path is the file the settings were read from, empty for defaults
+	path string
+}
+
+// LoadProjectConfig reads the settings file named by OFFLINETRANSCRIBE_CONFIG
+// or, failing that, the nearest ProjectConfigFile in dir or its parents.
+// Without a settings file the defaults are returned.
+func LoadProjectConfig(dir string) (*ProjectConfig, error) {
+	if path := strings.TrimSpace(os.Getenv("OFFLINETRANSCRIBE_CONFIG")); path != "" {
+		return ReadProjectConfig(path)
+	}
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		path := filepath.Join(dir, ProjectConfigFile)
+		if _, err := os.Stat(path); err == nil {
+			return ReadProjectConfig(path)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("cannot read project config: %v", err)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return &ProjectConfig{}, nil
+		}
+		dir = parent
+	}
+}
+
+// ReadProjectConfig reads and validates a settings file. Unknown fields are
+// rejected so that misspelled settings are not silently ignored.
+func ReadProjectConfig(path string) (*ProjectConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read project config: %v", err)
+	}
+
+	config := &ProjectConfig{path: path}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return nil, fmt.Errorf("invalid project config %s: %v", path, err)
+	}
+	var terms []string
+	for _, term := range config.Glossary {
+		if term = strings.TrimSpace(term); term == "" {
+			continue
+		}
+		if len([]rune(term)) > maxGlossaryTermChars {
+			return nil, fmt.Errorf("invalid project config %s: glossary term '%s' is longer than %d characters", path, term, maxGlossaryTermChars)
+		}
+		terms = append(terms, term)
+	}
+	config.Glossary = terms
+	if config.PostProcessing, err = normalizeProcessors(config.PostProcessing); err != nil {
+		return nil, fmt.Errorf("invalid project config %s: %v", path, err)
+	}
+	return config, nil
+}
+
+// Path returns the file the settings were read from, or "" for defaults
+func (c *ProjectConfig) Path() string {
+	return c.path
+}
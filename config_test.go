@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeProjectConfig(t *testing.T, dir, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, ProjectConfigFile)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadProjectConfig(t *testing.T) {
+	path := writeProjectConfig(t, t.TempDir(), `{
+		"glossary": [" Kubernetes ", "", "OpenAI"],
+		"postProcessing": [{"name": "Glossary"}, {"name": "casing", "options": {"style": "upper"}}]
+	}`)
+	config, err := ReadProjectConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(config.Glossary, ",") != "Kubernetes,OpenAI" {
+		t.Errorf("glossary = %q", config.Glossary)
+	}
+	if len(config.PostProcessing) != 2 || config.PostProcessing[0].Name != "glossary" || config.PostProcessing[1].Options["style"] != "upper" {
+		t.Errorf("postProcessing = %+v", config.PostProcessing)
+	}
+	if config.Path() != path {
+		t.Errorf("path = %q, want %q", config.Path(), path)
+	}
+}
+
+func TestReadProjectConfigErrors(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{`{"glosary": ["Go"]}`, `unknown field "glosary"`},
+		{`{"glossary": "Go"}`, "cannot unmarshal"},
+		{`{"postProcessing": [{"name": "shout"}]}`, "unknown processor 'shout'"},
+		{`{"postProcessing": [{"name": "casing", "options": {"style": "title"}}]}`, "unknown style 'title'"},
+		{`{`, "invalid project config"},
+		{`{"glossary": ["` + strings.Repeat("x", maxGlossaryTermChars+1) + `"]}`, "longer than 64 characters"},
+	}
+	for _, test := range tests {
+		path := writeProjectConfig(t, t.TempDir(), test.content)
+		if _, err := ReadProjectConfig(path); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("ReadProjectConfig(%s) = %v, want an error containing %q", test.content, err, test.want)
+		}
+	}
+	if _, err := ReadProjectConfig(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("ReadProjectConfig of a missing file succeeded")
+	}
+}
+
+// A project glossary longer than a prompt is cut from the prompt, but every
+// term still reaches the glossary processor
+func TestProjectGlossaryLongerThanPrompt(t *testing.T) {
+	var terms []string
+	for i := 0; i < 100; i++ {
+		terms = append(terms, fmt.Sprintf(`"ProductName%03d"`, i))
+	}
+	config, err := ReadProjectConfig(writeProjectConfig(t, t.TempDir(), `{"glossary": [`+strings.Join(terms, ", ")+`]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := TranscribeOptions{Prompt: "A product meeting.", Glossary: config.Glossary}.Normalize()
+	if err != nil {
+		t.Fatalf("Normalize failed for a long project glossary: %v", err)
+	}
+	prompt, err := buildPrompt(opts.Prompt, opts.Glossary)
+	if err != nil || len(prompt) > maxPromptChars || !strings.HasPrefix(prompt, "A product meeting. ProductName000, ") || !strings.HasSuffix(prompt, ".") {
+		t.Errorf("prompt = %q (%d characters), %v", prompt, len(prompt), err)
+	}
+
+	result := &TranscriptionResult{Options: opts, Segments: []Segment{timedSegment(0, 0.5, "we shipped productname099 today")}}
+	if err := RunProcessors(result, []ProcessorConfig{{Name: glossaryProcessor}}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(result.Text, "ProductName099") {
+		t.Errorf("text = %q, want the last term corrected", result.Text)
+	}
+}
+
+func TestLoadProjectConfigSearchesParents(t *testing.T) {
+	t.Setenv("OFFLINETRANSCRIBE_CONFIG", "")
+	project := t.TempDir()
+	path := writeProjectConfig(t, project, `{"glossary": ["Postgres"]}`)
+	dir := filepath.Join(project, "recordings", "2024")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadProjectConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Path() != path || len(config.Glossary) != 1 {
+		t.Errorf("config = %+v from %q, want %q", config, config.Path(), path)
+	}
+
+	// The environment variable wins over the search
+	other := writeProjectConfig(t, t.TempDir(), `{"glossary": ["Redis"]}`)
+	t.Setenv("OFFLINETRANSCRIBE_CONFIG", other)
+	if config, err := LoadProjectConfig(dir); err != nil || config.Glossary[0] != "Redis" {
+		t.Errorf("config = %+v, %v, want the one named by OFFLINETRANSCRIBE_CONFIG", config, err)
+	}
+}
@@ -0,0 +1,448 @@
+// Package diarize tells speakers apart in decoded PCM without a model: it
+// finds speaker changes in MFCC statistics and clusters the stretches in
+// between into speakers. It is meant as a fallback for mono recordings,
+// usable rather than state of the art.
+package diarize
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Config tunes speaker detection
+type Config struct {
+	// Speakers is the number of speakers, or 0 to estimate it
+	Speakers int
+
+	// MaxSpeakers bounds the estimated number of speakers
+	MaxSpeakers int
+
+	// Threshold is the distance between the voices of two clusters, in
+	// normalized MFCC units, above which they are kept apart when the
+	// number of speakers is estimated
+	Threshold float64
+
+	// Window is how much audio on each side of a point is compared to
+	// decide whether the speaker changes there
+	Window time.Duration
+
+	// MinTurn is the shortest stretch between two speaker changes
+	MinTurn time.Duration
+}
+
+// DefaultConfig returns settings that work for typical meetings and calls
+func DefaultConfig() Config {
+	return Config{
+		MaxSpeakers: 8,
+		Threshold:   0.6,
+		Window:      1500 * time.Millisecond,
+		MinTurn:     time.Second,
+	}
+}
+
+// Region is a span of speech in seconds from the start of the audio
+type Region struct {
+	Start float64
+	End   float64
+}
+
+// Turn is a span of speech attributed to one speaker. Speakers are
+// numbered from 0 in order of their first turn.
+type Turn struct {
+	Start   float64
+	End     float64
+	Speaker int
+}
+
+// changeStride is how many frames apart speaker changes are looked for
+const changeStride = 10
+
+// Source reads mono samples [start, end) of the audio, counted from its
+// beginning. Fewer samples are returned past the end of the audio.
+type Source func(start, end int64) ([]float32, error)
+
+// readBatch is how many frames of features are computed from one read of
+// the source, bounding the audio held at once
+const readBatch = 6000
+
+// Detect attributes the speech in regions of mono samples to speakers.
+// Regions are usually the segments a transcriber found; audio outside them
+// is ignored. Turns are returned in order.
+func Detect(samples []float32, sampleRate int, regions []Region, config Config) []Turn {
+	source := func(start, end int64) ([]float32, error) {
+		return samples[min(start, int64(len(samples))):min(end, int64(len(samples)))], nil
+	}
+	turns, _ := DetectSource(source, int64(len(samples)), sampleRate, regions, config)
+	return turns
+}
+
+// DetectSource is Detect for audio of total samples read from source. Only
+// the audio inside regions is read and analyzed, so long recordings never
+// have to be held in memory.
+func DetectSource(source Source, total int64, sampleRate int, regions []Region, config Config) ([]Turn, error) {
+	analyzer := newMFCC(sampleRate)
+	features := make([][]float64, analyzer.frames(int(total)))
+	toFrame := func(seconds float64) int {
+		frame := int(math.Round(seconds * float64(sampleRate) / float64(analyzer.step)))
+		return max(0, min(frame, len(features)))
+	}
+
+	speech := make([][2]int, len(regions))
+	for i, region := range regions {
+		speech[i] = [2]int{toFrame(region.Start), toFrame(region.End)}
+	}
+	if err := computeSpeech(analyzer, source, features, speech); err != nil {
+		return nil, err
+	}
+	stats := newFeatureStats(features, speech)
+	if stats == nil {
+		return nil, nil
+	}
+	window := max(1, int(config.Window.Seconds()/frameStep))
+	minTurn := max(1, int(config.MinTurn.Seconds()/frameStep))
+
+	// Score every candidate change point by how different the voice
+	// sounds before and after it
+	type candidate struct {
+		region, frame int
+		score         float64
+	}
+	var candidates []candidate
+	var sum, sumSquares float64
+	for r, region := range regions {
+		start, end := toFrame(region.Start), toFrame(region.End)
+		for frame := start + window; frame+window <= end; frame += changeStride {
+			score := distance(stats.embedding(frame-window, frame), stats.embedding(frame, frame+window))
+			candidates = append(candidates, candidate{r, frame, score})
+			sum += score
+			sumSquares += score * score
+		}
+	}
+
+	// Keep the clearest changes, one standard deviation above the mean
+	// score and at least minTurn apart
+	changes := make([][]int, len(regions))
+	if n := float64(len(candidates)); n > 0 {
+		mean := sum / n
+		cutoff := mean + math.Sqrt(math.Max(0, sumSquares/n-mean*mean))
+		sort.Slice(candidates, func(i, j int) bool {
+			return candidates[i].score > candidates[j].score
+		})
+	next:
+		for _, c := range candidates {
+			if c.score <= cutoff {
+				break
+			}
+			start, end := toFrame(regions[c.region].Start), toFrame(regions[c.region].End)
+			if c.frame-start < minTurn || end-c.frame < minTurn {
+				continue
+			}
+			for _, frame := range changes[c.region] {
+				if abs(frame-c.frame) < minTurn {
+					continue next
+				}
+			}
+			changes[c.region] = append(changes[c.region], c.frame)
+		}
+	}
+
+	// Split the regions at the changes into pieces spoken by one speaker
+	var pieces []piece
+	for r, region := range regions {
+		cuts := append([]int{}, changes[r]...)
+		sort.Ints(cuts)
+		start, end := toFrame(region.Start), toFrame(region.End)
+		bounds := append(append([]int{start}, cuts...), end)
+		times := make([]float64, len(bounds))
+		for i, frame := range bounds {
+			times[i] = float64(frame*analyzer.step) / float64(sampleRate)
+		}
+		times[0], times[len(times)-1] = region.Start, region.End
+		for i := 1; i < len(bounds); i++ {
+			if bounds[i] <= bounds[i-1] {
+				continue
+			}
+			pieces = append(pieces, piece{
+				start:     times[i-1],
+				end:       times[i],
+				embedding: stats.embedding(bounds[i-1], bounds[i]),
+				weight:    float64(bounds[i] - bounds[i-1]),
+			})
+		}
+	}
+	if len(pieces) == 0 {
+		return nil, nil
+	}
+
+	labels := cluster(pieces, config)
+	turns := make([]Turn, 0, len(pieces))
+	for i, p := range pieces {
+		if n := len(turns); n > 0 && turns[n-1].Speaker == labels[i] && turns[n-1].End >= p.start {
+			turns[n-1].End = p.end
+			continue
+		}
+		turns = append(turns, Turn{Start: p.start, End: p.end, Speaker: labels[i]})
+	}
+	return turns, nil
+}
+
+// computeSpeech fills in the features of the frames in speech, reading
+// each stretch of speech from source once, in batches of readBatch frames.
+// Features of other frames are left nil.
+func computeSpeech(analyzer *mfcc, source Source, features [][]float64, speech [][2]int) error {
+	spans := append([][2]int{}, speech...)
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i][0] < spans[j][0]
+	})
+	var merged [][2]int
+	for _, span := range spans {
+		if n := len(merged); n > 0 && span[0] <= merged[n-1][1] {
+			merged[n-1][1] = max(merged[n-1][1], span[1])
+			continue
+		}
+		merged = append(merged, span)
+	}
+
+	step, length := int64(analyzer.step), int64(analyzer.length)
+	for _, span := range merged {
+		for first := span[0]; first < span[1]; first += readBatch {
+			last := min(first+readBatch, span[1])
+			// One sample before the first frame is read for pre-emphasis
+			start := max(0, int64(first)*step-1)
+			samples, err := source(start, int64(last-1)*step+length)
+			if err != nil {
+				return err
+			}
+			for frame := first; frame < last; frame++ {
+				offset := int64(frame)*step - start
+				if offset+length > int64(len(samples)) {
+					break
+				}
+				previous := 0.0
+				if offset > 0 {
+					previous = float64(samples[offset-1])
+				}
+				features[frame] = analyzer.frame(samples[offset:offset+length], previous)
+			}
+		}
+	}
+	return nil
+}
+
+// piece is a stretch of speech with no speaker change detected inside
+type piece struct {
+	start, end float64
+	embedding  []float64
+	weight     float64
+}
+
+// featureStats answers mean and standard deviation queries over any range
+// of frames in constant time. Features are normalized to zero mean and
+// unit variance over the speech, so every coefficient counts alike.
+type featureStats struct {
+	dims       int
+	sum        [][]float64 // prefix sums, one row per frame boundary
+	sumSquares [][]float64
+}
+
+func newFeatureStats(features [][]float64, speech [][2]int) *featureStats {
+	if len(features) == 0 {
+		return nil
+	}
+	// The first coefficient measures loudness rather than voice
+	dims := cepstra - 1
+
+	mean := make([]float64, dims)
+	deviation := make([]float64, dims)
+	var count float64
+	for _, span := range speech {
+		for frame := span[0]; frame < span[1]; frame++ {
+			if features[frame] == nil {
+				continue
+			}
+			for d := 0; d < dims; d++ {
+				value := features[frame][d+1]
+				mean[d] += value
+				deviation[d] += value * value
+			}
+			count++
+		}
+	}
+	if count == 0 {
+		return nil
+	}
+	for d := range mean {
+		mean[d] /= count
+		deviation[d] = math.Sqrt(math.Max(deviation[d]/count-mean[d]*mean[d], 1e-10))
+	}
+
+	stats := &featureStats{
+		dims:       dims,
+		sum:        make([][]float64, len(features)+1),
+		sumSquares: make([][]float64, len(features)+1),
+	}
+	stats.sum[0] = make([]float64, dims)
+	stats.sumSquares[0] = make([]float64, dims)
+	for frame, feature := range features {
+		// Frames outside the speech add nothing and share the sums before
+		// them
+		if feature == nil {
+			stats.sum[frame+1] = stats.sum[frame]
+			stats.sumSquares[frame+1] = stats.sumSquares[frame]
+			continue
+		}
+		sum := make([]float64, dims)
+		sumSquares := make([]float64, dims)
+		for d := 0; d < dims; d++ {
+			value := (feature[d+1] - mean[d]) / deviation[d]
+			sum[d] = stats.sum[frame][d] + value
+			sumSquares[d] = stats.sumSquares[frame][d] + value*value
+		}
+		stats.sum[frame+1] = sum
+		stats.sumSquares[frame+1] = sumSquares
+	}
+	return stats
+}
+
+// embedding describes the voice in frames [start, end) by the mean and
+// standard deviation of each coefficient
+func (s *featureStats) embedding(start, end int) []float64 {
+	n := float64(end - start)
+	embedding := make([]float64, 2*s.dims)
+	for d := 0; d < s.dims; d++ {
+		mean := (s.sum[end][d] - s.sum[start][d]) / n
+		variance := (s.sumSquares[end][d]-s.sumSquares[start][d])/n - mean*mean
+		embedding[d] = mean
+		embedding[s.dims+d] = math.Sqrt(math.Max(variance, 0))
+	}
+	return embedding
+}
+
+// distance is the root mean square difference between two embeddings
+func distance(a, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		diff := a[i] - b[i]
+		sum += diff * diff
+	}
+	return math.Sqrt(sum / float64(len(a)))
+}
+
+// cluster groups pieces by voice with agglomerative clustering, merging the
+// two closest clusters, represented by their duration-weighted centroids,
+// until the requested or estimated number of speakers is left. It returns
+// each piece's speaker, numbered in order of first appearance.
+func cluster(pieces []piece, config Config) []int {
+	type group struct {
+		centroid []float64
+		weight   float64
+		members  []int
+		nearest  int
+		distance float64
+	}
+	groups := make([]*group, len(pieces))
+	for i, p := range pieces {
+		centroid := append([]float64{}, p.embedding...)
+		groups[i] = &group{centroid: centroid, weight: p.weight, members: []int{i}}
+	}
+
+	// findNearest updates a group's nearest neighbour among the others
+	findNearest := func(i int) {
+		groups[i].nearest, groups[i].distance = -1, math.Inf(1)
+		for j, other := range groups {
+			if j == i || other == nil {
+				continue
+			}
+			if d := distance(groups[i].centroid, other.centroid); d < groups[i].distance {
+				groups[i].nearest, groups[i].distance = j, d
+			}
+		}
+	}
+	for i := range groups {
+		findNearest(i)
+	}
+
+	maxSpeakers := config.MaxSpeakers
+	if maxSpeakers < 1 {
+		maxSpeakers = len(groups)
+	}
+	for remaining := len(groups); remaining > 1; remaining-- {
+		closest := -1
+		for i, g := range groups {
+			if g != nil && g.nearest >= 0 && (closest < 0 || g.distance < groups[closest].distance) {
+				closest = i
+			}
+		}
+		if closest < 0 {
+			break
+		}
+		a, b := groups[closest], groups[groups[closest].nearest]
+		if config.Speakers > 0 && remaining <= config.Speakers {
+			break
+		}
+		if config.Speakers <= 0 && remaining <= maxSpeakers && a.distance > config.Threshold {
+			break
+		}
+
+		// Merge b into a
+		weight := a.weight + b.weight
+		for d := range a.centroid {
+			a.centroid[d] = (a.centroid[d]*a.weight + b.centroid[d]*b.weight) / weight
+		}
+		a.weight = weight
+		a.members = append(a.members, b.members...)
+		merged := a.nearest
+		groups[merged] = nil
+
+		findNearest(closest)
+		for i, g := range groups {
+			if g == nil || i == closest {
+				continue
+			}
+			if g.nearest == closest || g.nearest == merged {
+				findNearest(i)
+			} else if d := distance(g.centroid, a.centroid); d < g.distance {
+				g.nearest, g.distance = closest, d
+			}
+		}
+	}
+
+	// Number speakers in order of their first piece
+	labels := make([]int, len(pieces))
+	for i := range labels {
+		labels[i] = -1
+	}
+	speakers := 0
+	for i := range pieces {
+		if labels[i] >= 0 {
+			continue
+		}
+		for _, g := range groups {
+			if g != nil && contains(g.members, i) {
+				for _, member := range g.members {
+					labels[member] = speakers
+				}
+				break
+			}
+		}
+		speakers++
+	}
+	return labels
+}
+
+func contains(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,122 @@
+package diarize
+
+import (
+	"math"
+	"testing"
+)
+
+const testRate = 16000
+
+// voice returns seconds of a buzz at pitch Hz shaped by one formant, a
+// crude stand-in for a speaker's voice
+func voice(seconds, pitch, formant float64) []float32 {
+	samples := make([]float32, int(seconds*testRate))
+	for i := range samples {
+		t := float64(i) / testRate
+		var value float64
+		for harmonic := 1; float64(harmonic)*pitch < 4000; harmonic++ {
+			frequency := float64(harmonic) * pitch
+			// Harmonics near the formant are loudest
+			gain := math.Exp(-math.Pow((frequency-formant)/400, 2))
+			value += gain * math.Sin(2*math.Pi*frequency*t)
+		}
+		samples[i] = float32(0.1 * value)
+	}
+	return samples
+}
+
+// conversation returns alternating turns of two voices with pauses, and
+// the turns as regions
+func conversation() ([]float32, []Region) {
+	var samples []float32
+	var regions []Region
+	for turn := 0; turn < 6; turn++ {
+		start := float64(len(samples)) / testRate
+		if turn%2 == 0 {
+			samples = append(samples, voice(3, 110, 500)...)
+		} else {
+			samples = append(samples, voice(3, 220, 2500)...)
+		}
+		regions = append(regions, Region{Start: start, End: float64(len(samples)) / testRate})
+		samples = append(samples, make([]float32, testRate)...)
+	}
+	return samples, regions
+}
+
+func TestDetectTwoSpeakers(t *testing.T) {
+	samples, regions := conversation()
+	turns := Detect(samples, testRate, regions, DefaultConfig())
+	if len(turns) != len(regions) {
+		t.Fatalf("turns = %+v, want one per region", turns)
+	}
+	for i, turn := range turns {
+		if turn.Speaker != i%2 {
+			t.Errorf("turn %d (%.1fs-%.1fs) has speaker %d, want %d", i, turn.Start, turn.End, turn.Speaker, i%2)
+		}
+	}
+
+	config := DefaultConfig()
+	config.Speakers = 1
+	for _, turn := range Detect(samples, testRate, regions, config) {
+		if turn.Speaker != 0 {
+			t.Errorf("one speaker requested, got speaker %d", turn.Speaker)
+		}
+	}
+}
+
+// Only the audio of the regions is read, and the result matches analysis
+// of the whole signal
+func TestDetectSourceReadsOnlySpeech(t *testing.T) {
+	samples, regions := conversation()
+	var read int64
+	source := func(start, end int64) ([]float32, error) {
+		for _, region := range regions {
+			if start < int64(region.Start*testRate)-1 && end > int64(region.Start*testRate)-testRate/2 {
+				t.Errorf("read %d-%d starts in the pause before %.1fs", start, end, region.Start)
+			}
+		}
+		end = min(end, int64(len(samples)))
+		read += end - start
+		return samples[start:end], nil
+	}
+
+	turns, err := DetectSource(source, int64(len(samples)), testRate, regions, DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Detect(samples, testRate, regions, DefaultConfig())
+	if len(turns) != len(want) {
+		t.Fatalf("turns = %+v, want %+v", turns, want)
+	}
+	for i := range want {
+		if turns[i] != want[i] {
+			t.Errorf("turn %d = %+v, want %+v", i, turns[i], want[i])
+		}
+	}
+	if speech := int64(18 * testRate); read > speech+int64(len(regions))*testRate/10 {
+		t.Errorf("read %d samples for %d of speech", read, speech)
+	}
+}
+
+func TestDetectWithoutSpeech(t *testing.T) {
+	if turns := Detect(make([]float32, testRate), testRate, nil, DefaultConfig()); turns != nil {
+		t.Errorf("turns = %+v without regions", turns)
+	}
+}
+
+func TestMFCCFrames(t *testing.T) {
+	analyzer := newMFCC(testRate)
+	samples := voice(1, 150, 800)
+	features := analyzer.compute(samples)
+	if len(features) != analyzer.frames(len(samples)) || len(features[0]) != cepstra {
+		t.Fatalf("got %d frames of %d coefficients", len(features), len(features[0]))
+	}
+	// A frame computed alone matches the same frame of the whole signal
+	start := 10 * analyzer.step
+	frame := analyzer.frame(samples[start:start+analyzer.length], float64(samples[start-1]))
+	for i := range frame {
+		if frame[i] != features[10][i] {
+			t.Fatalf("frame = %v, want %v", frame, features[10])
+		}
+	}
+}
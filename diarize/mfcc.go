@@ -0,0 +1,174 @@
+package diarize
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// MFCC analysis parameters, the usual choice for speech at 16 kHz
+const (
+	frameLength   = 25 * 0.001 // seconds
+	frameStep     = 10 * 0.001 // seconds
+	melFilters    = 26
+	cepstra       = 13
+	preEmphasis   = 0.97
+	lowFrequency  = 20.0
+	highFrequency = 7600.0
+)
+
+// mfcc computes mel-frequency cepstral coefficients of mono samples, one
+// vector of cepstra coefficients every frameStep
+type mfcc struct {
+	sampleRate int
+	length     int
+	step       int
+	fftSize    int
+	window     []float64
+	filters    [][]float64
+
+	// Scratch buffers reused from frame to frame
+	spectrum []complex128
+	energies []float64
+}
+
+func newMFCC(sampleRate int) *mfcc {
+	length := int(frameLength * float64(sampleRate))
+	fftSize := 1
+	for fftSize < length {
+		fftSize *= 2
+	}
+
+	window := make([]float64, length)
+	for i := range window {
+		window[i] = 0.54 - 0.46*math.Cos(2*math.Pi*float64(i)/float64(length-1))
+	}
+
+	return &mfcc{
+		sampleRate: sampleRate,
+		length:     length,
+		step:       int(frameStep * float64(sampleRate)),
+		fftSize:    fftSize,
+		window:     window,
+		filters:    melFilterbank(sampleRate, fftSize),
+	}
+}
+
+// melFilterbank builds triangular filters spaced evenly on the mel scale
+func melFilterbank(sampleRate, fftSize int) [][]float64 {
+	toMel := func(hz float64) float64 { return 2595 * math.Log10(1+hz/700) }
+	toHz := func(mel float64) float64 { return 700 * (math.Pow(10, mel/2595) - 1) }
+
+	high := math.Min(highFrequency, float64(sampleRate)/2)
+	low, span := toMel(lowFrequency), toMel(high)-toMel(lowFrequency)
+	bins := make([]int, melFilters+2)
+	for i := range bins {
+		hz := toHz(low + span*float64(i)/float64(melFilters+1))
+		bins[i] = int(math.Floor(float64(fftSize+1) * hz / float64(sampleRate)))
+	}
+
+	filters := make([][]float64, melFilters)
+	for m := range filters {
+		filter := make([]float64, fftSize/2+1)
+		left, center, right := bins[m], bins[m+1], bins[m+2]
+		for k := left; k < center; k++ {
+			filter[k] = float64(k-left) / float64(center-left)
+		}
+		for k := center; k < right && k < len(filter); k++ {
+			filter[k] = float64(right-k) / float64(right-center)
+		}
+		filters[m] = filter
+	}
+	return filters
+}
+
+// frames returns the number of feature vectors for n samples
+func (m *mfcc) frames(n int) int {
+	if n < m.length {
+		return 0
+	}
+	return (n-m.length)/m.step + 1
+}
+
+// compute returns the features of samples, frame by frame
+func (m *mfcc) compute(samples []float32) [][]float64 {
+	features := make([][]float64, m.frames(len(samples)))
+	for f := range features {
+		start := f * m.step
+		previous := 0.0
+		if start > 0 {
+			previous = float64(samples[start-1])
+		}
+		features[f] = m.frame(samples[start:start+m.length], previous)
+	}
+	return features
+}
+
+// frame returns the features of one frame of samples; previous is the
+// sample before it, for pre-emphasis
+func (m *mfcc) frame(samples []float32, previous float64) []float64 {
+	if m.spectrum == nil {
+		m.spectrum = make([]complex128, m.fftSize)
+		m.energies = make([]float64, melFilters)
+	}
+	spectrum, energies := m.spectrum, m.energies
+	for i := range spectrum {
+		spectrum[i] = 0
+	}
+	for i := 0; i < m.length; i++ {
+		sample := float64(samples[i])
+		spectrum[i] = complex((sample-preEmphasis*previous)*m.window[i], 0)
+		previous = sample
+	}
+	fft(spectrum)
+
+	for j, filter := range m.filters {
+		var energy float64
+		for k, weight := range filter {
+			if weight != 0 {
+				power := cmplx.Abs(spectrum[k])
+				energy += weight * power * power / float64(m.fftSize)
+			}
+		}
+		energies[j] = math.Log(energy + 1e-10)
+	}
+	return dct(energies, cepstra)
+}
+
+// dct returns the first n coefficients of the DCT-II of x
+func dct(x []float64, n int) []float64 {
+	coefficients := make([]float64, n)
+	for k := range coefficients {
+		var sum float64
+		for i, value := range x {
+			sum += value * math.Cos(math.Pi*float64(k)*(float64(i)+0.5)/float64(len(x)))
+		}
+		coefficients[k] = sum
+	}
+	return coefficients
+}
+
+// fft transforms x in place; its length must be a power of two
+func fft(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				even, odd := x[start+k], w*x[start+k+size/2]
+				x[start+k], x[start+k+size/2] = even+odd, even-odd
+				w *= step
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// Engine is a speech-to-text backend shared by the CLI, web and GUI front-ends
+type Engine interface {
+	// LoadModel checks that the requested model can be used by the engine
+	LoadModel(modelSize string) error
+
+	// TranscribeContext converts an audio file to a transcription result.
+	// It stops early and returns ErrTranscriptionCanceled when ctx is done.
+	TranscribeContext(ctx context.Context, inputFile string, opts TranscribeOptions) (*TranscriptionResult, error)
+
+	// Capabilities reports which optional features the engine supports
+	Capabilities() EngineCapabilities
+
+	// Close releases any resources held by the engine
+	Close()
+}
+
+// ErrTranscriptionCanceled is returned when a transcription is stopped
+// because its context was canceled or its deadline expired
+var ErrTranscriptionCanceled = errors.New("transcription canceled")
+
+// canceledError wraps the context error so callers can match either
+// ErrTranscriptionCanceled or the underlying context error
+func canceledError(ctx context.Context) error {
+	return fmt.Errorf("%w: %w", ErrTranscriptionCanceled, ctx.Err())
+}
+
+// EngineCapabilities describes the optional features of an engine
+type EngineCapabilities struct {
+	Name              string
+	Models            []string
+	WordTimestamps    bool
+	Progress          bool
+	LanguageDetection bool
+	Translation       bool
+	Diarization       bool
+}
+
+// Supported engine backends
+const (
+	EngineWhisperCLI = "whisper-cli"
+	EngineFake       = "fake"
+)
+
+// EngineConfig selects and configures the transcription backend
+type EngineConfig struct {
+	Backend string
+}
+
+// LoadEngineConfig reads the engine configuration from the environment.
+// OFFLINETRANSCRIBE_ENGINE selects the backend (default: whisper-cli).
+func LoadEngineConfig() EngineConfig {
+	config := EngineConfig{
+		Backend: EngineWhisperCLI,
+	}
+
+	if backend := strings.TrimSpace(os.Getenv("OFFLINETRANSCRIBE_ENGINE")); backend != "" {
+		config.Backend = strings.ToLower(backend)
+	}
+
+	return config
+}
+
+// NeedsResources reports whether the configured backend relies on the
+// embedded whisper executable and models
+func (c EngineConfig) NeedsResources() bool {
+	return c.Backend != EngineFake
+}
+
+// NewEngine creates the transcription backend selected by config
+func NewEngine(config EngineConfig, resourceManager *ResourceManager) (Engine, error) {
+	switch config.Backend {
+	case EngineWhisperCLI, "":
+		if resourceManager == nil {
+			return nil, fmt.Errorf("engine %s requires extracted resources", EngineWhisperCLI)
+		}
+		transcriber := NewWhisperTranscriber(resourceManager)
+		// Transcription works without the cache, e.g. on a read-only home
+		// directory, so failing to open it only costs the speed-up
+		cache, err := OpenDefaultCache()
+		if err != nil {
+			log.Printf("Transcript cache disabled: %v", err)
+		}
+		transcriber.cache = cache
+		return transcriber, nil
+	case EngineFake:
+		return NewFakeEngine(), nil
+	default:
+		return nil, fmt.Errorf("unknown engine '%s'. Available engines: %s, %s", config.Backend, EngineWhisperCLI, EngineFake)
+	}
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// glossaryProcessor is the name the glossary correction is registered under
+const glossaryProcessor = "glossary"
+
+// Actions of the glossary correction
+const (
+	glossaryApply   = "apply"
+	glossaryPropose = "propose"
+)
+
+// Glossary matching defaults
+const (
+	// defaultGlossaryScore is the lowest match score, from 0 to 1, at which
+	// transcript words are taken for a misheard glossary term
+	defaultGlossaryScore = 0.75
+
+	// minFuzzyTermLetters is the length a term needs before it is matched
+	// by sound and spelling; shorter terms only have their case fixed, as
+	// they resemble too many ordinary words
+	minFuzzyTermLetters = 5
+
+	// extraGlossaryWords is how many more words than a term has whisper may
+	// have split it into, e.g. "Kubernetes" heard as "Cooper Netties"
+	extraGlossaryWords = 2
+)
+
+// tokenRegex finds the words of a segment's text
+var tokenRegex = regexp.MustCompile(`\S+`)
+
+func init() {
+	RegisterProcessor(glossaryProcessor, "Correct misheard names and terms from the glossary by sound and spelling: terms=<a|b>, file=<glossary file>, action=apply or propose, minscore=<0-1>", newGlossaryProcessor)
+	RegisterFileOptions(glossaryProcessor, "file")
+}
+
+// glossaryTerm is a glossary entry prepared for matching
+type glossaryTerm struct {
+	text     string
+	letters  string // lower-case letters and digits only
+	phonetic string
+	words    int
+}
+
+// glossaryCorrectionProcessor replaces words that sound and look like a
+// glossary term with the term, e.g. "Cooper Netties" with "Kubernetes".
+// Without terms of its own it uses the glossary the transcript was
+// prompted with.
+type glossaryCorrectionProcessor struct {
+	terms    []string
+	action   string
+	minScore float64
+}
+
+func newGlossaryProcessor(options map[string]string) (Processor, error) {
+	if err := checkProcessorOptions(options, "terms", "file", "action", "minscore"); err != nil {
+		return nil, err
+	}
+	processor := &glossaryCorrectionProcessor{action: options["action"], terms: splitList(options["terms"])}
+	switch processor.action {
+	case "":
+		processor.action = glossaryApply
+	case glossaryApply, glossaryPropose:
+	default:
+		return nil, fmt.Errorf("unknown action '%s'. Available actions: %s, %s", processor.action, glossaryApply, glossaryPropose)
+	}
+	if path := options["file"]; path != "" {
+		terms, err := LoadGlossary(path)
+		if err != nil {
+			return nil, err
+		}
+		processor.terms = append(processor.terms, terms...)
+	}
+
+	var err error
+	if processor.minScore, err = processorFloat(options, "minscore", defaultGlossaryScore, 0.5, 1); err != nil {
+		return nil, err
+	}
+	return processor, nil
+}
+
+// glossaryMatch is a run of tokens of a segment that matches a term
+type glossaryMatch struct {
+	first, last int // token indexes
+	term        *glossaryTerm
+	score       float64
+}
+
+// Process corrects each segment. Words merged into one term keep the
+// start of the first and the end of the last, so word timestamps still
+// cover the same audio. Every correction or proposal is listed in the step's
+// details with its time and score.
+func (p *glossaryCorrectionProcessor) Process(result *TranscriptionResult, step *ProcessingStep) error {
+	terms := p.terms
+	if len(terms) == 0 {
+		terms = result.Options.Glossary
+	}
+	prepared := prepareGlossary(terms)
+	if len(prepared) == 0 {
+		step.Details = append(step.Details, "no glossary terms to match")
+		return nil
+	}
+
+	for i := range result.Segments {
+		segment := &result.Segments[i]
+		matches, cores := p.findMatches(segment.Text, prepared)
+
+		// Words that no longer line up with the text, e.g. after a replace,
+		// are matched on their own so they get the same corrections
+		spans, aligned := wordSpans(segment.Text, segment.Words)
+		wordMatches, wordCores := matches, cores
+		if !aligned && len(segment.Words) > 0 {
+			var joined string
+			joined, spans = joinWords(segment.Words)
+			wordMatches, wordCores = p.findMatches(joined, prepared)
+		}
+		if len(matches) == 0 && len(wordMatches) == 0 {
+			continue
+		}
+
+		verb := "replaced"
+		if p.action == glossaryPropose {
+			verb = "could replace"
+		}
+		var text strings.Builder
+		previous := 0
+		for _, match := range matches {
+			start, end := cores[match.first][0], cores[match.last][1]
+			when := segment.Start
+			if aligned {
+				if first, _, ok := overlappingWords(spans, start, end); ok {
+					when = segment.Words[first].Start
+				}
+			}
+			step.Details = append(step.Details, fmt.Sprintf("[%s] %s %q with %q (%.0f%% match)",
+				formatTimestampMillis(when), verb, segment.Text[start:end], match.term.text, match.score*100))
+			text.WriteString(segment.Text[previous:start])
+			text.WriteString(match.term.text)
+			previous = end
+		}
+		if p.action == glossaryPropose {
+			continue
+		}
+
+		// Words are replaced from the end so the spans found above stay valid
+		for k := len(wordMatches) - 1; k >= 0; k-- {
+			start, end := wordCores[wordMatches[k].first][0], wordCores[wordMatches[k].last][1]
+			segment.Words = spliceWords(segment.Words, spans, start, end, wordMatches[k].term.text)
+		}
+		text.WriteString(segment.Text[previous:])
+		segment.Text = text.String()
+		step.Changes++
+	}
+	return nil
+}
+
+// findMatches finds the glossary terms text should be corrected to, along
+// with the byte range of each token of text without its punctuation. Terms
+// the text already spells exactly are not returned.
+func (p *glossaryCorrectionProcessor) findMatches(text string, terms []glossaryTerm) ([]glossaryMatch, [][2]int) {
+	tokens := tokenRegex.FindAllStringIndex(text, -1)
+	cores := make([][2]int, len(tokens))
+	for j, token := range tokens {
+		cores[j] = tokenCore(text, token)
+	}
+
+	var matches []glossaryMatch
+	for first := 0; first < len(tokens); first++ {
+		match, ok := p.bestMatch(text, cores, first, terms)
+		if !ok {
+			continue
+		}
+		first = match.last
+		if text[cores[match.first][0]:cores[match.last][1]] != match.term.text {
+			matches = append(matches, match)
+		}
+	}
+	return matches, cores
+}
+
+// bestMatch finds the term best matched by the tokens starting at first.
+// Tokens that already spell a term exactly are matched right away, so the
+// caller can skip them.
+func (p *glossaryCorrectionProcessor) bestMatch(text string, cores [][2]int, first int, terms []glossaryTerm) (glossaryMatch, bool) {
+	best := glossaryMatch{}
+	found := false
+	for t := range terms {
+		term := &terms[t]
+		for last := first; last < len(cores) && last-first < term.words+extraGlossaryWords; last++ {
+			heard := text[cores[first][0]:cores[last][1]]
+			if cores[first][0] >= cores[first][1] || cores[last][0] >= cores[last][1] {
+				break
+			}
+			if heard == term.text {
+				return glossaryMatch{first: first, last: last, term: term, score: 1}, true
+			}
+			score := p.score(heard, last-first+1, term)
+			if score >= p.minScore && (!found || score > best.score) {
+				best = glossaryMatch{first: first, last: last, term: term, score: score}
+				found = true
+			}
+		}
+	}
+	return best, found
+}
+
+// score rates how much heard sounds and looks like term, from 0 to 1.
+// Letter case, spaces and punctuation are ignored, so "open ai" is a
+// perfect match for "OpenAI".
+func (p *glossaryCorrectionProcessor) score(heard string, words int, term *glossaryTerm) float64 {
+	letters := glossaryLetters(heard)
+	if letters == "" {
+		return 0
+	}
+	if letters == term.letters {
+		return 1
+	}
+	if len(term.letters) < minFuzzyTermLetters || words < term.words {
+		return 0
+	}
+	// A misheard term keeps roughly its length and its first sound
+	length, termLength := utf8.RuneCountInString(letters), utf8.RuneCountInString(term.letters)
+	if length*2 < termLength || length > termLength*2 {
+		return 0
+	}
+	phonetic := phoneticKey(letters)
+	if phonetic == "" || term.phonetic == "" || phonetic[0] != term.phonetic[0] {
+		return 0
+	}
+	sound := similarity(phonetic, term.phonetic)
+	spelling := similarity(letters, term.letters)
+	return 0.6*sound + 0.4*spelling
+}
+
+// prepareGlossary computes the matching keys of each term
+func prepareGlossary(terms []string) []glossaryTerm {
+	var prepared []glossaryTerm
+	for _, term := range terms {
+		term = strings.TrimSpace(term)
+		letters := glossaryLetters(term)
+		if letters == "" {
+			continue
+		}
+		prepared = append(prepared, glossaryTerm{
+			text:     term,
+			letters:  letters,
+			phonetic: phoneticKey(letters),
+			words:    len(strings.Fields(term)),
+		})
+	}
+	return prepared
+}
+
+// tokenCore returns the part of a token without leading and trailing
+// punctuation, so a correction keeps the punctuation around it
+func tokenCore(text string, token []int) [2]int {
+	start, end := token[0], token[1]
+	for start < end {
+		r, size := utf8.DecodeRuneInString(text[start:end])
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			break
+		}
+		start += size
+	}
+	for end > start {
+		r, size := utf8.DecodeLastRuneInString(text[start:end])
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			break
+		}
+		end -= size
+	}
+	return [2]int{start, end}
+}
+
+// overlappingWords returns the first and last word overlapping the byte
+// range start to end of the segment text
+func overlappingWords(spans [][2]int, start, end int) (first, last int, ok bool) {
+	first, last = -1, -1
+	for i, span := range spans {
+		if span[1] <= start || span[0] >= end {
+			continue
+		}
+		if first < 0 {
+			first = i
+		}
+		last = i
+	}
+	return first, last, first >= 0
+}
+
+// spliceWords replaces the text between start and end with replacement in
+// the words overlapping it. The overlapping words become one word that
+// starts when the first began and ends when the last ended.
+func spliceWords(words []Word, spans [][2]int, start, end int, replacement string) []Word {
+	first, last, ok := overlappingWords(spans, start, end)
+	if !ok {
+		return words
+	}
+	merged := words[first]
+	merged.Text = words[first].Text[:start-spans[first][0]] + replacement + words[last].Text[end-spans[last][0]:]
+	merged.End = words[last].End
+	if last > first {
+		// The merged word is as certain as its least certain part
+		for _, word := range words[first+1 : last+1] {
+			merged.Probability = min(merged.Probability, word.Probability)
+		}
+	}
+
+	spliced := append([]Word{}, words[:first]...)
+	spliced = append(spliced, merged)
+	return append(spliced, words[last+1:]...)
+}
+
+// glossaryLetters lower-cases text and keeps only its letters and digits
+func glossaryLetters(text string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, text)
+}
+
+// phoneticKey encodes how an English word sounds, in the spirit of
+// Metaphone: letters that sound alike share a code, vowels after the first
+// letter are dropped and repeated codes are collapsed, so "kubernetes" and
+// "cooperneties" both become "KPRNTS"
+func phoneticKey(word string) string {
+	word = strings.ToLower(word)
+	for _, prefix := range []string{"kn", "gn", "pn", "wr", "ps"} {
+		if strings.HasPrefix(word, prefix) {
+			word = word[1:]
+			break
+		}
+	}
+	replacer := strings.NewReplacer("ph", "f", "ck", "k", "sch", "sk", "sh", "x", "ch", "x", "th", "0",
+		"gh", "", "qu", "kw", "dg", "j", "wh", "w")
+	word = replacer.Replace(word)
+
+	var key []byte
+	runes := []rune(word)
+	for i, r := range runes {
+		next := rune(0)
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
+		var code byte
+		switch r {
+		case 'a', 'e', 'i', 'o', 'u', 'y':
+			if i == 0 {
+				code = 'A'
+			}
+		case 'b', 'p':
+			code = 'P'
+		case 'f', 'v':
+			code = 'F'
+		case 'c':
+			if next == 'e' || next == 'i' || next == 'y' {
+				code = 'S'
+			} else {
+				code = 'K'
+			}
+		case 'g', 'k', 'q':
+			code = 'K'
+		case 'j':
+			code = 'J'
+		case 's', 'z':
+			code = 'S'
+		case 'x':
+			if i == 0 {
+				code = 'S'
+			} else {
+				key = append(key, 'K')
+				code = 'S'
+			}
+		case 'd', 't':
+			code = 'T'
+		case 'l':
+			code = 'L'
+		case 'm', 'n':
+			code = 'N'
+		case 'r':
+			code = 'R'
+		case '0':
+			code = '0'
+		default:
+			if unicode.IsDigit(r) {
+				code = byte('0' + r%10)
+			}
+		}
+		if code != 0 && (len(key) == 0 || key[len(key)-1] != code) {
+			key = append(key, code)
+		}
+	}
+	return string(key)
+}
+
+// similarity is 1 minus the edit distance of a and b relative to the longer
+// of the two, so equal strings score 1
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(editDistance(ra, rb))/float64(longest)
+}
+
+// editDistance is the Levenshtein distance: the fewest insertions,
+// deletions and substitutions turning a into b
+func editDistance(a, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
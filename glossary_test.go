@@ -0,0 +1,113 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func correctGlossary(t *testing.T, options map[string]string, segments ...Segment) *TranscriptionResult {
+	t.Helper()
+	result := &TranscriptionResult{Language: "en", Segments: segments}
+	if err := RunProcessors(result, []ProcessorConfig{{Name: "glossary", Options: options}}); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestGlossaryCorrects(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"We deploy on cooper netties today.", "We deploy on Kubernetes today."},
+		{"Ask open ai about it.", "Ask OpenAI about it."},
+		{"Kubernetes is spelled right.", "Kubernetes is spelled right."},
+		{"The cat sat on the mat.", "The cat sat on the mat."},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			result := correctGlossary(t, map[string]string{"terms": "Kubernetes|OpenAI"}, timedSegment(0, 0.5, test.text))
+			segment := result.Segments[0]
+			if segment.Text != test.want {
+				t.Errorf("text = %q, want %q", segment.Text, test.want)
+			}
+			if words := wordTexts(segment.Words); words != segment.Text {
+				t.Errorf("words = %q, want them to spell the text", words)
+			}
+		})
+	}
+}
+
+func TestGlossaryMergesWordTimes(t *testing.T) {
+	result := correctGlossary(t, map[string]string{"terms": "Kubernetes"}, timedSegment(0, 1, "on cooper netties now"))
+	words := result.Segments[0].Words
+	if len(words) != 3 || words[1].Text != "Kubernetes" || words[1].Start != 1 || words[1].End != 3 {
+		t.Fatalf("words = %+v, want Kubernetes spanning 1s-3s", words)
+	}
+	details := result.Processing[0].Details
+	if len(details) != 1 || !strings.Contains(details[0], `replaced "cooper netties" with "Kubernetes"`) || !strings.HasPrefix(details[0], "[00:00:01") {
+		t.Errorf("details = %q", details)
+	}
+}
+
+func TestGlossaryPropose(t *testing.T) {
+	segment := timedSegment(0, 0.5, "We deploy on cooper netties.")
+	result := correctGlossary(t, map[string]string{"terms": "Kubernetes", "action": "propose"}, segment)
+	if result.Segments[0].Text != segment.Text || result.Processing[0].Changes != 0 {
+		t.Errorf("propose changed the segment: %q", result.Segments[0].Text)
+	}
+	if details := result.Processing[0].Details; len(details) != 1 || !strings.Contains(details[0], "could replace") {
+		t.Errorf("details = %q", details)
+	}
+}
+
+func TestGlossaryUsesOptionsGlossary(t *testing.T) {
+	result := &TranscriptionResult{Language: "en", Options: TranscribeOptions{Glossary: []string{"Postgres"}},
+		Segments: []Segment{timedSegment(0, 0.5, "Store it in post gress.")}}
+	if err := RunProcessors(result, []ProcessorConfig{{Name: "glossary"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := result.Segments[0].Text; got != "Store it in Postgres." {
+		t.Errorf("text = %q", got)
+	}
+}
+
+// Words left stale by a text-only edit get the same corrections as the
+// text, so word output does not bring the misheard term back
+func TestGlossaryWordsThatDisagreeWithText(t *testing.T) {
+	segment := timedSegment(0, 0.5, "So we deploy on cooper netties.")
+	segment.Text = "We deploy on cooper netties."
+	result := correctGlossary(t, map[string]string{"terms": "Kubernetes"}, segment)
+
+	got := result.Segments[0]
+	if got.Text != "We deploy on Kubernetes." {
+		t.Errorf("text = %q", got.Text)
+	}
+	if words := wordTexts(got.Words); words != "So we deploy on Kubernetes." {
+		t.Errorf("words = %q", words)
+	}
+	if word := got.Words[4]; word.Start != 2 || word.End != 3 {
+		t.Errorf("merged word = %+v", word)
+	}
+}
+
+func TestGlossaryOptions(t *testing.T) {
+	for _, options := range []map[string]string{
+		{"action": "fix"},
+		{"minscore": "0.2"},
+		{"file": "/does/not/exist"},
+	} {
+		if _, err := newGlossaryProcessor(options); err == nil {
+			t.Errorf("options %v accepted", options)
+		}
+	}
+}
+
+func TestPhoneticKey(t *testing.T) {
+	if a, b := phoneticKey("kubernetes"), phoneticKey("cooperneties"); a != b {
+		t.Errorf("phoneticKey = %q and %q, want equal keys", a, b)
+	}
+	if got := similarity("kitten", "sitting"); got < 0.57 || got > 0.58 {
+		t.Errorf("similarity = %v, want 4/7", got)
+	}
+}
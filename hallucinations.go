@@ -0,0 +1,327 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Hallucination filter defaults
+const (
+	// defaultLoopRepeats is how often a phrase must repeat back to back
+	// before it counts as a decoding loop
+	defaultLoopRepeats = 4
+
+	// maxLoopPhrase is the longest phrase, in words, checked for loops
+	maxLoopPhrase = 12
+
+	// defaultMaxSpeakingRate is the fastest plausible speech in words per
+	// second. Fast speakers reach five or six; the rest is a margin for
+	// whisper's segment timings, which are often too short.
+	defaultMaxSpeakingRate = 8.0
+
+	// minRateWords is the fewest words a segment needs before its speaking
+	// rate is judged, as short segments often have clipped timings
+	minRateWords = 3
+
+	// defaultMinConfidence is the mean word probability below which a
+	// stock phrase is taken for a hallucination
+	defaultMinConfidence = 0.5
+)
+
+// hallucinationsProcessor is the name the filter is registered under
+const hallucinationsProcessor = "hallucinations"
+
+// Actions of the hallucination filter
+const (
+	hallucinationRemove = "remove"
+	hallucinationFlag   = "flag"
+)
+
+// hallucinationPhrases are stock phrases whisper tends to invent over
+// silence or noise, learned from subtitled videos in its training data.
+// They are only dropped when whisper was unsure of them and they make up the
+// whole segment, since people do say "thank you".
+var hallucinationPhrases = []string{
+	"thanks for watching",
+	"thank you for watching",
+	"thank you so much for watching",
+	"thanks for watching and see you next time",
+	"please subscribe",
+	"please like and subscribe",
+	"like and subscribe",
+	"subscribe to my channel",
+	"don't forget to subscribe",
+	"see you in the next video",
+	"subtitles by the amara org community",
+	"thank you",
+	"you",
+	"bye",
+	"untertitel der amara org community",
+	"untertitelung des zdf",
+	"sous titrage st' 501",
+	"sous titres réalisés para la communauté d'amara org",
+	"subtítulos realizados por la comunidad de amara org",
+	"amara org",
+}
+
+// hallucinationCredits open the credit lines of subtitled videos, which go
+// on with a name, e.g. "Subtitles by Jane Doe"
+var hallucinationCredits = []string{
+	"subtitles by",
+	"transcribed by",
+}
+
+func init() {
+	RegisterProcessor(hallucinationsProcessor, "Remove repetition loops, unsure stock phrases and impossibly fast speech: action=remove or flag, repeats=<n>, maxrate=<words/s>, minconfidence=<0-1>", newHallucinationProcessor)
+}
+
+// hallucinationProcessor finds text whisper produced without anyone
+// saying it: the same phrase repeated in a loop, stock phrases such as
+// "Thanks for watching" decoded with low confidence, and segments with more
+// words than could be spoken in their time
+type hallucinationProcessor struct {
+	action        string
+	repeats       int
+	maxRate       float64
+	minConfidence float64
+}
+
+func newHallucinationProcessor(options map[string]string) (Processor, error) {
+	if err := checkProcessorOptions(options, "action", "repeats", "maxrate", "minconfidence"); err != nil {
+		return nil, err
+	}
+	processor := &hallucinationProcessor{action: options["action"]}
+	switch processor.action {
+	case "":
+		processor.action = hallucinationRemove
+	case hallucinationRemove, hallucinationFlag:
+	default:
+		return nil, fmt.Errorf("unknown action '%s'. Available actions: %s, %s", processor.action, hallucinationRemove, hallucinationFlag)
+	}
+
+	var err error
+	if processor.repeats, err = processorInt(options, "repeats", defaultLoopRepeats, 2, 100); err != nil {
+		return nil, err
+	}
+	if processor.maxRate, err = processorFloat(options, "maxrate", defaultMaxSpeakingRate, 1, 100); err != nil {
+		return nil, err
+	}
+	if processor.minConfidence, err = processorFloat(options, "minconfidence", defaultMinConfidence, 0, 1); err != nil {
+		return nil, err
+	}
+	return processor, nil
+}
+
+// Process checks every segment and removes or flags what it finds. Each
+// finding is listed in the step's details with its time and reason.
+func (p *hallucinationProcessor) Process(result *TranscriptionResult, step *ProcessingStep) error {
+	separator := " "
+	if spacelessLanguages[result.Language] {
+		separator = ""
+	}
+	report := func(segment Segment, what, reason string) {
+		step.Changes++
+		step.Details = append(step.Details, fmt.Sprintf("[%s] %s %q: %s",
+			formatTimestampMillis(segment.Start), what, segment.Text, reason))
+	}
+
+	kept := make([]Segment, 0, len(result.Segments))
+	for i, segment := range result.Segments {
+		reason := p.suspect(result.Segments, i)
+		if reason == "" {
+			// Loops inside a segment are cut down to one occurrence
+			if collapsed, repeats := p.collapseLoops(segment, separator); repeats > 0 {
+				report(segment, "shortened", fmt.Sprintf("phrase repeated %d times", repeats+1))
+				segment = collapsed
+			}
+			kept = append(kept, segment)
+			continue
+		}
+		if p.action == hallucinationFlag {
+			segment.Flagged = reason
+			kept = append(kept, segment)
+			report(segment, "flagged", reason)
+			continue
+		}
+		report(segment, "removed", reason)
+	}
+	result.Segments = kept
+	return nil
+}
+
+// suspect returns why segment i looks hallucinated, or ""
+func (p *hallucinationProcessor) suspect(segments []Segment, i int) string {
+	segment := segments[i]
+	words := normalizedWords(segment.Text)
+	if len(words) == 0 {
+		return ""
+	}
+
+	// Segments repeating the text of the one before them form a loop; the
+	// first segment of a loop is kept and its repeats are dropped
+	text := strings.Join(words, " ")
+	before, after := 0, 0
+	for j := i - 1; j >= 0 && segmentKeyText(segments[j]) == text; j-- {
+		before++
+	}
+	for j := i + 1; j < len(segments) && segmentKeyText(segments[j]) == text; j++ {
+		after++
+	}
+	if before > 0 && before+1+after >= p.repeats {
+		return fmt.Sprintf("repeats the text of the segment before it, %d times in a row", before+1+after)
+	}
+
+	if confidence, ok := segmentConfidence(segment); ok && confidence < p.minConfidence {
+		if stockText(text) {
+			return fmt.Sprintf("stock phrase decoded with %.0f%% confidence", confidence*100)
+		}
+	}
+
+	if duration := segment.End - segment.Start; len(words) >= minRateWords {
+		if duration <= 0 || float64(len(words))/duration > p.maxRate {
+			return fmt.Sprintf("%d words in %.2fs is faster than anyone speaks", len(words), duration)
+		}
+	}
+	return ""
+}
+
+// stockText reports whether the normalized words of a segment are nothing
+// but stock phrases, e.g. "thanks for watching please subscribe", or a
+// credit line
+func stockText(text string) bool {
+	for _, credit := range hallucinationCredits {
+		if text == credit || strings.HasPrefix(text, credit+" ") {
+			return true
+		}
+	}
+	return stockPhrases(text)
+}
+
+// stockPhrases reports whether text is a sequence of one or more stock
+// phrases
+func stockPhrases(text string) bool {
+	for _, phrase := range hallucinationPhrases {
+		if text == phrase || strings.HasPrefix(text, phrase+" ") && stockPhrases(text[len(phrase)+1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// collapseLoops keeps one occurrence of every phrase repeated back to back
+// at least p.repeats times within a segment, e.g. "I don't know. I don't
+// know. I don't know. I don't know." It returns the shortened segment and
+// how many repeats were dropped.
+func (p *hallucinationProcessor) collapseLoops(segment Segment, separator string) (Segment, int) {
+	words := segment.Words
+	_, aligned := wordSpans(segment.Text, words)
+	timed := aligned && len(words) > 0
+	if !timed {
+		words = interpolateWords(segment)
+	}
+	keys := make([]string, len(words))
+	for i, word := range words {
+		keys[i] = strings.Join(normalizedWords(word.Text), " ")
+	}
+
+	keep := make([]bool, len(words))
+	for i := range keep {
+		keep[i] = true
+	}
+	dropped := 0
+	for n := 1; n <= maxLoopPhrase && n*p.repeats <= len(words); n++ {
+		for start := 0; start+n*p.repeats <= len(words); start++ {
+			repeats := 1
+			for start+(repeats+1)*n <= len(words) && samePhrase(keys, start, start+repeats*n, n) {
+				repeats++
+			}
+			if repeats < p.repeats || !allKept(keep[start:start+repeats*n]) {
+				continue
+			}
+			for i := start + n; i < start+repeats*n; i++ {
+				keep[i] = false
+			}
+			dropped += repeats - 1
+			start += repeats*n - 1
+		}
+	}
+	if dropped == 0 {
+		return segment, 0
+	}
+
+	var kept []Word
+	var texts []string
+	for i, word := range words {
+		if keep[i] {
+			kept = append(kept, word)
+			texts = append(texts, word.Text)
+		}
+	}
+	segment.Text = strings.Join(texts, separator)
+	if timed {
+		segment.Words = kept
+	} else if len(segment.Words) > 0 {
+		// Words that no longer line up with the text, e.g. after a
+		// replace, lose their own loops
+		joined, _ := joinWords(segment.Words)
+		collapsed, _ := p.collapseLoops(Segment{Start: segment.Start, End: segment.End, Text: joined, Words: segment.Words}, " ")
+		segment.Words = collapsed.Words
+	}
+	return segment, dropped
+}
+
+// allKept reports whether none of the words was dropped yet
+func allKept(keep []bool) bool {
+	for _, k := range keep {
+		if !k {
+			return false
+		}
+	}
+	return true
+}
+
+// segmentKeyText is a segment's text compared without case and punctuation
+func segmentKeyText(segment Segment) string {
+	return strings.Join(normalizedWords(segment.Text), " ")
+}
+
+// samePhrase reports whether the n words at a and at b are the same,
+// ignoring case and punctuation
+func samePhrase(keys []string, a, b, n int) bool {
+	for i := 0; i < n; i++ {
+		if keys[a+i] == "" || keys[a+i] != keys[b+i] {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizedWords splits text into lower-case words without punctuation,
+// keeping apostrophes inside words
+func normalizedWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	})
+}
+
+// segmentConfidence is the mean probability of a segment's words, or of
+// its tokens; ok is false when whisper reported neither
+func segmentConfidence(segment Segment) (confidence float64, ok bool) {
+	var sum float64
+	var count int
+	for _, word := range segment.Words {
+		sum += word.Probability
+		count++
+	}
+	if count == 0 {
+		for _, token := range segment.Tokens {
+			sum += token.Probability
+			count++
+		}
+	}
+	if count == 0 || sum == 0 {
+		return 0, false
+	}
+	return sum / float64(count), true
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func filterHallucinations(t *testing.T, options map[string]string, segments ...Segment) *TranscriptionResult {
+	t.Helper()
+	result := &TranscriptionResult{Language: "en", Segments: segments}
+	if err := RunProcessors(result, []ProcessorConfig{{Name: hallucinationsProcessor, Options: options}}); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+// unsure returns segment with every word decoded at probability
+func unsure(segment Segment, probability float64) Segment {
+	for i := range segment.Words {
+		segment.Words[i].Probability = probability
+	}
+	return segment
+}
+
+func TestHallucinationsCollapseLoops(t *testing.T) {
+	segment := timedSegment(0, 0.3, "I don't know. I don't know. I don't know. I don't know. Really.")
+	result := filterHallucinations(t, nil, segment)
+	got := result.Segments[0]
+	if got.Text != "I don't know. Really." {
+		t.Errorf("text = %q", got.Text)
+	}
+	if words := wordTexts(got.Words); words != got.Text {
+		t.Errorf("words = %q, want them to spell the text", words)
+	}
+
+	// Three repeats are below the default threshold of four
+	segment = timedSegment(0, 0.3, "No. No. No.")
+	if got := filterHallucinations(t, nil, segment).Segments[0].Text; got != "No. No. No." {
+		t.Errorf("short repeat collapsed to %q", got)
+	}
+}
+
+func TestHallucinationsRemoveRepeatedSegments(t *testing.T) {
+	var segments []Segment
+	for i := 0; i < 5; i++ {
+		segments = append(segments, timedSegment(float64(i)*2, 0.5, "Thank you."))
+	}
+	segments = append(segments, timedSegment(10, 0.5, "Goodbye now."))
+	result := filterHallucinations(t, nil, segments...)
+	if got := strings.Join(sentenceTexts(result.Segments), "|"); got != "Thank you.|Goodbye now." {
+		t.Errorf("segments = %q", got)
+	}
+	if result.Processing[0].Changes != 4 {
+		t.Errorf("changes = %d, want 4", result.Processing[0].Changes)
+	}
+}
+
+func TestHallucinationsStockPhrases(t *testing.T) {
+	result := filterHallucinations(t, nil,
+		timedSegment(0, 0.5, "Good talk."),
+		unsure(timedSegment(5, 0.5, "Thanks for watching!"), 0.2),
+		unsure(timedSegment(9, 0.5, "Thanks for watching!"), 0.9),
+	)
+	if got := strings.Join(sentenceTexts(result.Segments), "|"); got != "Good talk.|Thanks for watching!" {
+		t.Errorf("segments = %q, want only the unsure phrase removed", got)
+	}
+}
+
+// Stock phrases only count when they are the whole segment, or a credit
+// line opens it
+func TestHallucinationsStockPhrasesMatchWholeSegments(t *testing.T) {
+	tests := []struct {
+		text    string
+		removed bool
+	}{
+		{"Thank you.", true},
+		{"Thanks for watching. Please subscribe!", true},
+		{"Subtitles by Jane Doe", true},
+		{"I want to thank you all for coming.", false},
+		{"Thank you for coming.", false},
+		{"We didn't like and subscribe to that plan.", false},
+		{"The model was transcribed by hand.", false},
+	}
+	for _, test := range tests {
+		result := filterHallucinations(t, nil, unsure(timedSegment(0, 0.5, test.text), 0.2))
+		if removed := len(result.Segments) == 0; removed != test.removed {
+			t.Errorf("%q removed = %v, want %v", test.text, removed, test.removed)
+		}
+	}
+}
+
+func TestHallucinationsSpeakingRate(t *testing.T) {
+	fast := timedSegment(0, 0.05, "one two three four five six")
+	result := filterHallucinations(t, map[string]string{"action": "flag"}, fast)
+	if len(result.Segments) != 1 || !strings.Contains(result.Segments[0].Flagged, "faster than anyone speaks") {
+		t.Errorf("segment = %+v, want it flagged", result.Segments[0])
+	}
+}
+
+// Words left stale by a text-only edit lose their loops too, and the loop in
+// the text is still found
+func TestHallucinationsWordsThatDisagreeWithText(t *testing.T) {
+	segment := timedSegment(0, 0.3, "go on go on go on go on then")
+	segment.Text = "Go on. Go on. Go on. Go on. Then."
+	result := filterHallucinations(t, nil, segment)
+	got := result.Segments[0]
+	if got.Text != "Go on. Then." {
+		t.Errorf("text = %q", got.Text)
+	}
+	if words := wordTexts(got.Words); words != "go on then" {
+		t.Errorf("words = %q", words)
+	}
+}
+
+func TestHallucinationsOptions(t *testing.T) {
+	for _, options := range []map[string]string{
+		{"action": "drop"},
+		{"repeats": "1"},
+		{"maxrate": "0"},
+		{"minconfidence": "2"},
+	} {
+		if _, err := newHallucinationProcessor(options); err == nil {
+			t.Errorf("options %v accepted", options)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Job sources
+const (
+	JobSourceCLI = "cli"
+	JobSourceWeb = "web"
+)
+
+// Job states
+const (
+	JobRunning   = "running"
+	JobFailed    = "failed"
+	JobCompleted = "completed"
+)
+
+// Job is a transcription whose progress survives the process. Chunk results
+// are checkpointed in the job directory as they complete, so a job that was
+// interrupted can be resumed without redoing finished work.
+type Job struct {
+	ID           string            `json:"id"`
+	Source       string            `json:"source"`
+	Status       string            `json:"status"`
+	Error        string            `json:"error,omitempty"`
+	Created      time.Time         `json:"created"`
+	Updated      time.Time         `json:"updated"`
+	InputFile    string            `json:"inputFile"`
+	InputName    string            `json:"inputName"`
+	InputSize    int64             `json:"inputSize"`
+	InputModTime time.Time         `json:"inputModTime"`
+	OutputFile   string            `json:"outputFile,omitempty"`
+	Options      TranscribeOptions `json:"options"`
+	Format       FormatOptions     `json:"format"`
+
+	dir string
+}
+
+// JobStore keeps jobs in one directory per job
+type JobStore struct {
+	dir string
+}
+
+// DefaultJobsDir returns OFFLINETRANSCRIBE_JOBS_DIR if set, or a directory
+// in the user's cache directory
+func DefaultJobsDir() (string, error) {
+	if dir := os.Getenv("OFFLINETRANSCRIBE_JOBS_DIR"); dir != "" {
+		return dir, nil
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot locate a directory for jobs: %v", err)
+	}
+	return filepath.Join(cacheDir, "OfflineTranscribe", "jobs"), nil
+}
+
+// OpenDefaultJobStore opens the store in DefaultJobsDir
+func OpenDefaultJobStore() (*JobStore, error) {
+	dir, err := DefaultJobsDir()
+	if err != nil {
+		return nil, err
+	}
+	return OpenJobStore(dir)
+}
+
+// OpenJobStore opens the job directory, creating it if needed. Jobs hold
+// audio and transcripts, so the directory is private to the user.
+func OpenJobStore(dir string) (*JobStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create jobs directory: %v", err)
+	}
+	return &JobStore{dir: dir}, nil
+}
+
+// Create starts a new running job. The input file is recorded later with
+// SetInput, as web uploads are only saved once the job directory exists.
+func (s *JobStore) Create(source string, opts TranscribeOptions, format FormatOptions) (*Job, error) {
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+
+	job := &Job{
+		ID:      id,
+		Source:  source,
+		Status:  JobRunning,
+		Created: time.Now(),
+		Options: opts,
+		Format:  format,
+		dir:     filepath.Join(s.dir, id),
+	}
+	if err := os.Mkdir(job.dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create job directory: %v", err)
+	}
+	return job, nil
+}
+
+// newJobID returns a sortable, unique job ID such as 20240131-154502-9f3a1c
+func newJobID() (string, error) {
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("failed to create job ID: %v", err)
+	}
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(suffix), nil
+}
+
+// Load reads the job with the given ID
+func (s *JobStore) Load(id string) (*Job, error) {
+	// IDs come from users and URLs; never let one name another directory
+	if id == "" || filepath.Base(id) != id || id == "." || id == ".." {
+		return nil, fmt.Errorf("invalid job ID %q", id)
+	}
+
+	dir := filepath.Join(s.dir, id)
+	data, err := os.ReadFile(filepath.Join(dir, "job.json"))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("job %s not found", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job %s: %v", id, err)
+	}
+
+	job := &Job{}
+	if err := json.Unmarshal(data, job); err != nil {
+		return nil, fmt.Errorf("failed to read job %s: %v", id, err)
+	}
+	job.dir = dir
+	return job, nil
+}
+
+// List returns all readable jobs, oldest first
+func (s *JobStore) List() ([]*Job, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %v", err)
+	}
+
+	var jobs []*Job
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		// Skip directories of jobs that were never saved or are corrupt
+		if job, err := s.Load(entry.Name()); err == nil {
+			jobs = append(jobs, job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Created.Before(jobs[j].Created)
+	})
+	return jobs, nil
+}
+
+// Dir returns the job's directory
+func (j *Job) Dir() string {
+	return j.dir
+}
+
+// CheckpointDir returns where chunk results are persisted
+func (j *Job) CheckpointDir() string {
+	return filepath.Join(j.dir, "checkpoint")
+}
+
+// HasCheckpoints reports whether any whisper run of the job has finished
+func (j *Job) HasCheckpoints() bool {
+	done, _ := checkpointProgress(j.CheckpointDir())
+	return done > 0
+}
+
+// CheckpointProgress returns how many of the job's whisper runs have
+// finished and how many there are; the total is 0 until the job is planned
+func (j *Job) CheckpointProgress() (done, total int) {
+	return checkpointProgress(j.CheckpointDir())
+}
+
+// SetInput records the input file and its size and modification time, so a
+// resumed job can tell whether the file changed in the meantime
+func (j *Job) SetInput(path, name string) error {
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %v", path, err)
+	}
+	info, err := os.Stat(absolute)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	j.InputFile = absolute
+	j.InputName = name
+	j.InputSize = info.Size()
+	j.InputModTime = info.ModTime()
+	return j.Save()
+}
+
+// CheckInput reports an error if the input file is gone or has changed
+// since the job started, as its checkpoints would no longer match
+func (j *Job) CheckInput() error {
+	info, err := os.Stat(j.InputFile)
+	if err != nil {
+		return fmt.Errorf("input file of job %s is no longer available: %v", j.ID, err)
+	}
+	if info.Size() != j.InputSize || !info.ModTime().Equal(j.InputModTime) {
+		return fmt.Errorf("input file %s changed since job %s started", j.InputFile, j.ID)
+	}
+	return nil
+}
+
+// Save writes the job description. The file is replaced atomically so a
+// crash never leaves a half-written job behind.
+func (j *Job) Save() error {
+	j.Updated = time.Now()
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to save job %s: %v", j.ID, err)
+	}
+	if err := writeFileAtomic(filepath.Join(j.dir, "job.json"), data); err != nil {
+		return fmt.Errorf("failed to save job %s: %v", j.ID, err)
+	}
+	return nil
+}
+
+// Fail marks the job as failed; its checkpoints are kept for resuming
+func (j *Job) Fail(err error) error {
+	j.Status = JobFailed
+	j.Error = err.Error()
+	return j.Save()
+}
+
+// Complete marks the job as done and discards its checkpoints. Jobs whose
+// result is collected later, such as web jobs resumed after a restart, keep
+// the result in the job directory.
+func (j *Job) Complete(result interface{}) error {
+	if result != nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return fmt.Errorf("failed to save result of job %s: %v", j.ID, err)
+		}
+		if err := writeFileAtomic(filepath.Join(j.dir, "result.json"), data); err != nil {
+			return fmt.Errorf("failed to save result of job %s: %v", j.ID, err)
+		}
+	}
+	os.RemoveAll(j.CheckpointDir())
+
+	j.Status = JobCompleted
+	j.Error = ""
+	return j.Save()
+}
+
+// LoadResult reads the result saved by Complete into result
+func (j *Job) LoadResult(result interface{}) error {
+	data, err := os.ReadFile(filepath.Join(j.dir, "result.json"))
+	if err != nil {
+		return fmt.Errorf("failed to read result of job %s: %v", j.ID, err)
+	}
+	return json.Unmarshal(data, result)
+}
+
+// Remove deletes the job and everything in its directory
+func (j *Job) Remove() error {
+	return os.RemoveAll(j.dir)
+}
+
+// writeFileAtomic writes data to a temporary file and renames it over path
+func writeFileAtomic(path string, data []byte) error {
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LanguageAuto asks whisper to detect the spoken language
+const LanguageAuto = "auto"
+
+// whisperLanguages lists the language codes understood by whisper.cpp
+var whisperLanguages = map[string]string{
+	"en": "english", "zh": "chinese", "de": "german", "es": "spanish",
+	"ru": "russian", "ko": "korean", "fr": "french", "ja": "japanese",
+	"pt": "portuguese", "tr": "turkish", "pl": "polish", "ca": "catalan",
+	"nl": "dutch", "ar": "arabic", "sv": "swedish", "it": "italian",
+	"id": "indonesian", "hi": "hindi", "fi": "finnish", "vi": "vietnamese",
+	"he": "hebrew", "uk": "ukrainian", "el": "greek", "ms": "malay",
+	"cs": "czech", "ro": "romanian", "da": "danish", "hu": "hungarian",
+	"ta": "tamil", "no": "norwegian", "th": "thai", "ur": "urdu",
+	"hr": "croatian", "bg": "bulgarian", "lt": "lithuanian", "la": "latin",
+	"mi": "maori", "ml": "malayalam", "cy": "welsh", "sk": "slovak",
+	"te": "telugu", "fa": "persian", "lv": "latvian", "bn": "bengali",
+	"sr": "serbian", "az": "azerbaijani", "sl": "slovenian", "kn": "kannada",
+	"et": "estonian", "mk": "macedonian", "br": "breton", "eu": "basque",
+	"is": "icelandic", "hy": "armenian", "ne": "nepali", "mn": "mongolian",
+	"bs": "bosnian", "kk": "kazakh", "sq": "albanian", "sw": "swahili",
+	"gl": "galician", "mr": "marathi", "pa": "punjabi", "si": "sinhala",
+	"km": "khmer", "sn": "shona", "yo": "yoruba", "so": "somali",
+	"af": "afrikaans", "oc": "occitan", "ka": "georgian", "be": "belarusian",
+	"tg": "tajik", "sd": "sindhi", "gu": "gujarati", "am": "amharic",
+	"yi": "yiddish", "lo": "lao", "uz": "uzbek", "fo": "faroese",
+	"ht": "haitian creole", "ps": "pashto", "tk": "turkmen", "nn": "nynorsk",
+	"mt": "maltese", "sa": "sanskrit", "lb": "luxembourgish", "my": "myanmar",
+	"bo": "tibetan", "tl": "tagalog", "mg": "malagasy", "as": "assamese",
+	"tt": "tatar", "haw": "hawaiian", "ln": "lingala", "ha": "hausa",
+	"ba": "bashkir", "jw": "javanese", "su": "sundanese", "yue": "cantonese",
+}
+
+// normalizeLanguage validates a language option and returns its canonical
+// form. An empty value means automatic detection.
+func normalizeLanguage(language string) (string, error) {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if language == "" || language == LanguageAuto {
+		return LanguageAuto, nil
+	}
+	if _, ok := whisperLanguages[language]; ok {
+		return language, nil
+	}
+
+	// Accept full language names such as "german"
+	for code, name := range whisperLanguages {
+		if name == language {
+			return code, nil
+		}
+	}
+
+	return "", fmt.Errorf("unsupported language '%s'. Use 'auto' or one of: %s", language, strings.Join(languageCodes(), ", "))
+}
+
+// languageCodes returns the supported language codes in sorted order
+func languageCodes() []string {
+	codes := make([]string, 0, len(whisperLanguages))
+	for code := range whisperLanguages {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// languageName returns the English name for a language code
+func languageName(code string) string {
+	if name, ok := whisperLanguages[code]; ok {
+		return name
+	}
+	return code
+}
+
+// whisper-cli prints "auto-detected language: de (p = 0.912345)" on stderr
+var detectedLanguageRegex = regexp.MustCompile(`auto-detected language:\s*([a-z]+)\s*\(p\s*=\s*([0-9.]+)\)`)
+
+// parseDetectedLanguage extracts the auto-detected language and its
+// probability from whisper's output
+func parseDetectedLanguage(output string) (string, float64, bool) {
+	matches := detectedLanguageRegex.FindStringSubmatch(output)
+	if len(matches) != 3 {
+		return "", 0, false
+	}
+
+	probability, err := strconv.ParseFloat(matches[2], 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return matches[1], probability, true
+}
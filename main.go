@@ -1,26 +1,31 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
-	"os"
 	"path/filepath"
 	"strings"
-	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
 	"fyne.io/fyne/v2/widget"
+
+	"localtts/audio"
 )
 
 type LocalTTS struct {
 	app            fyne.App
 	window         fyne.Window
 	fileEntry      *widget.Entry
+	audioInfoLabel *widget.Label
 	modelSelect    *widget.Select
 	timestampSelect *widget.Select
+	languageSelect *widget.Select
+	taskSelect     *widget.Select
 	processBtn     *widget.Button
 	saveBtn        *widget.Button
 	resultsText    *widget.Entry
@@ -28,19 +33,50 @@ type LocalTTS struct {
 	statusLabel    *widget.Label
 	lastResults    string
 	currentFile    string
+	currentAudio   *audio.Info // what probing found for currentFile
+	resourceManager *ResourceManager
+	transcriber    Engine
+	ctx            context.Context
+	cancel         context.CancelFunc
 }
 
-func NewLocalTTS() *LocalTTS {
+func NewLocalTTS(config EngineConfig) (*LocalTTS, error) {
+	// Initialize resource manager and extract embedded files
+	rm, err := NewResourceManager()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize resources: %v", err)
+	}
+	
+	if config.NeedsResources() {
+		if err := rm.VerifyResources(); err != nil {
+			rm.Cleanup()
+			return nil, fmt.Errorf("resource verification failed: %v", err)
+		}
+	}
+	
+	transcriber, err := NewEngine(config, rm)
+	if err != nil {
+		rm.Cleanup()
+		return nil, err
+	}
+	
 	myApp := app.New()
 	myApp.SetIcon(nil) // You can add an icon resource here
 	
 	myWindow := myApp.NewWindow("LocalTTS - Offline Speech to Text")
 	myWindow.Resize(fyne.NewSize(800, 600))
 	
+	// Running transcriptions are canceled when the application shuts down
+	ctx, cancel := context.WithCancel(context.Background())
+	
 	return &LocalTTS{
-		app:    myApp,
-		window: myWindow,
-	}
+		app:             myApp,
+		window:          myWindow,
+		resourceManager: rm,
+		transcriber:     transcriber,
+		ctx:             ctx,
+		cancel:          cancel,
+	}, nil
 }
 
 func (lt *LocalTTS) setupUI() {
@@ -53,7 +89,11 @@ func (lt *LocalTTS) setupUI() {
 	lt.fileEntry.Disable()
 	
 	browseBtn := widget.NewButton("Browse", lt.browseFile)
-	fileContainer := container.NewBorder(nil, nil, nil, browseBtn, lt.fileEntry)
+	lt.audioInfoLabel = widget.NewLabel("")
+	fileContainer := container.NewVBox(
+		container.NewBorder(nil, nil, nil, browseBtn, lt.fileEntry),
+		lt.audioInfoLabel,
+	)
 	
 	// Model selection
 	lt.modelSelect = widget.NewSelect([]string{"tiny", "base", "small", "medium"}, nil)
@@ -61,10 +101,20 @@ func (lt *LocalTTS) setupUI() {
 	modelContainer := container.NewBorder(nil, nil, widget.NewLabel("Model Size:"), nil, lt.modelSelect)
 	
 	// Timestamp granularity
-	lt.timestampSelect = widget.NewSelect([]string{"word", "sentence"}, nil)
-	lt.timestampSelect.SetSelected("word")
+	lt.timestampSelect = widget.NewSelect([]string{GranularityWord, GranularitySentence, GranularityParagraph}, nil)
+	lt.timestampSelect.SetSelected(GranularityWord)
 	timestampContainer := container.NewBorder(nil, nil, widget.NewLabel("Timestamps:"), nil, lt.timestampSelect)
 	
+	// Spoken language
+	lt.languageSelect = widget.NewSelect([]string{LanguageAuto, "en", "de", "es", "fr", "it", "pt", "nl"}, nil)
+	lt.languageSelect.SetSelected(LanguageAuto)
+	languageContainer := container.NewBorder(nil, nil, widget.NewLabel("Language:"), nil, lt.languageSelect)
+	
+	// Transcribe or translate to English
+	lt.taskSelect = widget.NewSelect([]string{TaskTranscribe, TaskTranslate}, nil)
+	lt.taskSelect.SetSelected(TaskTranscribe)
+	taskContainer := container.NewBorder(nil, nil, widget.NewLabel("Task:"), nil, lt.taskSelect)
+	
 	// Process button
 	lt.processBtn = widget.NewButton("Process Audio", lt.processAudio)
 	lt.processBtn.Importance = widget.HighImportance
@@ -88,7 +138,7 @@ func (lt *LocalTTS) setupUI() {
 		title,
 		widget.NewSeparator(),
 		widget.NewCard("", "Audio File", fileContainer),
-		container.NewGridWithColumns(2, modelContainer, timestampContainer),
+		container.NewGridWithColumns(2, modelContainer, languageContainer, taskContainer, timestampContainer),
 		lt.processBtn,
 		widget.NewSeparator(),
 		lt.statusLabel,
@@ -101,7 +151,7 @@ func (lt *LocalTTS) setupUI() {
 }
 
 func (lt *LocalTTS) browseFile() {
-	dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+	fileDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
 		if err != nil {
 			dialog.ShowError(err, lt.window)
 			return
@@ -111,47 +161,39 @@ func (lt *LocalTTS) browseFile() {
 		}
 		defer reader.Close()
 		
-		lt.currentFile = reader.URI().Path()
+		// Inspect the file so empty or corrupt audio is refused right away
+		path := reader.URI().Path()
+		info, err := audio.Probe(path)
+		if err != nil {
+			lt.currentFile = ""
+			lt.currentAudio = nil
+			lt.fileEntry.SetText("")
+			lt.audioInfoLabel.SetText("")
+			lt.processBtn.Disable()
+			dialog.ShowError(err, lt.window)
+			return
+		}
+		
+		lt.currentFile = path
+		lt.currentAudio = &info
 		lt.fileEntry.SetText(lt.currentFile)
+		lt.audioInfoLabel.SetText(fmt.Sprintf("%s, duration %s", info.Format, formatTimestamp(info.Duration.Seconds())))
 		
 		// Enable process button if file is selected
 		if lt.currentFile != "" {
 			lt.processBtn.Enable()
 		}
 	}, lt.window)
+	fileDialog.SetFilter(storage.NewExtensionFileFilter([]string{".wav", ".mp3", ".flac"}))
+	fileDialog.Show()
 }
 
 func (lt *LocalTTS) loadModel(modelSize string) error {
 	lt.statusLabel.SetText(fmt.Sprintf("Loading %s model...", modelSize))
 	lt.progressBar.Show()
 	
-	// In a real implementation, you would download/load the model here
-	// For now, we'll simulate the model loading
-	modelPath := fmt.Sprintf("models/ggml-%s.bin", modelSize)
-	
-	// Check if model exists, if not, we would download it
-	if _, err := os.Stat(modelPath); os.IsNotExist(err) {
-		// Create models directory
-		os.MkdirAll("models", 0755)
-		
-		// In a real implementation, download the model here
-		lt.statusLabel.SetText(fmt.Sprintf("Downloading %s model... (this may take a while)", modelSize))
-		
-		// Simulate download time
-		time.Sleep(2 * time.Second)
-		
-		// Create a placeholder file (in real implementation, this would be the actual model)
-		file, err := os.Create(modelPath)
-		if err != nil {
-			return fmt.Errorf("failed to create model file: %v", err)
-		}
-		file.Close()
-	}
-	
-	// Load the model (placeholder - in real implementation use whisper.New)
-	var err error
-	// lt.model, err = whisper.New(modelPath)
-	if err != nil {
+	if err := lt.transcriber.LoadModel(modelSize); err != nil {
+		lt.progressBar.Hide()
 		return fmt.Errorf("failed to load model: %v", err)
 	}
 	
@@ -187,65 +229,44 @@ func (lt *LocalTTS) processAudio() {
 		
 		// Process audio
 		lt.statusLabel.SetText("Transcribing audio...")
+		lt.progressBar.SetValue(0)
 		lt.progressBar.Show()
 		
-		// In a real implementation, you would use:
-		// context := lt.model.NewContext()
-		// err := context.Process(lt.currentFile, nil, nil)
-		
-		// For demonstration, simulate processing
-		time.Sleep(3 * time.Second)
+		opts := TranscribeOptions{
+			ModelSize: modelSize,
+			Language:  lt.languageSelect.Selected,
+			Task:      lt.taskSelect.Selected,
+			// The file was probed when it was chosen
+			AudioInfo: lt.currentAudio,
+			Progress: func(p Progress) {
+				lt.progressBar.SetValue(p.Percent / 100)
+				lt.statusLabel.SetText(fmt.Sprintf("Transcribing audio... %s", p))
+			},
+		}
+		result, err := lt.transcriber.TranscribeContext(lt.ctx, lt.currentFile, opts)
+		if err != nil {
+			lt.progressBar.Hide()
+			lt.statusLabel.SetText("Transcription failed")
+			dialog.ShowError(fmt.Errorf("transcription failed: %v", err), lt.window)
+			lt.processBtn.Enable()
+			return
+		}
 		
-		// Generate sample results
-		timestampType := lt.timestampSelect.Selected
-		lt.generateSampleResults(timestampType)
+		format := FormatOptions{Granularity: lt.timestampSelect.Selected}
+		lt.lastResults = FormatResults(result, format)
+		lt.resultsText.SetText(lt.lastResults)
 		
 		lt.progressBar.Hide()
-		lt.statusLabel.SetText("Transcription complete")
+		if result.LanguageProbability > 0 {
+			lt.statusLabel.SetText(fmt.Sprintf("Transcription complete (detected language: %s, %.0f%% confidence)", languageName(result.Language), result.LanguageProbability*100))
+		} else {
+			lt.statusLabel.SetText("Transcription complete")
+		}
 		lt.processBtn.Enable()
 		lt.saveBtn.Enable()
 	}()
 }
 
-func (lt *LocalTTS) generateSampleResults(timestampType string) {
-	// This is placeholder content - in a real implementation, this would come from Whisper
-	var results string
-	
-	if timestampType == "word" {
-		results = `[00:00:01.240] Hello
-[00:00:01.480] there,
-[00:00:01.720] this
-[00:00:01.960] is
-[00:00:02.120] a
-[00:00:02.280] sample
-[00:00:02.560] transcription
-[00:00:03.000] with
-[00:00:03.200] word-level
-[00:00:03.680] timestamps.
-[00:00:04.120] Each
-[00:00:04.280] word
-[00:00:04.440] has
-[00:00:04.600] its
-[00:00:04.760] own
-[00:00:04.920] precise
-[00:00:05.240] timestamp
-[00:00:05.600] for
-[00:00:05.760] easy
-[00:00:05.960] navigation.`
-	} else {
-		results = `[00:00:01.240 - 00:00:03.680] Hello there, this is a sample transcription with word-level timestamps.
-
-[00:00:04.120 - 00:00:06.200] Each word has its own precise timestamp for easy navigation.
-
-[00:00:06.500 - 00:00:09.800] This sentence-level format groups words together for better readability.
-
-[00:00:10.100 - 00:00:13.500] You can quickly find specific sections using the time references provided.`
-	}
-	
-	lt.lastResults = results
-	lt.resultsText.SetText(results)
-}
-
 func (lt *LocalTTS) saveResults() {
 	if lt.lastResults == "" {
 		dialog.ShowError(fmt.Errorf("no results to save"), lt.window)
@@ -258,7 +279,7 @@ func (lt *LocalTTS) saveResults() {
 		baseName = strings.TrimSuffix(filepath.Base(lt.currentFile), filepath.Ext(lt.currentFile)) + "_transcription"
 	}
 	
-	dialog.ShowFileSave(func(writer fyne.URIWriteCloser, err error) {
+	saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
 		if err != nil {
 			dialog.ShowError(err, lt.window)
 			return
@@ -276,6 +297,8 @@ func (lt *LocalTTS) saveResults() {
 		
 		dialog.ShowInformation("Success", fmt.Sprintf("Results saved to %s", writer.URI().Path()), lt.window)
 	}, lt.window)
+	saveDialog.SetFileName(baseName + ".txt")
+	saveDialog.Show()
 }
 
 func (lt *LocalTTS) Run() {
@@ -283,7 +306,26 @@ func (lt *LocalTTS) Run() {
 	lt.window.ShowAndRun()
 }
 
+// Cleanup releases the engine and extracted resources
+func (lt *LocalTTS) Cleanup() error {
+	if lt.cancel != nil {
+		lt.cancel()
+	}
+	if lt.transcriber != nil {
+		lt.transcriber.Close()
+	}
+	if lt.resourceManager != nil {
+		return lt.resourceManager.Cleanup()
+	}
+	return nil
+}
+
 func main() {
-	app := NewLocalTTS()
+	app, err := NewLocalTTS(LoadEngineConfig())
+	if err != nil {
+		log.Fatalf("Failed to start: %v", err)
+	}
+	defer app.Cleanup()
+	
 	app.Run()
 }
\ No newline at end of file
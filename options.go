@@ -0,0 +1,354 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+
+	"localtts/audio"
+	"localtts/vad"
+)
+
+// TranscribeOptions controls a single transcription job. Zero values are
+// replaced by whisper's defaults when the options are normalized, and the
+// normalized options are echoed in TranscriptionResult.Options so that
+// runs can be reproduced.
+type TranscribeOptions struct {
+	ModelSize string `json:"modelSize"`
+
+	// Language is a whisper language code such as "de", or "auto" (the
+	// default when empty) to detect the spoken language
+	Language string `json:"language"`
+
+	// Task is TaskTranscribe (the default when empty) or TaskTranslate
+	// to translate the speech into English
+	Task string `json:"task"`
+
+	// Prompt is an initial prompt that guides whisper's style and spelling
+	Prompt string `json:"prompt,omitempty"`
+
+	// Glossary lists product names, acronyms and other terms whisper
+	// should prefer; they are appended to the prompt as far as they fit
+	Glossary []string `json:"glossary,omitempty"`
+
+	// Diarize labels segments with speakers. A tinydiarize variant of the
+	// model such as small.en-tdrz is used when installed; otherwise voices
+	// are clustered in the audio. Speakers is how many there are, 0 to
+	// estimate it; more than two are always clustered.
+	Diarize  bool `json:"diarize,omitempty"`
+	Speakers int  `json:"speakers,omitempty"`
+
+	// SplitChannels transcribes each channel of a stereo or multi-channel
+	// recording separately, e.g. the agent and customer of a call, and
+	// labels the segments with their channel as speaker
+	SplitChannels bool `json:"splitChannels,omitempty"`
+
+	// PostProcessing is the pipeline of processors run over the result, in
+	// order, once whisper has finished; see RunProcessors
+	PostProcessing []ProcessorConfig `json:"postProcessing,omitempty"`
+
+	// Decoding parameters passed to whisper-cli
+	Threads          int     `json:"threads"`          // -t, default min(4, CPUs)
+	Processors       int     `json:"processors"`       // -p, default 1
+	BeamSize         int     `json:"beamSize"`         // -bs, default 5
+	BestOf           int     `json:"bestOf"`           // -bo, default 5
+	Temperature      float64 `json:"temperature"`      // -tp, default 0
+	EntropyThreshold float64 `json:"entropyThreshold"` // -et, default 2.4; see checkThreshold
+	LogprobThreshold float64 `json:"logprobThreshold"` // -lpt, default -1.0; see checkThreshold
+	MaxSegmentLength int     `json:"maxSegmentLength"` // -ml in characters, 0 = no limit
+	SplitOnWord      bool    `json:"splitOnWord"`      // -sow, requires MaxSegmentLength
+
+	// Long recordings are split into chunks of about ChunkSeconds, cut in
+	// pauses, and transcribed by up to Workers whisper processes at once.
+	// Workers defaults to the CPUs divided by threads per process; 1
+	// transcribes the whole file in a single pass.
+	Workers      int `json:"workers"`
+	ChunkSeconds int `json:"chunkSeconds"` // default 600
+
+	// VAD enables voice activity detection so only speech is transcribed;
+	// the tuning values below are only used, and defaulted, when it is set
+	VAD             bool    `json:"vad"`
+	VADThreshold    float64 `json:"vadThreshold,omitempty"`    // dB above the noise floor, default 10
+	VADMinSpeechMs  int     `json:"vadMinSpeechMs,omitempty"`  // shorter bursts are ignored, default 250
+	VADMinSilenceMs int     `json:"vadMinSilenceMs,omitempty"` // shorter pauses are kept, default 700
+	VADPaddingMs    int     `json:"vadPaddingMs,omitempty"`    // kept around speech, default 200
+
+	// Progress, when set, receives progress updates while the job runs
+	Progress ProgressFunc `json:"-"`
+
+	// CheckpointDir, when set, persists the result of every chunk so an
+	// interrupted job can be resumed; see Job
+	CheckpointDir string `json:"-"`
+
+	// NoCache transcribes the file even if the transcript cache holds a
+	// result for the same audio, model and options
+	NoCache bool `json:"-"`
+
+	// AudioInfo, when set, is what audio.Probe found for the input file, so
+	// a front-end that already checked the file does not have it probed
+	// again
+	AudioInfo *audio.Info `json:"-"`
+}
+
+// whisper-cli defaults, used for options left at their zero value
+const (
+	defaultModelSize        = "base"
+	defaultProcessors       = 1
+	defaultBeamSize         = 5
+	defaultBestOf           = 5
+	defaultEntropyThreshold = 2.4
+	defaultLogprobThreshold = -1.0
+	maxThreads              = 256
+	maxProcessors           = 16
+	maxBeamSize             = 16
+	maxBestOf               = 16
+	defaultChunkSeconds     = 600
+	minChunkSeconds         = 30
+	maxChunkSeconds         = 7200
+	maxWorkers              = 64
+	maxVADThreshold         = 60
+	maxVADDurationMs        = 60000
+	maxSpeakers             = 16
+)
+
+// DefaultTranscribeOptions returns the options whisper-cli uses when no
+// flags are given
+func DefaultTranscribeOptions() TranscribeOptions {
+	opts, _ := TranscribeOptions{}.Normalize()
+	return opts
+}
+
+// defaultWorkers runs as many whisper processes as the CPUs can serve with
+// the given threads and processors each
+func defaultWorkers(threads, processors int) int {
+	workers := runtime.NumCPU() / (threads * processors)
+	if workers < 1 {
+		return 1
+	}
+	if workers > maxWorkers {
+		return maxWorkers
+	}
+	return workers
+}
+
+// defaultThreads mirrors whisper-cli's min(4, hardware concurrency)
+func defaultThreads() int {
+	if runtime.NumCPU() < 4 {
+		return runtime.NumCPU()
+	}
+	return 4
+}
+
+// Normalize validates the options and fills unset values with whisper's
+// defaults. The returned options are what the engine actually runs with.
+func (opts TranscribeOptions) Normalize() (TranscribeOptions, error) {
+	opts.ModelSize = strings.TrimSpace(opts.ModelSize)
+	if opts.ModelSize == "" {
+		opts.ModelSize = defaultModelSize
+	}
+
+	var err error
+	if opts.Language, err = normalizeLanguage(opts.Language); err != nil {
+		return opts, err
+	}
+	if opts.Task, err = normalizeTask(opts.Task, opts.ModelSize); err != nil {
+		return opts, err
+	}
+	if _, err = buildPrompt(opts.Prompt, opts.Glossary); err != nil {
+		return opts, err
+	}
+	if opts.PostProcessing, err = normalizeProcessors(opts.PostProcessing); err != nil {
+		return opts, err
+	}
+
+	if opts.Threads == 0 {
+		opts.Threads = defaultThreads()
+	}
+	if opts.Processors == 0 {
+		opts.Processors = defaultProcessors
+	}
+	if opts.BeamSize == 0 {
+		opts.BeamSize = defaultBeamSize
+	}
+	if opts.BestOf == 0 {
+		opts.BestOf = defaultBestOf
+	}
+	if opts.EntropyThreshold == 0 {
+		opts.EntropyThreshold = defaultEntropyThreshold
+	}
+	if opts.LogprobThreshold == 0 {
+		opts.LogprobThreshold = defaultLogprobThreshold
+	}
+	if opts.Workers == 0 && opts.Threads > 0 && opts.Processors > 0 {
+		opts.Workers = defaultWorkers(opts.Threads, opts.Processors)
+	}
+	if opts.ChunkSeconds == 0 {
+		opts.ChunkSeconds = defaultChunkSeconds
+	}
+
+	if !opts.Diarize {
+		opts.Speakers = 0
+	}
+	if !opts.VAD {
+		opts.VADThreshold, opts.VADMinSpeechMs, opts.VADMinSilenceMs, opts.VADPaddingMs = 0, 0, 0, 0
+	} else {
+		defaults := vad.DefaultConfig()
+		if opts.VADThreshold == 0 {
+			opts.VADThreshold = defaults.Threshold
+		}
+		if opts.VADMinSpeechMs == 0 {
+			opts.VADMinSpeechMs = int(defaults.MinSpeech / time.Millisecond)
+		}
+		if opts.VADMinSilenceMs == 0 {
+			opts.VADMinSilenceMs = int(defaults.MinSilence / time.Millisecond)
+		}
+		if opts.VADPaddingMs == 0 {
+			opts.VADPaddingMs = int(defaults.Padding / time.Millisecond)
+		}
+	}
+
+	switch {
+	case opts.Threads < 1 || opts.Threads > maxThreads:
+		return opts, fmt.Errorf("threads must be between 1 and %d, got %d", maxThreads, opts.Threads)
+	case opts.Processors < 1 || opts.Processors > maxProcessors:
+		return opts, fmt.Errorf("processors must be between 1 and %d, got %d", maxProcessors, opts.Processors)
+	case opts.BeamSize < 1 || opts.BeamSize > maxBeamSize:
+		return opts, fmt.Errorf("beam size must be between 1 and %d, got %d", maxBeamSize, opts.BeamSize)
+	case opts.BestOf < 1 || opts.BestOf > maxBestOf:
+		return opts, fmt.Errorf("best-of must be between 1 and %d, got %d", maxBestOf, opts.BestOf)
+	case opts.Temperature < 0 || opts.Temperature > 1:
+		return opts, fmt.Errorf("temperature must be between 0 and 1, got %g", opts.Temperature)
+	case opts.EntropyThreshold < 0:
+		return opts, fmt.Errorf("entropy threshold must be positive, got %g", opts.EntropyThreshold)
+	case opts.LogprobThreshold > 0:
+		return opts, fmt.Errorf("logprob threshold must be negative, got %g", opts.LogprobThreshold)
+	case opts.MaxSegmentLength < 0:
+		return opts, fmt.Errorf("max segment length must not be negative, got %d", opts.MaxSegmentLength)
+	case opts.SplitOnWord && opts.MaxSegmentLength == 0:
+		return opts, fmt.Errorf("split-on-word requires a max segment length")
+	case opts.Speakers < 0 || opts.Speakers > maxSpeakers:
+		return opts, fmt.Errorf("speakers must be between 0 and %d, got %d", maxSpeakers, opts.Speakers)
+	case opts.Diarize && opts.SplitChannels:
+		return opts, fmt.Errorf("speaker labels come from the channels when splitting channels; use either diarize or split channels")
+	case opts.Workers < 1 || opts.Workers > maxWorkers:
+		return opts, fmt.Errorf("workers must be between 1 and %d, got %d", maxWorkers, opts.Workers)
+	case opts.ChunkSeconds < minChunkSeconds || opts.ChunkSeconds > maxChunkSeconds:
+		return opts, fmt.Errorf("chunk length must be between %d and %d seconds, got %d", minChunkSeconds, maxChunkSeconds, opts.ChunkSeconds)
+	case opts.VADThreshold < 0 || opts.VADThreshold > maxVADThreshold:
+		return opts, fmt.Errorf("VAD threshold must be between 0 and %d dB, got %g", maxVADThreshold, opts.VADThreshold)
+	case opts.VADMinSpeechMs < 0 || opts.VADMinSpeechMs > maxVADDurationMs:
+		return opts, fmt.Errorf("VAD min speech must be between 0 and %d ms, got %d", maxVADDurationMs, opts.VADMinSpeechMs)
+	case opts.VADMinSilenceMs < 0 || opts.VADMinSilenceMs > maxVADDurationMs:
+		return opts, fmt.Errorf("VAD min silence must be between 0 and %d ms, got %d", maxVADDurationMs, opts.VADMinSilenceMs)
+	case opts.VADPaddingMs < 0 || opts.VADPaddingMs > maxVADDurationMs:
+		return opts, fmt.Errorf("VAD padding must be between 0 and %d ms, got %d", maxVADDurationMs, opts.VADPaddingMs)
+	}
+
+	return opts, nil
+}
+
+// checkThreshold rejects an entropy or logprob threshold of 0 given by the
+// user. Thresholds left at 0 get whisper's default, so a 0 would silently
+// be replaced by it rather than used.
+func checkThreshold(name string, value, defaultValue float64) error {
+	if value == 0 {
+		return fmt.Errorf("%s cannot be 0, which selects the default of %g", name, defaultValue)
+	}
+	return nil
+}
+
+// Validate reports whether the options are acceptable
+func (opts TranscribeOptions) Validate() error {
+	_, err := opts.Normalize()
+	return err
+}
+
+// decodingArgs maps normalized decoding parameters to whisper-cli flags
+func (opts TranscribeOptions) decodingArgs() []string {
+	args := []string{
+		"-t", fmt.Sprint(opts.Threads),
+		"-p", fmt.Sprint(opts.Processors),
+		"-bs", fmt.Sprint(opts.BeamSize),
+		"-bo", fmt.Sprint(opts.BestOf),
+		"-tp", fmt.Sprint(opts.Temperature),
+		"-et", fmt.Sprint(opts.EntropyThreshold),
+		"-lpt", fmt.Sprint(opts.LogprobThreshold),
+	}
+	if opts.MaxSegmentLength > 0 {
+		args = append(args, "-ml", fmt.Sprint(opts.MaxSegmentLength))
+	}
+	if opts.SplitOnWord {
+		args = append(args, "-sow")
+	}
+	return args
+}
+
+// String summarizes the decoding parameters for logs and console output
+func (opts TranscribeOptions) String() string {
+	summary := fmt.Sprintf("model=%s language=%s task=%s threads=%d processors=%d beam-size=%d best-of=%d temperature=%g entropy-threshold=%g logprob-threshold=%g",
+		opts.ModelSize, opts.Language, opts.Task, opts.Threads, opts.Processors, opts.BeamSize, opts.BestOf,
+		opts.Temperature, opts.EntropyThreshold, opts.LogprobThreshold)
+	if opts.MaxSegmentLength > 0 {
+		summary += fmt.Sprintf(" max-len=%d", opts.MaxSegmentLength)
+	}
+	if opts.SplitOnWord {
+		summary += " split-on-word"
+	}
+	if opts.Diarize {
+		summary += " diarize"
+		if opts.Speakers > 0 {
+			summary += fmt.Sprintf("(speakers=%d)", opts.Speakers)
+		}
+	}
+	if opts.SplitChannels {
+		summary += " split-channels"
+	}
+	if opts.Workers > 1 {
+		summary += fmt.Sprintf(" workers=%d chunk=%ds", opts.Workers, opts.ChunkSeconds)
+	}
+	if opts.VAD {
+		summary += fmt.Sprintf(" vad(threshold=%gdB min-speech=%dms min-silence=%dms padding=%dms)",
+			opts.VADThreshold, opts.VADMinSpeechMs, opts.VADMinSilenceMs, opts.VADPaddingMs)
+	}
+	return summary
+}
+
+// vadConfig maps normalized VAD options to the detector's configuration
+func (opts TranscribeOptions) vadConfig() vad.Config {
+	config := vad.DefaultConfig()
+	config.Threshold = opts.VADThreshold
+	config.MinSpeech = time.Duration(opts.VADMinSpeechMs) * time.Millisecond
+	config.MinSilence = time.Duration(opts.VADMinSilenceMs) * time.Millisecond
+	config.Padding = time.Duration(opts.VADPaddingMs) * time.Millisecond
+	return config
+}
+
+// Transcription tasks
+const (
+	TaskTranscribe = "transcribe"
+	TaskTranslate  = "translate"
+)
+
+// normalizeTask validates a task option for the given model. Translation
+// needs a multilingual model, so English-only models (*.en) are rejected.
+func normalizeTask(task, modelSize string) (string, error) {
+	task = strings.ToLower(strings.TrimSpace(task))
+	switch task {
+	case "", TaskTranscribe:
+		return TaskTranscribe, nil
+	case TaskTranslate:
+		if isEnglishOnlyModel(modelSize) {
+			return "", fmt.Errorf("model '%s' is English-only and cannot translate; choose a multilingual model such as '%s'", modelSize, strings.TrimSuffix(modelSize, ".en"))
+		}
+		return TaskTranslate, nil
+	default:
+		return "", fmt.Errorf("unknown task '%s'. Available tasks: %s, %s", task, TaskTranscribe, TaskTranslate)
+	}
+}
+
+// isEnglishOnlyModel reports whether a model name refers to an English-only
+// model such as "base.en"
+func isEnglishOnlyModel(modelSize string) bool {
+	return strings.HasSuffix(strings.TrimSuffix(modelSize, tinydiarizeSuffix), ".en")
+}
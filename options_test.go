@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeDefaults(t *testing.T) {
+	opts, err := TranscribeOptions{ModelSize: " small ", Language: "German", Task: "Translate"}.Normalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.ModelSize != "small" || opts.Language != "de" || opts.Task != TaskTranslate {
+		t.Errorf("model %q, language %q, task %q", opts.ModelSize, opts.Language, opts.Task)
+	}
+	if opts.Threads < 1 || opts.Processors != defaultProcessors || opts.BeamSize != defaultBeamSize || opts.BestOf != defaultBestOf {
+		t.Errorf("decoding defaults = %+v", opts)
+	}
+	if opts.Workers < 1 || opts.ChunkSeconds != defaultChunkSeconds {
+		t.Errorf("workers %d, chunk %ds", opts.Workers, opts.ChunkSeconds)
+	}
+	// VAD settings only apply with VAD on
+	if opts.VADThreshold != 0 || opts.VADPaddingMs != 0 {
+		t.Errorf("VAD settings without VAD: %+v", opts)
+	}
+
+	opts, err = TranscribeOptions{VAD: true, VADPaddingMs: 50}.Normalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.ModelSize != defaultModelSize || opts.Language != LanguageAuto || opts.Task != TaskTranscribe {
+		t.Errorf("model %q, language %q, task %q", opts.ModelSize, opts.Language, opts.Task)
+	}
+	if opts.VADThreshold == 0 || opts.VADMinSpeechMs == 0 || opts.VADPaddingMs != 50 {
+		t.Errorf("VAD settings = %+v", opts)
+	}
+
+	// Normalizing twice changes nothing
+	again, err := opts.Normalize()
+	if err != nil || again.Threads != opts.Threads || again.VADThreshold != opts.VADThreshold {
+		t.Errorf("Normalize is not idempotent: %+v, %v", again, err)
+	}
+}
+
+func TestNormalizeDropsSpeakersWithoutDiarize(t *testing.T) {
+	opts, err := TranscribeOptions{Speakers: 3}.Normalize()
+	if err != nil || opts.Speakers != 0 {
+		t.Errorf("speakers = %d, %v", opts.Speakers, err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		opts TranscribeOptions
+		want string
+	}{
+		{TranscribeOptions{Language: "klingon"}, "unsupported language 'klingon'"},
+		{TranscribeOptions{Task: "summarize"}, "unknown task 'summarize'"},
+		{TranscribeOptions{ModelSize: "base.en", Task: TaskTranslate}, "English-only"},
+		{TranscribeOptions{Threads: -1}, "threads must be between"},
+		{TranscribeOptions{BeamSize: maxBeamSize + 1}, "beam size must be between"},
+		{TranscribeOptions{Temperature: 1.5}, "temperature must be between"},
+		{TranscribeOptions{LogprobThreshold: 0.5}, "logprob threshold must be negative"},
+		{TranscribeOptions{SplitOnWord: true}, "split-on-word requires"},
+		{TranscribeOptions{Diarize: true, SplitChannels: true}, "use either diarize or split channels"},
+		{TranscribeOptions{Diarize: true, Speakers: maxSpeakers + 1}, "speakers must be between"},
+		{TranscribeOptions{ChunkSeconds: 10}, "chunk length must be between"},
+		{TranscribeOptions{VAD: true, VADThreshold: 100}, "VAD threshold must be between"},
+		{TranscribeOptions{PostProcessing: []ProcessorConfig{{Name: "shout"}}}, "unknown processor 'shout'"},
+	}
+	for _, test := range tests {
+		if err := test.opts.Validate(); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("Validate(%+v) = %v, want an error containing %q", test.opts, err, test.want)
+		}
+	}
+	if err := (TranscribeOptions{}).Validate(); err != nil {
+		t.Errorf("Validate of the defaults failed: %v", err)
+	}
+}
+
+// A threshold of 0 would be replaced by the default, so front-ends refuse it
+func TestCheckThreshold(t *testing.T) {
+	if err := checkThreshold("-entropy-threshold", 0, defaultEntropyThreshold); err == nil || err.Error() != "-entropy-threshold cannot be 0, which selects the default of 2.4" {
+		t.Errorf("checkThreshold(0) = %v", err)
+	}
+	for _, value := range []float64{0.01, -0.5, 2.4} {
+		if err := checkThreshold("-logprob-threshold", value, defaultLogprobThreshold); err != nil {
+			t.Errorf("checkThreshold(%g) = %v", value, err)
+		}
+	}
+}
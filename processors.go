@@ -0,0 +1,548 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ProcessorConfig selects a transcript processor by name together with its
+// settings, e.g. {"name": "replace", "options": {"find": "gonna", "with":
+// "going to"}}
+type ProcessorConfig struct {
+	Name    string            `json:"name"`
+	Options map[string]string `json:"options,omitempty"`
+}
+
+// Processor edits a transcription result after the engine has produced it,
+// e.g. to re-segment, redact or clean up the text
+type Processor interface {
+	// Process changes result in place and records what it changed in step
+	Process(result *TranscriptionResult, step *ProcessingStep) error
+}
+
+// ProcessingStep records a processor that ran on a result, so readers of a
+// transcript can tell how it differs from what whisper heard
+type ProcessingStep struct {
+	Name    string            `json:"name"`
+	Options map[string]string `json:"options,omitempty"`
+	// Changes counts the segments the processor changed, split or removed
+	Changes int `json:"changes"`
+	// Details describes individual changes for processors that report them
+	Details []string `json:"details,omitempty"`
+}
+
+// ProcessorFactory creates a processor from its settings, rejecting unknown
+// or invalid ones
+type ProcessorFactory func(options map[string]string) (Processor, error)
+
+type registeredProcessor struct {
+	description string
+	factory     ProcessorFactory
+	// fileOptions are the settings that name a file to read
+	fileOptions []string
+}
+
+var processorRegistry = make(map[string]registeredProcessor)
+
+// RegisterProcessor makes a processor available under name to the CLI, the
+// web API and project config files. Built-in processors register
+// themselves from init functions.
+func RegisterProcessor(name, description string, factory ProcessorFactory) {
+	if _, exists := processorRegistry[name]; exists {
+		panic(fmt.Sprintf("processor %s registered twice", name))
+	}
+	processorRegistry[name] = registeredProcessor{description: description, factory: factory}
+}
+
+// RegisterFileOptions marks settings of a registered processor that name a
+// file to read. They are accepted from the command line and project config
+// files but not from web requests, which must not make the server read
+// files of its choosing.
+func RegisterFileOptions(name string, options ...string) {
+	registered, ok := processorRegistry[name]
+	if !ok {
+		panic(fmt.Sprintf("file options for unregistered processor %s", name))
+	}
+	registered.fileOptions = append(registered.fileOptions, options...)
+	processorRegistry[name] = registered
+}
+
+// ProcessorNames lists the registered processors in alphabetical order
+func ProcessorNames() []string {
+	names := make([]string, 0, len(processorRegistry))
+	for name := range processorRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ProcessorDescription returns the one-line description of a processor
+func ProcessorDescription(name string) string {
+	return processorRegistry[name].description
+}
+
+// newProcessor creates the processor selected by config
+func newProcessor(config ProcessorConfig) (Processor, error) {
+	registered, ok := processorRegistry[config.Name]
+	if !ok {
+		return nil, fmt.Errorf("unknown processor '%s'. Available processors: %s", config.Name, strings.Join(ProcessorNames(), ", "))
+	}
+	processor, err := registered.factory(config.Options)
+	if err != nil {
+		return nil, fmt.Errorf("processor %s: %v", config.Name, err)
+	}
+	return processor, nil
+}
+
+// normalizeProcessors lower-cases processor names and checks that every
+// processor exists and accepts its settings
+func normalizeProcessors(configs []ProcessorConfig) ([]ProcessorConfig, error) {
+	if len(configs) == 0 {
+		return nil, nil
+	}
+	normalized := make([]ProcessorConfig, len(configs))
+	for i, config := range configs {
+		config.Name = strings.ToLower(strings.TrimSpace(config.Name))
+		if _, err := newProcessor(config); err != nil {
+			return nil, err
+		}
+		normalized[i] = config
+	}
+	return normalized, nil
+}
+
+// RunProcessors runs a pipeline of processors over result in order and
+// records each one in result.Processing
+func RunProcessors(result *TranscriptionResult, configs []ProcessorConfig) error {
+	if len(configs) == 0 {
+		return nil
+	}
+	for _, config := range configs {
+		processor, err := newProcessor(config)
+		if err != nil {
+			return err
+		}
+		step := ProcessingStep{Name: config.Name, Options: config.Options}
+		if err := processor.Process(result, &step); err != nil {
+			return fmt.Errorf("processor %s failed: %v", config.Name, err)
+		}
+		result.Processing = append(result.Processing, step)
+	}
+	result.Text = segmentsText(result.Segments)
+	return nil
+}
+
+// ParseProcessors reads a pipeline written on the command line or in a form
+// field: processors separated by commas, each optionally followed by a
+// colon and key=value settings separated by semicolons, e.g.
+// "replace:find=gonna;with=going to,casing:style=sentence". A value in
+// double quotes may hold commas and semicolons, with "" for a quote, e.g.
+// replace:find="\d{3,4}";regex=true. "none" is an empty pipeline, which
+// turns off the processors of a project config.
+func ParseProcessors(spec string) ([]ProcessorConfig, error) {
+	return parseProcessors(spec, false)
+}
+
+// ParseRequestProcessors reads a pipeline sent by a web client like
+// ParseProcessors, but rejects settings that name a file before any
+// processor can read it
+func ParseRequestProcessors(spec string) ([]ProcessorConfig, error) {
+	return parseProcessors(spec, true)
+}
+
+func parseProcessors(spec string, request bool) ([]ProcessorConfig, error) {
+	configs := []ProcessorConfig{}
+	if strings.TrimSpace(spec) == "none" {
+		return configs, nil
+	}
+	entries, err := splitSpec(spec, ',')
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		name, settings, _ := strings.Cut(entry, ":")
+		config := ProcessorConfig{Name: strings.TrimSpace(name)}
+		// The entry was split outside quotes, so its settings are too
+		settingList, _ := splitSpec(settings, ';')
+		for _, setting := range settingList {
+			if strings.TrimSpace(setting) == "" {
+				continue
+			}
+			key, value, ok := strings.Cut(setting, "=")
+			key = strings.TrimSpace(key)
+			if !ok || key == "" {
+				return nil, fmt.Errorf("invalid setting %q for processor %s (use key=value)", setting, config.Name)
+			}
+			if value, err = unquoteSetting(value); err != nil {
+				return nil, fmt.Errorf("invalid setting %q for processor %s: %v", setting, config.Name, err)
+			}
+			if config.Options == nil {
+				config.Options = make(map[string]string)
+			}
+			config.Options[key] = value
+		}
+		if request {
+			for _, option := range processorRegistry[strings.ToLower(config.Name)].fileOptions {
+				if _, ok := config.Options[option]; ok {
+					return nil, fmt.Errorf("processor %s: setting '%s' names a file on the server and is only accepted from the command line or project config", config.Name, option)
+				}
+			}
+		}
+		configs = append(configs, config)
+	}
+	return normalizeProcessors(configs)
+}
+
+// splitSpec splits part of a pipeline at sep, except inside a quoted value:
+// one that opens with a double quote right after the = of its setting
+func splitSpec(spec string, sep byte) ([]string, error) {
+	var parts []string
+	start, quoted := 0, false
+	for i := 0; i < len(spec); i++ {
+		switch {
+		case quoted:
+			if spec[i] == '"' {
+				if i+1 < len(spec) && spec[i+1] == '"' {
+					i++
+				} else {
+					quoted = false
+				}
+			}
+		case spec[i] == '"' && strings.HasSuffix(strings.TrimRight(spec[start:i], " "), "="):
+			quoted = true
+		case spec[i] == sep:
+			parts = append(parts, spec[start:i])
+			start = i + 1
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("missing closing quote in %q", spec[start:])
+	}
+	return append(parts, spec[start:]), nil
+}
+
+// unquoteSetting removes the quotes around a quoted setting value and turns
+// each "" inside it into a quote. Other values are returned as they are.
+func unquoteSetting(value string) (string, error) {
+	trimmed := strings.TrimSpace(value)
+	if !strings.HasPrefix(trimmed, `"`) {
+		return value, nil
+	}
+	inner := trimmed[1:]
+	end := 0
+	for end < len(inner) {
+		if inner[end] == '"' {
+			if end+1 < len(inner) && inner[end+1] == '"' {
+				end += 2
+				continue
+			}
+			break
+		}
+		end++
+	}
+	if end != len(inner)-1 {
+		return "", fmt.Errorf("text after the closing quote")
+	}
+	return strings.ReplaceAll(inner[:end], `""`, `"`), nil
+}
+
+// processorNames lists the processors of a pipeline for console output
+func processorNames(configs []ProcessorConfig) string {
+	names := make([]string, len(configs))
+	for i, config := range configs {
+		names[i] = config.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// checkProcessorOptions rejects settings a processor does not know, so
+// typos in a config file do not go unnoticed
+func checkProcessorOptions(options map[string]string, known ...string) error {
+	for key := range options {
+		found := false
+		for _, name := range known {
+			if key == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			if len(known) == 0 {
+				return fmt.Errorf("unknown setting '%s': it takes no settings", key)
+			}
+			return fmt.Errorf("unknown setting '%s'. Available settings: %s", key, strings.Join(known, ", "))
+		}
+	}
+	return nil
+}
+
+// processorBool reads a true/false setting, false when missing
+func processorBool(options map[string]string, key string) (bool, error) {
+	value, ok := options[key]
+	if !ok || value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q: expected true or false", key, value)
+	}
+	return b, nil
+}
+
+// processorFloat reads a number between min and max, or returns the default
+// when the setting is missing
+func processorFloat(options map[string]string, key string, defaultValue, min, max float64) (float64, error) {
+	value, ok := options[key]
+	if !ok || value == "" {
+		return defaultValue, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < min || f > max {
+		return 0, fmt.Errorf("invalid %s %q: expected a number between %g and %g", key, value, min, max)
+	}
+	return f, nil
+}
+
+// processorInt reads an integer between min and max, or returns the default
+// when the setting is missing
+func processorInt(options map[string]string, key string, defaultValue, min, max int) (int, error) {
+	value, ok := options[key]
+	if !ok || value == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min || n > max {
+		return 0, fmt.Errorf("invalid %s %q: expected an integer between %d and %d", key, value, min, max)
+	}
+	return n, nil
+}
+
+// withProcessor returns the pipeline with the named processor run first,
+// unless the pipeline already runs it
+func withProcessor(configs []ProcessorConfig, name string) []ProcessorConfig {
+	for _, config := range configs {
+		if config.Name == name {
+			return configs
+		}
+	}
+	return append([]ProcessorConfig{{Name: name}}, configs...)
+}
+
+// wordSpans finds each word's byte range in the segment text. ok is false
+// when a word cannot be found, e.g. after an earlier processor changed the
+// text but not the words.
+func wordSpans(text string, words []Word) (spans [][2]int, ok bool) {
+	if len(words) == 0 {
+		return nil, false
+	}
+	spans = make([][2]int, len(words))
+	position := 0
+	for i, word := range words {
+		index := strings.Index(text[position:], word.Text)
+		if index < 0 || word.Text == "" {
+			return nil, false
+		}
+		spans[i] = [2]int{position + index, position + index + len(word.Text)}
+		position = spans[i][1]
+	}
+	return spans, true
+}
+
+// joinWords joins the words of a segment with spaces and returns each
+// word's byte range in the joined text. Processors match on it when the
+// words no longer line up with the segment text, so the words are changed
+// along with the text.
+func joinWords(words []Word) (text string, spans [][2]int) {
+	var joined strings.Builder
+	spans = make([][2]int, len(words))
+	for i, word := range words {
+		if i > 0 {
+			joined.WriteString(" ")
+		}
+		spans[i][0] = joined.Len()
+		joined.WriteString(word.Text)
+		spans[i][1] = joined.Len()
+	}
+	return joined.String(), spans
+}
+
+func init() {
+	RegisterProcessor("replace", "Replace text: find=<text>;with=<text>[;regex=true][;ignorecase=true]", newReplaceProcessor)
+	RegisterProcessor("casing", "Change letter case: style=sentence, lower or upper", newCasingProcessor)
+}
+
+// replaceProcessor finds and replaces text in segments and their words
+type replaceProcessor struct {
+	pattern *regexp.Regexp
+	with    string
+}
+
+func newReplaceProcessor(options map[string]string) (Processor, error) {
+	if err := checkProcessorOptions(options, "find", "with", "regex", "ignorecase"); err != nil {
+		return nil, err
+	}
+	find := options["find"]
+	if find == "" {
+		return nil, fmt.Errorf("find is required")
+	}
+	isRegex, err := processorBool(options, "regex")
+	if err != nil {
+		return nil, err
+	}
+	ignoreCase, err := processorBool(options, "ignorecase")
+	if err != nil {
+		return nil, err
+	}
+
+	expression := find
+	if !isRegex {
+		expression = wholeWordPattern(find)
+	}
+	if ignoreCase {
+		expression = "(?i)" + expression
+	}
+	pattern, err := regexp.Compile(expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid find pattern: %v", err)
+	}
+
+	with := options["with"]
+	if !isRegex {
+		with = strings.ReplaceAll(with, "$", "$$")
+	}
+	return &replaceProcessor{pattern: pattern, with: with}, nil
+}
+
+// wholeWordPattern matches text only as whole words, so "cat" leaves
+// "category" alone. Boundaries are only required next to letters and
+// digits, so terms such as "C++" still match.
+func wholeWordPattern(text string) string {
+	pattern := regexp.QuoteMeta(text)
+	if r := []rune(text); isWordRune(r[0]) {
+		pattern = `\b` + pattern
+	}
+	if r := []rune(text); isWordRune(r[len(r)-1]) {
+		pattern += `\b`
+	}
+	return pattern
+}
+
+// isWordRune reports whether r can be part of a word for \b
+func isWordRune(r rune) bool {
+	return r == '_' || r < 128 && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// Process replaces matches in each segment's text. Words are replaced one
+// at a time, so a phrase spanning several words only changes the text.
+func (p *replaceProcessor) Process(result *TranscriptionResult, step *ProcessingStep) error {
+	for i := range result.Segments {
+		segment := &result.Segments[i]
+		text := p.pattern.ReplaceAllString(segment.Text, p.with)
+		if text == segment.Text {
+			continue
+		}
+		segment.Text = text
+		for j := range segment.Words {
+			segment.Words[j].Text = p.pattern.ReplaceAllString(segment.Words[j].Text, p.with)
+		}
+		step.Changes++
+	}
+	return nil
+}
+
+// Letter case styles of the casing processor
+const (
+	casingSentence = "sentence"
+	casingLower    = "lower"
+	casingUpper    = "upper"
+)
+
+// casingProcessor changes the letter case of segments and their words
+type casingProcessor struct {
+	style string
+}
+
+func newCasingProcessor(options map[string]string) (Processor, error) {
+	if err := checkProcessorOptions(options, "style"); err != nil {
+		return nil, err
+	}
+	style := options["style"]
+	switch style {
+	case "":
+		style = casingSentence
+	case casingSentence, casingLower, casingUpper:
+	default:
+		return nil, fmt.Errorf("unknown style '%s'. Available styles: %s, %s, %s", style, casingSentence, casingLower, casingUpper)
+	}
+	return &casingProcessor{style: style}, nil
+}
+
+// Process applies the style. Sentence case capitalizes the first letter of
+// the transcript and of every word that follows a full stop, question or
+// exclamation mark, and leaves other letters as whisper wrote them.
+func (p *casingProcessor) Process(result *TranscriptionResult, step *ProcessingStep) error {
+	textStart, wordStart := true, true
+	for i := range result.Segments {
+		segment := &result.Segments[i]
+		text := segment.Text
+		switch p.style {
+		case casingLower:
+			text = strings.ToLower(text)
+		case casingUpper:
+			text = strings.ToUpper(text)
+		case casingSentence:
+			text, textStart = sentenceCase(text, textStart)
+		}
+		for j := range segment.Words {
+			word := &segment.Words[j]
+			switch p.style {
+			case casingLower:
+				word.Text = strings.ToLower(word.Text)
+			case casingUpper:
+				word.Text = strings.ToUpper(word.Text)
+			case casingSentence:
+				word.Text, wordStart = sentenceCase(word.Text, wordStart)
+			}
+		}
+		if text != segment.Text {
+			segment.Text = text
+			step.Changes++
+		}
+	}
+	return nil
+}
+
+// sentenceCase capitalizes the first letter of text when a sentence starts
+// with it, and of every letter that follows sentence-ending punctuation. It
+// reports whether a new sentence starts after text.
+func sentenceCase(text string, sentenceStart bool) (string, bool) {
+	var cased strings.Builder
+	for _, r := range text {
+		switch {
+		case unicode.IsLetter(r):
+			if sentenceStart {
+				r = unicode.ToUpper(r)
+			}
+			sentenceStart = false
+		case unicode.IsDigit(r):
+			sentenceStart = false
+		case endsSentence(r):
+			sentenceStart = true
+		}
+		cased.WriteRune(r)
+	}
+	return cased.String(), sentenceStart
+}
+
+// endsSentence reports whether r is sentence-ending punctuation
+func endsSentence(r rune) bool {
+	return r == '.' || r == '?' || r == '!' || r == '。' || r == '？' || r == '！'
+}
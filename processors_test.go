@@ -0,0 +1,208 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func process(t *testing.T, configs []ProcessorConfig, segments ...Segment) *TranscriptionResult {
+	t.Helper()
+	result := &TranscriptionResult{Language: "en", Segments: segments}
+	if err := RunProcessors(result, configs); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestParseProcessors(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []ProcessorConfig
+	}{
+		{"", nil},
+		{"none", []ProcessorConfig{}},
+		{" Casing ", []ProcessorConfig{{Name: "casing"}}},
+		{"replace:find=gonna;with=going to,casing:style=lower", []ProcessorConfig{
+			{Name: "replace", Options: map[string]string{"find": "gonna", "with": "going to"}},
+			{Name: "casing", Options: map[string]string{"style": "lower"}},
+		}},
+		{"replace:find=a=b;with=,", []ProcessorConfig{{Name: "replace", Options: map[string]string{"find": "a=b", "with": ""}}}},
+		{`replace:find="a,b;c";with= "say ""hi"""`, []ProcessorConfig{{Name: "replace", Options: map[string]string{"find": "a,b;c", "with": `say "hi"`}}}},
+		{`replace:find=say "hi";with=x`, []ProcessorConfig{{Name: "replace", Options: map[string]string{"find": `say "hi"`, "with": "x"}}}},
+	}
+	for _, test := range tests {
+		got, err := ParseProcessors(test.spec)
+		if err != nil {
+			t.Errorf("ParseProcessors(%q) failed: %v", test.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseProcessors(%q) = %+v, want %+v", test.spec, got, test.want)
+		}
+	}
+}
+
+func TestParseProcessorsErrors(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"spellcheck", "unknown processor 'spellcheck'"},
+		{"replace:find", "invalid setting \"find\""},
+		{"replace:with=x", "find is required"},
+		{"replace:find=x;regex=maybe", "invalid regex"},
+		{"replace:find=(;regex=true", "invalid find pattern"},
+		{"casing:style=title", "unknown style 'title'"},
+		{"casing:case=upper", "unknown setting 'case'"},
+		{`replace:find="a,b;with=x`, "missing closing quote"},
+		{`replace:find="a"b;with=x`, "text after the closing quote"},
+	}
+	for _, test := range tests {
+		if _, err := ParseProcessors(test.spec); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("ParseProcessors(%q) = %v, want an error containing %q", test.spec, err, test.want)
+		}
+	}
+}
+
+// A quoted regular expression keeps its commas, semicolons and equals signs
+func TestParseProcessorsQuotedRegex(t *testing.T) {
+	pattern := `\d{3,4}|a;b|x=y`
+	configs, err := ParseProcessors(`replace:find="` + pattern + `";with=#;regex=true,casing:style=upper`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 2 || configs[0].Options["find"] != pattern || configs[0].Options["regex"] != "true" {
+		t.Fatalf("configs = %+v", configs)
+	}
+	result := process(t, configs, timedSegment(0, 0.5, "call 555 1234 about a;b and x=y"))
+	if result.Text != "CALL # # ABOUT # AND #" {
+		t.Errorf("text = %q", result.Text)
+	}
+}
+
+func TestRunProcessorsRecordsEveryStep(t *testing.T) {
+	configs := []ProcessorConfig{
+		{Name: "replace", Options: map[string]string{"find": "gonna", "with": "going to"}},
+		{Name: "replace", Options: map[string]string{"find": "nothing here"}},
+		{Name: "casing"},
+	}
+	result := process(t, configs, timedSegment(0, 0.5, "we are gonna win."), timedSegment(2, 0.5, "it works."))
+
+	if result.Text != "We are going to win. It works." {
+		t.Errorf("text = %q", result.Text)
+	}
+	var changes []int
+	for i, step := range result.Processing {
+		if step.Name != configs[i].Name {
+			t.Errorf("step %d = %s, want %s", i, step.Name, configs[i].Name)
+		}
+		changes = append(changes, step.Changes)
+	}
+	// A processor that changed nothing is still listed
+	if !reflect.DeepEqual(changes, []int{1, 0, 2}) {
+		t.Errorf("changes = %v, want [1 0 2]", changes)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	tests := []struct {
+		options map[string]string
+		text    string
+		want    string
+	}{
+		{map[string]string{"find": "cat", "with": "dog"}, "The cat sat in a category.", "The dog sat in a category."},
+		{map[string]string{"find": "cat", "with": "dog"}, "The Cat sat.", "The Cat sat."},
+		{map[string]string{"find": "cat", "with": "dog", "ignorecase": "true"}, "The Cat sat.", "The dog sat."},
+		{map[string]string{"find": "C++", "with": "C plus plus"}, "I like C++.", "I like C plus plus."},
+		{map[string]string{"find": "fee", "with": "$5"}, "The fee is due.", "The $5 is due."},
+		{map[string]string{"find": `(\d+) percent`, "with": "$1%", "regex": "true"}, "Up 20 percent.", "Up 20%."},
+	}
+	for _, test := range tests {
+		result := process(t, []ProcessorConfig{{Name: "replace", Options: test.options}}, timedSegment(0, 0.5, test.text))
+		if got := result.Segments[0].Text; got != test.want {
+			t.Errorf("replace %v in %q = %q, want %q", test.options, test.text, got, test.want)
+		}
+	}
+}
+
+// Words are replaced one at a time, so their times are kept
+func TestReplaceWords(t *testing.T) {
+	options := map[string]string{"find": "gonna", "with": "going to"}
+	result := process(t, []ProcessorConfig{{Name: "replace", Options: options}}, timedSegment(0, 0.5, "We gonna win."))
+	words := result.Segments[0].Words
+	if wordTexts(words) != "We going to win." || words[1].Start != 0.5 || words[1].End != 1 {
+		t.Errorf("words = %+v", words)
+	}
+}
+
+func TestCasing(t *testing.T) {
+	segments := func() []Segment {
+		return []Segment{timedSegment(0, 0.5, "hello there. how are you?"), timedSegment(2, 0.5, "fine, thanks! iPhone")}
+	}
+	tests := []struct {
+		style string
+		want  []string
+	}{
+		{"sentence", []string{"Hello there. How are you?", "Fine, thanks! IPhone"}},
+		{"lower", []string{"hello there. how are you?", "fine, thanks! iphone"}},
+		{"upper", []string{"HELLO THERE. HOW ARE YOU?", "FINE, THANKS! IPHONE"}},
+	}
+	for _, test := range tests {
+		options := map[string]string{"style": test.style}
+		result := process(t, []ProcessorConfig{{Name: "casing", Options: options}}, segments()...)
+		if got := sentenceTexts(result.Segments); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: segments = %q, want %q", test.style, got, test.want)
+		}
+		for _, segment := range result.Segments {
+			if words := wordTexts(segment.Words); words != segment.Text {
+				t.Errorf("%s: words = %q, want %q", test.style, words, segment.Text)
+			}
+		}
+	}
+}
+
+func TestSentenceCase(t *testing.T) {
+	if got, next := sentenceCase("3 cats. dogs", false); got != "3 cats. Dogs" || next {
+		t.Errorf("sentenceCase = %q, %v", got, next)
+	}
+	if got, next := sentenceCase("really?", true); got != "Really?" || !next {
+		t.Errorf("sentenceCase = %q, %v", got, next)
+	}
+}
+
+func TestNormalizeProcessors(t *testing.T) {
+	got, err := normalizeProcessors([]ProcessorConfig{{Name: " REPLACE ", Options: map[string]string{"find": "x"}}})
+	if err != nil || len(got) != 1 || got[0].Name != "replace" {
+		t.Errorf("normalizeProcessors = %+v, %v", got, err)
+	}
+	if got, err := normalizeProcessors(nil); got != nil || err != nil {
+		t.Errorf("normalizeProcessors(nil) = %+v, %v", got, err)
+	}
+}
+
+func TestWithProcessor(t *testing.T) {
+	configs := []ProcessorConfig{{Name: "casing"}}
+	if got := withProcessor(configs, "glossary"); len(got) != 2 || got[0].Name != "glossary" {
+		t.Errorf("withProcessor = %+v, want glossary first", got)
+	}
+	if got := withProcessor(configs, "casing"); len(got) != 1 {
+		t.Errorf("withProcessor = %+v, want casing once", got)
+	}
+}
+
+func TestWordSpans(t *testing.T) {
+	words := timedSegment(0, 1, "Hello, big world.").Words
+	spans, ok := wordSpans(" Hello, big world.", words)
+	if !ok || !reflect.DeepEqual(spans, [][2]int{{1, 7}, {8, 11}, {12, 18}}) {
+		t.Errorf("wordSpans = %v, %v", spans, ok)
+	}
+	if _, ok := wordSpans("Hello, small world.", words); ok {
+		t.Error("wordSpans found a word missing from the text")
+	}
+
+	text, spans := joinWords(words)
+	if text != "Hello, big world." || !reflect.DeepEqual(spans, [][2]int{{0, 6}, {7, 10}, {11, 17}}) {
+		t.Errorf("joinWords = %q, %v", text, spans)
+	}
+}
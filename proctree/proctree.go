@@ -0,0 +1,20 @@
+// Package proctree starts child processes in their own process group so
+// that the whole tree can be terminated when a transcription is canceled.
+package proctree
+
+import "os/exec"
+
+// Prepare configures cmd to start in a new process group. It must be
+// called before the command is started.
+func Prepare(cmd *exec.Cmd) {
+	prepare(cmd)
+}
+
+// Kill terminates the process started by cmd together with any children
+// it spawned. It is suitable for use as exec.Cmd.Cancel.
+func Kill(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return kill(cmd)
+}
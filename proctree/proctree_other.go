@@ -0,0 +1,11 @@
+//go:build !unix && !windows
+
+package proctree
+
+import "os/exec"
+
+func prepare(cmd *exec.Cmd) {}
+
+func kill(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
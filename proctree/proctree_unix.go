@@ -0,0 +1,28 @@
+//go:build unix
+
+package proctree
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+)
+
+func prepare(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+func kill(cmd *exec.Cmd) error {
+	// A negative pid signals every process in the group
+	err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	if errors.Is(err, syscall.ESRCH) {
+		return nil
+	}
+	if err != nil {
+		return cmd.Process.Kill()
+	}
+	return nil
+}
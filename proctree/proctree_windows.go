@@ -0,0 +1,25 @@
+//go:build windows
+
+package proctree
+
+import (
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+func prepare(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= syscall.CREATE_NEW_PROCESS_GROUP
+}
+
+func kill(cmd *exec.Cmd) error {
+	// taskkill /T terminates the process and all of its descendants
+	taskkill := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid))
+	if err := taskkill.Run(); err != nil {
+		return cmd.Process.Kill()
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Progress describes how far a running transcription has got
+type Progress struct {
+	Percent float64
+	Elapsed time.Duration
+	ETA     time.Duration // Zero until an estimate is available
+}
+
+// ProgressFunc receives progress updates while a transcription runs.
+// It is called from a background goroutine and should return quickly.
+type ProgressFunc func(Progress)
+
+// newProgress builds a progress report with an ETA extrapolated from the
+// time spent so far
+func newProgress(percent float64, start time.Time) Progress {
+	elapsed := time.Since(start)
+	progress := Progress{
+		Percent: percent,
+		Elapsed: elapsed,
+	}
+	if percent > 0 && percent < 100 {
+		progress.ETA = time.Duration(float64(elapsed) * (100 - percent) / percent)
+	}
+	return progress
+}
+
+// String formats the progress for display, e.g. "45% (elapsed 1m2s, ETA 1m16s)"
+func (p Progress) String() string {
+	if p.ETA > 0 {
+		return fmt.Sprintf("%3.0f%% (elapsed %s, ETA %s)", p.Percent, p.Elapsed.Round(time.Second), p.ETA.Round(time.Second))
+	}
+	return fmt.Sprintf("%3.0f%% (elapsed %s)", p.Percent, p.Elapsed.Round(time.Second))
+}
+
+// whisper-cli prints "whisper_print_progress_callback: progress =  45%" when run with -pp
+var progressLineRegex = regexp.MustCompile(`progress\s*=\s*(\d+(?:\.\d+)?)%`)
+
+// parseProgressLine extracts the percentage from a whisper-cli progress line
+func parseProgressLine(line string) (float64, bool) {
+	matches := progressLineRegex.FindStringSubmatch(line)
+	if len(matches) != 2 {
+		return 0, false
+	}
+
+	percent, err := strconv.ParseFloat(matches[1], 64)
+	if err != nil {
+		return 0, false
+	}
+	return percent, true
+}
+
+// progressWriter collects whisper's output and reports progress lines as
+// they arrive instead of waiting for the process to exit
+type progressWriter struct {
+	output     bytes.Buffer
+	partial    []byte
+	start      time.Time
+	onProgress ProgressFunc
+	last       float64
+}
+
+func newProgressWriter(onProgress ProgressFunc) *progressWriter {
+	return &progressWriter{
+		start:      time.Now(),
+		onProgress: onProgress,
+		last:       -1,
+	}
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	pw.output.Write(p)
+	if pw.onProgress == nil {
+		return len(p), nil
+	}
+
+	pw.partial = append(pw.partial, p...)
+	for {
+		idx := bytes.IndexAny(pw.partial, "\r\n")
+		if idx < 0 {
+			break
+		}
+		pw.handleLine(string(pw.partial[:idx]))
+		pw.partial = pw.partial[idx+1:]
+	}
+	return len(p), nil
+}
+
+func (pw *progressWriter) handleLine(line string) {
+	percent, ok := parseProgressLine(line)
+	if !ok || percent <= pw.last {
+		return
+	}
+	pw.report(percent)
+}
+
+// finish reports completion if whisper did not print a final 100% line
+func (pw *progressWriter) finish() {
+	if pw.onProgress != nil && pw.last < 100 {
+		pw.report(100)
+	}
+}
+
+func (pw *progressWriter) report(percent float64) {
+	pw.last = percent
+	pw.onProgress(newProgress(percent, pw.start))
+}
+
+// String returns everything whisper printed to stdout and stderr
+func (pw *progressWriter) String() string {
+	return pw.output.String()
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseProgressLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		percent float64
+		ok      bool
+	}{
+		{"whisper_print_progress_callback: progress =  45%", 45, true},
+		{"whisper_print_progress_callback: progress = 100%", 100, true},
+		{"progress=12.5%", 12.5, true},
+		{"whisper_full_with_state: auto-detected language: en (p = 0.97)", 0, false},
+		{"progress = %", 0, false},
+		{"[00:00:00.000 --> 00:00:02.000]  100% sure", 0, false},
+		{"", 0, false},
+	}
+	for _, test := range tests {
+		percent, ok := parseProgressLine(test.line)
+		if percent != test.percent || ok != test.ok {
+			t.Errorf("parseProgressLine(%q) = %v, %v, want %v, %v", test.line, percent, ok, test.percent, test.ok)
+		}
+	}
+}
+
+// progressPercents writes chunks to a progress writer and returns the
+// percentages reported
+func progressPercents(chunks ...string) []float64 {
+	var percents []float64
+	pw := newProgressWriter(func(p Progress) {
+		percents = append(percents, p.Percent)
+	})
+	for _, chunk := range chunks {
+		pw.Write([]byte(chunk))
+	}
+	return percents
+}
+
+func TestProgressWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		want   []float64
+	}{
+		{"whole lines", []string{"progress = 10%\n", "progress = 20%\n"}, []float64{10, 20}},
+		{"split writes", []string{"whisper_print_progress_callback: prog", "ress =  3", "5%\nprogress = 4", "0%\r"}, []float64{35, 40}},
+		{"several lines per write", []string{"progress = 5%\nother\nprogress = 15%\n"}, []float64{5, 15}},
+		{"lines without a percentage", []string{"loading model\n", "system_info: n_threads = 4\n"}, nil},
+		{"repeated and falling values", []string{"progress = 50%\nprogress = 50%\nprogress = 30%\n"}, []float64{50}},
+		{"unterminated line", []string{"progress = 60%"}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			percents := progressPercents(test.chunks...)
+			if !reflect.DeepEqual(percents, test.want) {
+				t.Errorf("reported %v, want %v", percents, test.want)
+			}
+		})
+	}
+}
+
+func TestProgressWriterFinish(t *testing.T) {
+	var reported []float64
+	pw := newProgressWriter(func(p Progress) { reported = append(reported, p.Percent) })
+	pw.Write([]byte("progress = 80%\n"))
+	pw.finish()
+	if !reflect.DeepEqual(reported, []float64{80, 100}) {
+		t.Errorf("reported %v, want completion after 80", reported)
+	}
+
+	reported = nil
+	pw = newProgressWriter(func(p Progress) { reported = append(reported, p.Percent) })
+	pw.Write([]byte("progress = 100%\n"))
+	pw.finish()
+	if !reflect.DeepEqual(reported, []float64{100}) {
+		t.Errorf("reported %v, want 100 once", reported)
+	}
+}
+
+// Output is kept whether or not progress was requested
+func TestProgressWriterKeepsOutput(t *testing.T) {
+	pw := newProgressWriter(nil)
+	pw.Write([]byte("progress = 10%\nerror: "))
+	pw.Write([]byte("model not found\n"))
+	pw.finish()
+	if pw.String() != "progress = 10%\nerror: model not found\n" {
+		t.Errorf("output = %q", pw.String())
+	}
+}
+
+func TestNewProgress(t *testing.T) {
+	start := time.Now().Add(-10 * time.Second)
+	progress := newProgress(25, start)
+	if progress.ETA < 29*time.Second || progress.ETA > 31*time.Second {
+		t.Errorf("ETA = %s at 25%% after 10s, want about 30s", progress.ETA)
+	}
+	if done := newProgress(100, start); done.ETA != 0 {
+		t.Errorf("ETA = %s when done", done.ETA)
+	}
+	if none := newProgress(0, start); none.ETA != 0 || none.String() != "  0% (elapsed 10s)" {
+		t.Errorf("progress = %+v, %q", none, none.String())
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Whisper keeps at most half of its 448-token text context for the initial
+// prompt. We cannot tokenize in Go, so limits are enforced on characters
+// using a conservative estimate of roughly four characters per token.
+const (
+	maxPromptChars       = 800
+	maxGlossaryTermChars = 64
+)
+
+// LoadGlossary reads a glossary file with one term per line. Blank lines
+// and lines starting with # are ignored.
+func LoadGlossary(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open glossary: %v", err)
+	}
+	defer file.Close()
+
+	terms, err := ParseGlossary(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read glossary %s: %v", path, err)
+	}
+	return terms, nil
+}
+
+// ParseGlossary reads glossary terms, one per line
+func ParseGlossary(r io.Reader) ([]string, error) {
+	var terms []string
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		term := strings.TrimSpace(scanner.Text())
+		if term == "" || strings.HasPrefix(term, "#") {
+			continue
+		}
+		if len([]rune(term)) > maxGlossaryTermChars {
+			return nil, fmt.Errorf("line %d: term is longer than %d characters", lineNumber, maxGlossaryTermChars)
+		}
+		if seen[strings.ToLower(term)] {
+			continue
+		}
+		seen[strings.ToLower(term)] = true
+		terms = append(terms, term)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return terms, nil
+}
+
+// buildPrompt combines the initial prompt and glossary terms into the text
+// passed to whisper's --prompt option. Glossary terms that would make it
+// longer than whisper can use are left out; see promptGlossary. It returns
+// an error if the initial prompt alone is too long.
+func buildPrompt(prompt string, glossary []string) (string, error) {
+	prompt = strings.Join(strings.Fields(prompt), " ")
+	if length := len([]rune(prompt)); length > maxPromptChars {
+		return "", fmt.Errorf("prompt is too long: %d characters (max %d)", length, maxPromptChars)
+	}
+	terms, err := promptGlossary(prompt, glossary)
+	if err != nil {
+		return "", err
+	}
+
+	// Listing the terms in the prompt biases whisper towards their spelling
+	combined := prompt
+	if len(terms) > 0 {
+		vocabulary := strings.Join(terms, ", ") + "."
+		if combined != "" {
+			combined += " " + vocabulary
+		} else {
+			combined = vocabulary
+		}
+	}
+	return combined, nil
+}
+
+// promptGlossary returns the glossary terms that fit in the prompt after
+// the initial prompt, in glossary order. A project glossary can be longer
+// than a prompt; the terms left out still correct the transcript through
+// the glossary processor.
+func promptGlossary(prompt string, glossary []string) ([]string, error) {
+	prompt = strings.Join(strings.Fields(prompt), " ")
+	length := len([]rune(prompt))
+	var terms []string
+	for _, term := range glossary {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		if len([]rune(term)) > maxGlossaryTermChars {
+			return nil, fmt.Errorf("glossary term '%s' is longer than %d characters", term, maxGlossaryTermChars)
+		}
+		// Each term adds a separator before it and the final period
+		added := len([]rune(term)) + 2
+		if length+added > maxPromptChars {
+			continue
+		}
+		length += added
+		terms = append(terms, term)
+	}
+	return terms, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseGlossary(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"terms", "Kubernetes\nPostgreSQL\n", []string{"Kubernetes", "PostgreSQL"}},
+		{"comments and blank lines", "# product names\n\n  Kubernetes  \n   \n#PostgreSQL\n", []string{"Kubernetes"}},
+		{"duplicates ignoring case", "OpenAI\nopenai\nOPENAI\nRedis\n", []string{"OpenAI", "Redis"}},
+		{"windows line endings", "Kubernetes\r\nRedis\r\n", []string{"Kubernetes", "Redis"}},
+		{"longest term", strings.Repeat("é", maxGlossaryTermChars), []string{strings.Repeat("é", maxGlossaryTermChars)}},
+		{"empty", "", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			terms, err := ParseGlossary(strings.NewReader(test.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(terms, test.want) {
+				t.Errorf("terms = %q, want %q", terms, test.want)
+			}
+		})
+	}
+
+	long := "Kubernetes\n" + strings.Repeat("x", maxGlossaryTermChars+1) + "\n"
+	if _, err := ParseGlossary(strings.NewReader(long)); err == nil || !strings.Contains(err.Error(), "line 2: term is longer than 64 characters") {
+		t.Errorf("ParseGlossary of a long term = %v", err)
+	}
+}
+
+func TestLoadGlossary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "terms.txt")
+	if err := os.WriteFile(path, []byte("# team\nKubernetes\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if terms, err := LoadGlossary(path); err != nil || !reflect.DeepEqual(terms, []string{"Kubernetes"}) {
+		t.Errorf("LoadGlossary = %q, %v", terms, err)
+	}
+	if _, err := LoadGlossary(filepath.Join(t.TempDir(), "missing.txt")); err == nil || !strings.Contains(err.Error(), "failed to open glossary") {
+		t.Errorf("LoadGlossary of a missing file = %v", err)
+	}
+}
+
+func TestBuildPrompt(t *testing.T) {
+	// Terms of 20 characters that fill the prompt with 22 characters each
+	var terms []string
+	for i := 0; i < maxPromptChars/22+2; i++ {
+		terms = append(terms, fmt.Sprintf("term%016d", i))
+	}
+
+	tests := []struct {
+		name     string
+		prompt   string
+		glossary []string
+		want     string
+	}{
+		{"nothing", "", nil, ""},
+		{"prompt only", "  A standup\n meeting. ", nil, "A standup meeting."},
+		{"glossary only", "", []string{"Kubernetes", " Redis ", ""}, "Kubernetes, Redis."},
+		{"prompt and glossary", "A standup.", []string{"Kubernetes", "Redis"}, "A standup. Kubernetes, Redis."},
+		{"longest prompt", strings.Repeat("a", maxPromptChars), []string{"Kubernetes"}, strings.Repeat("a", maxPromptChars)},
+		{"glossary cut to fit", "", terms, strings.Join(terms[:maxPromptChars/22], ", ") + "."},
+		{"shorter terms still fit", strings.Repeat("a", maxPromptChars-10), []string{"Kubernetes", "Redis"}, strings.Repeat("a", maxPromptChars-10) + " Redis."},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			prompt, err := buildPrompt(test.prompt, test.glossary)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if prompt != test.want {
+				t.Errorf("prompt = %q, want %q", prompt, test.want)
+			}
+			if len([]rune(prompt)) > maxPromptChars {
+				t.Errorf("prompt is %d characters long", len([]rune(prompt)))
+			}
+		})
+	}
+}
+
+func TestBuildPromptErrors(t *testing.T) {
+	tests := []struct {
+		prompt   string
+		glossary []string
+		want     string
+	}{
+		{strings.Repeat("a", maxPromptChars+1), nil, "prompt is too long: 801 characters (max 800)"},
+		{"", []string{strings.Repeat("x", maxGlossaryTermChars+1)}, "is longer than 64 characters"},
+	}
+	for _, test := range tests {
+		if _, err := buildPrompt(test.prompt, test.glossary); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("buildPrompt = %v, want an error containing %q", err, test.want)
+		}
+	}
+	if _, err := (TranscribeOptions{Prompt: strings.Repeat("a", maxPromptChars+1)}).Normalize(); err == nil {
+		t.Error("Normalize accepted a prompt that is too long")
+	}
+}
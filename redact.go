@@ -0,0 +1,468 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// redactProcessor is the name the redaction processor is registered under
+const redactProcessor = "redact"
+
+// Built-in detectors of the redaction processor
+const (
+	RedactEmail     = "email"
+	RedactPhone     = "phone"
+	RedactCard      = "card"
+	RedactProfanity = "profanity"
+	redactAll       = "all"
+	redactCustom    = "custom"
+)
+
+// redactDetectors lists the built-in detectors in the order they are
+// tried; a credit card number is reported as a card, not a phone number
+var redactDetectors = []string{RedactEmail, RedactCard, RedactPhone, RedactProfanity}
+
+// Mask styles of the redaction processor
+const (
+	maskLabel  = "label"  // [EMAIL], [PHONE], ...
+	maskStars  = "stars"  // every redacted character becomes *
+	maskRemove = "remove" // the text is dropped
+)
+
+var (
+	// emailRegex matches written addresses and addresses spelled out the
+	// way whisper often transcribes them, e.g. "jane dot doe at example
+	// dot com"
+	emailRegex = regexp.MustCompile(`(?i)\b[a-z0-9._%+-]+@[a-z0-9.-]+\.[a-z]{2,}\b|` +
+		`\b[a-z0-9_-]+(?: dot [a-z0-9_-]+)* at [a-z0-9-]+(?: dot [a-z0-9-]+)*? dot (?:com|org|net|edu|gov|io|co|uk|de|fr|es|it|nl)\b`)
+
+	// cardRegex matches 13 to 19 digits, optionally grouped by spaces or
+	// dashes; matches must also pass the Luhn check
+	cardRegex = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+
+	// phoneRegex matches numbers written the way phone numbers are: with a
+	// country code, an area code in brackets or a trunk prefix 0, in groups
+	// of 3, 3 and 4 digits, or as 555-1234. Matches must also have 7 to 15
+	// digits. Plain digit runs, such as order numbers, amounts and years,
+	// are left alone.
+	phoneRegex = regexp.MustCompile(`(?:\+ ?\d{1,3}(?:[ .-]?\(\d{1,4}\))?(?:[ .-]?\d{2,4}){2,5}|` +
+		`\(\d{2,5}\)[ .-]?\d{3,4}[ .-]?\d{3,4}|` +
+		`\b(?:1[ .-])?\d{3}[ .-]\d{3}[ .-]\d{4}|` +
+		`\b0[1-9]\d{1,3}[ .-]?\d{3,4}[ .-]?\d{3,4}|` +
+		`\b\d{3}[.-]\d{4})\b`)
+
+	// profanityRegex matches common English swear words and their
+	// inflections
+	profanityRegex = regexp.MustCompile(`(?i)\b(?:(?:mother)?fuck\w*|\w*shit\w*|bitch\w*|bastards?|assholes?|arseholes?|` +
+		`dicks?|cunts?|(?:god)?damn(?:ed|it)?|crap(?:py)?|piss(?:ed)?|bollocks|wank\w*|twats?|pricks?|sluts?|whores?)\b`)
+)
+
+func init() {
+	RegisterProcessor(redactProcessor, "Mask personal data and profanity: detect=all or email|phone|card|profanity, words=<a|b>, wordsfile=<file>, pattern=<regex>, mask=label, stars or remove", newRedactProcessor)
+	RegisterFileOptions(redactProcessor, "wordsfile")
+}
+
+// Redaction records one piece of redacted text, for the redaction map
+type Redaction struct {
+	Start    float64 `json:"start"`
+	End      float64 `json:"end"`
+	Kind     string  `json:"kind"`
+	Original string  `json:"original"`
+	Mask     string  `json:"mask"`
+}
+
+// redactDetector finds one kind of sensitive text
+type redactDetector struct {
+	kind    string
+	pattern *regexp.Regexp
+	// valid, when set, confirms a match, e.g. a card number's checksum
+	valid func(match string) bool
+}
+
+// redactionProcessor masks phone numbers, email addresses, card numbers,
+// profanity and custom words or patterns in segments and their words
+type redactionProcessor struct {
+	detectors []redactDetector
+	mask      string
+}
+
+func newRedactProcessor(options map[string]string) (Processor, error) {
+	if err := checkProcessorOptions(options, "detect", "words", "wordsfile", "pattern", "mask"); err != nil {
+		return nil, err
+	}
+	processor := &redactionProcessor{mask: options["mask"]}
+	switch processor.mask {
+	case "":
+		processor.mask = maskLabel
+	case maskLabel, maskStars, maskRemove:
+	default:
+		return nil, fmt.Errorf("unknown mask '%s'. Available masks: %s, %s, %s", processor.mask, maskLabel, maskStars, maskRemove)
+	}
+
+	// Without custom words or patterns every built-in detector runs
+	detect := options["detect"]
+	if detect == "" && options["words"] == "" && options["wordsfile"] == "" && options["pattern"] == "" {
+		detect = redactAll
+	}
+	kinds, err := parseRedactKinds(detect)
+	if err != nil {
+		return nil, err
+	}
+	for _, kind := range kinds {
+		processor.detectors = append(processor.detectors, builtinDetector(kind))
+	}
+
+	// Custom words are matched as whole words, ignoring case
+	words := splitList(options["words"])
+	if path := options["wordsfile"]; path != "" {
+		fileWords, err := readWordList(path)
+		if err != nil {
+			return nil, err
+		}
+		words = append(words, fileWords...)
+	}
+	if len(words) > 0 {
+		alternatives := make([]string, len(words))
+		for i, word := range words {
+			alternatives[i] = wholeWordPattern(word)
+		}
+		processor.detectors = append(processor.detectors, redactDetector{
+			kind:    redactCustom,
+			pattern: regexp.MustCompile(`(?i)(?:` + strings.Join(alternatives, "|") + `)`),
+		})
+	}
+	if expression := options["pattern"]; expression != "" {
+		pattern, err := regexp.Compile(expression)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern: %v", err)
+		}
+		processor.detectors = append(processor.detectors, redactDetector{kind: redactCustom, pattern: pattern})
+	}
+	return processor, nil
+}
+
+// parseRedactKinds reads a list of built-in detectors separated by commas
+// or "|", or "all"
+func parseRedactKinds(value string) ([]string, error) {
+	var kinds []string
+	for _, kind := range splitList(strings.ReplaceAll(value, ",", "|")) {
+		kind = strings.ToLower(kind)
+		if kind == redactAll {
+			return redactDetectors, nil
+		}
+		known := false
+		for _, detector := range redactDetectors {
+			known = known || kind == detector
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown detector '%s'. Available detectors: %s, %s", kind, strings.Join(redactDetectors, ", "), redactAll)
+		}
+		kinds = append(kinds, kind)
+	}
+	return kinds, nil
+}
+
+// RedactionConfig returns the redaction processor configured from the
+// -redact command line option or the redact form field
+func RedactionConfig(detect, mask string) (ProcessorConfig, error) {
+	config := ProcessorConfig{Name: redactProcessor, Options: map[string]string{"detect": detect}}
+	if mask != "" {
+		config.Options["mask"] = mask
+	}
+	_, err := newProcessor(config)
+	return config, err
+}
+
+// withRedaction returns the pipeline with redaction run last, so no later
+// processor can bring redacted text back. A redaction already in the
+// pipeline is replaced.
+func withRedaction(configs []ProcessorConfig, redaction ProcessorConfig) []ProcessorConfig {
+	var pipeline []ProcessorConfig
+	for _, config := range configs {
+		if config.Name != redactProcessor {
+			pipeline = append(pipeline, config)
+		}
+	}
+	return append(pipeline, redaction)
+}
+
+func builtinDetector(kind string) redactDetector {
+	switch kind {
+	case RedactEmail:
+		return redactDetector{kind: kind, pattern: emailRegex}
+	case RedactCard:
+		return redactDetector{kind: kind, pattern: cardRegex, valid: luhnValid}
+	case RedactPhone:
+		return redactDetector{kind: kind, pattern: phoneRegex, valid: func(match string) bool {
+			digits := countDigits(match)
+			return digits >= 7 && digits <= 15
+		}}
+	default:
+		return redactDetector{kind: RedactProfanity, pattern: profanityRegex}
+	}
+}
+
+// splitList splits a list separated by "|", dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, "|") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// readWordList reads one word or phrase per line; blank lines and lines
+// starting with # are ignored
+func readWordList(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read word list: %v", err)
+	}
+	defer file.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			words = append(words, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read word list: %v", err)
+	}
+	return words, nil
+}
+
+func countDigits(s string) int {
+	digits := 0
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			digits++
+		}
+	}
+	return digits
+}
+
+// luhnValid reports whether the digits of s pass the Luhn checksum used by
+// payment card numbers
+func luhnValid(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] < '0' || s[i] > '9' {
+			continue
+		}
+		digit := int(s[i] - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// redactMatch is a span of a segment's text to redact
+type redactMatch struct {
+	start, end int
+	kind       string
+}
+
+// find returns the non-overlapping matches of every detector in text. Of
+// overlapping matches the earliest wins, then the longest, then the
+// detector listed first.
+func (p *redactionProcessor) find(text string) []redactMatch {
+	var matches []redactMatch
+	for _, detector := range p.detectors {
+		for _, span := range detector.pattern.FindAllStringIndex(text, -1) {
+			if span[1] > span[0] && (detector.valid == nil || detector.valid(text[span[0]:span[1]])) {
+				matches = append(matches, redactMatch{span[0], span[1], detector.kind})
+			}
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].start != matches[j].start {
+			return matches[i].start < matches[j].start
+		}
+		return matches[i].end > matches[j].end
+	})
+
+	var kept []redactMatch
+	for _, match := range matches {
+		if n := len(kept); n == 0 || match.start >= kept[n-1].end {
+			kept = append(kept, match)
+		}
+	}
+	return kept
+}
+
+// maskFor returns the text that replaces a match
+func (p *redactionProcessor) maskFor(match redactMatch, original string) string {
+	switch p.mask {
+	case maskStars:
+		return stars(original)
+	case maskRemove:
+		return ""
+	default:
+		return "[" + strings.ToUpper(match.kind) + "]"
+	}
+}
+
+// Process redacts every segment. Each word touched by a match is masked
+// where the match covers it and keeps its timestamps; with label or remove
+// masks the words of one match are joined into a single word spanning their
+// time. Words that no longer line up with the text, e.g. after a processor
+// replaced a phrase, are matched on their own, so personal data never stays
+// in the words beside redacted text. Every redaction is recorded in
+// result.Redactions, while the step's details only count them, so the
+// originals never reach logs.
+func (p *redactionProcessor) Process(result *TranscriptionResult, step *ProcessingStep) error {
+	counts := make(map[string]int)
+	for i := range result.Segments {
+		segment := &result.Segments[i]
+		matches := p.find(segment.Text)
+		spans, aligned := wordSpans(segment.Text, segment.Words)
+		wordMatches := matches
+		if !aligned && len(segment.Words) > 0 {
+			var joined string
+			joined, spans = joinWords(segment.Words)
+			wordMatches = p.find(joined)
+		}
+		if len(matches) == 0 && len(wordMatches) == 0 {
+			continue
+		}
+
+		var text strings.Builder
+		previous := 0
+		for _, match := range matches {
+			original := segment.Text[match.start:match.end]
+			mask := p.maskFor(match, original)
+			text.WriteString(segment.Text[previous:match.start])
+			text.WriteString(mask)
+			previous = match.end
+
+			redaction := Redaction{Start: segment.Start, End: segment.End, Kind: match.kind, Original: original, Mask: mask}
+			if aligned {
+				if first, last, ok := overlappingWords(spans, match.start, match.end); ok {
+					redaction.Start, redaction.End = segment.Words[first].Start, segment.Words[last].End
+				}
+			}
+			result.Redactions = append(result.Redactions, redaction)
+			counts[match.kind]++
+		}
+		text.WriteString(segment.Text[previous:])
+		segment.Text = strings.TrimSpace(collapseSpaces(text.String()))
+
+		// Matches are masked from the end, so a word touched by two matches
+		// still has the text the earlier match's offsets refer to
+		for k := len(wordMatches) - 1; k >= 0; k-- {
+			match := wordMatches[k]
+			p.maskWords(segment.Words, spans, match, p.maskFor(match, ""))
+		}
+		segment.Words = dropEmptyWords(segment.Words)
+		step.Changes++
+	}
+
+	for _, kind := range append(redactDetectors, redactCustom) {
+		if counts[kind] > 0 {
+			step.Details = append(step.Details, fmt.Sprintf("%d %s redacted", counts[kind], kind))
+		}
+	}
+	return nil
+}
+
+// maskWords masks the words overlapping a match of the text the spans
+// refer to. With stars every covered character is masked in place; otherwise
+// the first word takes mask and the time of the whole match.
+func (p *redactionProcessor) maskWords(words []Word, spans [][2]int, match redactMatch, mask string) {
+	first, last, ok := overlappingWords(spans, match.start, match.end)
+	if !ok {
+		return
+	}
+
+	for i := first; i <= last; i++ {
+		word := &words[i]
+		wordText := word.Text
+		from := max(match.start, spans[i][0]) - spans[i][0]
+		to := min(match.end, spans[i][1]) - spans[i][0]
+		part := ""
+		switch {
+		case p.mask == maskStars:
+			part = stars(wordText[from:to])
+		case i == first:
+			part = mask
+		}
+		word.Text = wordText[:from] + part + wordText[to:]
+	}
+	if p.mask != maskStars {
+		// The masked word covers the time of the whole match
+		words[first].End = words[last].End
+		for i := first + 1; i <= last; i++ {
+			if strings.TrimSpace(words[i].Text) == "" {
+				words[i].Text = ""
+			}
+		}
+	}
+}
+
+// dropEmptyWords removes words whose text was redacted away
+func dropEmptyWords(words []Word) []Word {
+	if words == nil {
+		return nil
+	}
+	kept := words[:0]
+	for _, word := range words {
+		if strings.TrimSpace(word.Text) != "" {
+			kept = append(kept, word)
+		}
+	}
+	return kept
+}
+
+// stars replaces every character of text but spaces with *
+func stars(text string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return r
+		}
+		return '*'
+	}, text)
+}
+
+// spaceBeforePunctuation matches spaces left before punctuation by removed
+// text, e.g. "my number is ."
+var spaceBeforePunctuation = regexp.MustCompile(`\s+([.,;:!?])`)
+
+// collapseSpaces replaces runs of spaces left by removed text with one
+func collapseSpaces(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	return spaceBeforePunctuation.ReplaceAllString(text, "$1")
+}
+
+// WriteRedactionMap saves the redactions of a result as JSON, so that an
+// authorized reader can tell what each mask stands for. The file holds the
+// original text and is only readable by its owner.
+func WriteRedactionMap(path string, redactions []Redaction) error {
+	if redactions == nil {
+		redactions = []Redaction{}
+	}
+	data, err := json.MarshalIndent(redactions, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("cannot write redaction map: %v", err)
+	}
+	return nil
+}
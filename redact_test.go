@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func redact(t *testing.T, options map[string]string, segments ...Segment) *TranscriptionResult {
+	t.Helper()
+	result := &TranscriptionResult{Language: "en", Segments: segments}
+	if err := RunProcessors(result, []ProcessorConfig{{Name: redactProcessor, Options: options}}); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestRedactDetectors(t *testing.T) {
+	tests := []struct {
+		text   string
+		detect string
+		want   string
+	}{
+		{"Call 555-123-4567 now.", "phone", "Call [PHONE] now."},
+		{"Call +1 (555) 123 4567.", "phone", "Call [PHONE]."},
+		{"It costs 1999 dollars.", "phone", "It costs 1999 dollars."},
+		{"Call (555) 123-4567 or 1-800-555-0199.", "phone", "Call [PHONE] or [PHONE]."},
+		{"Ring +44 20 7946 0958 or 020 7946 0958.", "phone", "Ring [PHONE] or [PHONE]."},
+		{"Dial 555-0134.", "phone", "Dial [PHONE]."},
+		{"Order 48213977 and order 1002003004 shipped.", "phone", "Order 48213977 and order 1002003004 shipped."},
+		{"We raised 1 000 000 dollars.", "phone", "We raised 1 000 000 dollars."},
+		{"Sales grew from 2019 2020 to 2021.", "phone", "Sales grew from 2019 2020 to 2021."},
+		{"Ticket 0000123456 is closed.", "phone", "Ticket 0000123456 is closed."},
+		{"Mail jane.doe@example.com today.", "email", "Mail [EMAIL] today."},
+		{"Mail jane dot doe at example dot com today.", "email", "Mail [EMAIL] today."},
+		{"Pay with 4111 1111 1111 1111 please.", "all", "Pay with [CARD] please."},
+		{"The order 4111 1111 1111 1112 shipped.", "card", "The order 4111 1111 1111 1112 shipped."},
+		{"Well damn, that shit happens.", "profanity", "Well [PROFANITY], that [PROFANITY] happens."},
+		{"Call 555-123-4567.", "email", "Call 555-123-4567."},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			result := redact(t, map[string]string{"detect": test.detect}, Segment{Text: test.text})
+			if got := result.Segments[0].Text; got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRedactMasks(t *testing.T) {
+	tests := []struct {
+		mask string
+		want string
+	}{
+		{maskLabel, "Call me at [PHONE], thanks."},
+		{maskStars, "Call me at *** *** ****, thanks."},
+		{maskRemove, "Call me at, thanks."},
+	}
+	for _, test := range tests {
+		t.Run(test.mask, func(t *testing.T) {
+			segment := timedSegment(0, 0.5, "Call me at 555 123 4567, thanks.")
+			result := redact(t, map[string]string{"detect": "phone", "mask": test.mask}, segment)
+			got := result.Segments[0]
+			if got.Text != test.want {
+				t.Errorf("text = %q, want %q", got.Text, test.want)
+			}
+			var words []string
+			for _, word := range got.Words {
+				words = append(words, word.Text)
+			}
+			if joined := strings.Join(words, " "); strings.ContainsAny(joined, "0123456789") {
+				t.Errorf("words still hold the number: %q", joined)
+			}
+		})
+	}
+}
+
+func TestRedactLabelJoinsWords(t *testing.T) {
+	segment := timedSegment(0, 1, "Call 555 123 4567 now")
+	result := redact(t, map[string]string{"detect": "phone"}, segment)
+	words := result.Segments[0].Words
+	if len(words) != 3 || words[1].Text != "[PHONE]" || words[1].Start != 1 || words[1].End != 4 {
+		t.Fatalf("words = %+v, want [PHONE] spanning 1s-4s", words)
+	}
+	if len(result.Redactions) != 1 {
+		t.Fatalf("redactions = %+v", result.Redactions)
+	}
+	redaction := result.Redactions[0]
+	if redaction.Original != "555 123 4567" || redaction.Kind != RedactPhone || redaction.Start != 1 || redaction.End != 4 {
+		t.Errorf("redaction = %+v", redaction)
+	}
+	for _, detail := range result.Processing[0].Details {
+		if strings.Contains(detail, "555") {
+			t.Errorf("details leak the original: %q", detail)
+		}
+	}
+}
+
+func TestRedactCustomWords(t *testing.T) {
+	wordsFile := filepath.Join(t.TempDir(), "words.txt")
+	if err := os.WriteFile(wordsFile, []byte("# names\nAcme Corp\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	result := redact(t, map[string]string{"words": "Falcon", "wordsfile": wordsFile, "pattern": `ACC-\d+`},
+		Segment{Text: "Project falcon for acme corp, ticket ACC-42."})
+	if got, want := result.Segments[0].Text, "Project [CUSTOM] for [CUSTOM], ticket [CUSTOM]."; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// Personal data must not come back through words left stale by an earlier
+// text-only edit, in any output granularity
+func TestRedactWordsThatDisagreeWithText(t *testing.T) {
+	result := &TranscriptionResult{Language: "en", Segments: []Segment{timedSegment(0, 0.5, "My number is 555 123 4567.")}}
+	pipeline, err := ParseProcessors("replace:find=My number;with=The number")
+	if err != nil {
+		t.Fatal(err)
+	}
+	redaction, err := RedactionConfig("all", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RunProcessors(result, withRedaction(pipeline, redaction)); err != nil {
+		t.Fatal(err)
+	}
+	if got := result.Segments[0].Text; got != "The number is [PHONE]." {
+		t.Fatalf("text = %q", got)
+	}
+	for _, granularity := range []string{GranularityParagraph, GranularitySentence, GranularityWord} {
+		output := FormatResults(result, FormatOptions{Granularity: granularity})
+		if strings.Contains(output, "555") || strings.Contains(output, "4567") {
+			t.Errorf("%s output leaks the number: %q", granularity, output)
+		}
+	}
+}
+
+func TestRedactOptions(t *testing.T) {
+	for _, options := range []map[string]string{
+		{"detect": "ssn"},
+		{"mask": "blur"},
+		{"pattern": "("},
+		{"wordsfile": "/does/not/exist"},
+		{"unknown": "x"},
+	} {
+		if _, err := newRedactProcessor(options); err == nil {
+			t.Errorf("options %v accepted", options)
+		}
+	}
+	if config, err := RedactionConfig("phone, email", "stars"); err != nil || config.Options["mask"] != "stars" {
+		t.Errorf("RedactionConfig = %+v, %v", config, err)
+	}
+}
+
+func TestWithRedactionRunsLast(t *testing.T) {
+	pipeline := []ProcessorConfig{{Name: redactProcessor}, {Name: "casing"}}
+	got := withRedaction(pipeline, ProcessorConfig{Name: redactProcessor, Options: map[string]string{"detect": "email"}})
+	if processorNames(got) != "casing, redact" || got[1].Options["detect"] != "email" {
+		t.Errorf("pipeline = %+v", got)
+	}
+}
+
+func TestLuhnValid(t *testing.T) {
+	for number, want := range map[string]bool{
+		"4111 1111 1111 1111": true,
+		"5500-0000-0000-0004": true,
+		"4111 1111 1111 1112": false,
+		"1234567812345678":    false,
+	} {
+		if got := luhnValid(number); got != want {
+			t.Errorf("luhnValid(%q) = %v, want %v", number, got, want)
+		}
+	}
+}
+
+func TestWriteRedactionMap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "map.json")
+	redactions := []Redaction{{Start: 1, End: 2, Kind: RedactEmail, Original: "a@b.io", Mask: "[EMAIL]"}}
+	if err := WriteRedactionMap(path, redactions); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("map is readable by others: %v", info.Mode())
+	}
+	data, _ := os.ReadFile(path)
+	var read []Redaction
+	if err := json.Unmarshal(data, &read); err != nil || len(read) != 1 || read[0] != redactions[0] {
+		t.Errorf("map = %s, %v", data, err)
+	}
+}
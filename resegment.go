@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Re-segmentation defaults
+const (
+	// defaultParagraphPause is the silence, in seconds, between two
+	// sentences that starts a new paragraph
+	defaultParagraphPause = 2.0
+
+	// defaultMaxSentence is the longest sentence, in seconds, before it is
+	// cut even without punctuation, e.g. when whisper wrote none
+	defaultMaxSentence = 30.0
+)
+
+// abbreviations end with a full stop without ending the sentence
+var abbreviations = map[string]bool{
+	"mr.": true, "mrs.": true, "ms.": true, "dr.": true, "prof.": true, "st.": true,
+	"jr.": true, "sr.": true, "vs.": true, "e.g.": true, "i.e.": true, "approx.": true,
+	"no.": true, "fig.": true, "inc.": true, "ltd.": true, "co.": true,
+}
+
+// spacelessLanguages are written without spaces between words
+var spacelessLanguages = map[string]bool{
+	"zh": true, "ja": true, "th": true, "lo": true, "my": true, "km": true, "yue": true,
+}
+
+func init() {
+	RegisterProcessor("resegment", "Split segments into sentences and group them into paragraphs: pause=<seconds>, maxsentence=<seconds>", newResegmentProcessor)
+}
+
+// resegmentProcessor replaces whisper's segments, which break mid-sentence
+// and ignore pauses, with one segment per sentence
+type resegmentProcessor struct {
+	paragraphPause float64
+	maxSentence    float64
+}
+
+func newResegmentProcessor(options map[string]string) (Processor, error) {
+	if err := checkProcessorOptions(options, "pause", "maxsentence"); err != nil {
+		return nil, err
+	}
+	processor := &resegmentProcessor{}
+	var err error
+	if processor.paragraphPause, err = processorSeconds(options, "pause", defaultParagraphPause); err != nil {
+		return nil, err
+	}
+	if processor.maxSentence, err = processorSeconds(options, "maxsentence", defaultMaxSentence); err != nil {
+		return nil, err
+	}
+	return processor, nil
+}
+
+// processorSeconds reads a positive duration in seconds, or returns the
+// default when the setting is missing
+func processorSeconds(options map[string]string, key string, defaultValue float64) (float64, error) {
+	value, ok := options[key]
+	if !ok || value == "" {
+		return defaultValue, nil
+	}
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil || seconds <= 0 {
+		return 0, fmt.Errorf("invalid %s %q: expected a positive number of seconds", key, value)
+	}
+	return seconds, nil
+}
+
+func (p *resegmentProcessor) Process(result *TranscriptionResult, step *ProcessingStep) error {
+	before := result.Segments
+	result.Segments = resegment(result.Segments, result.Language, p.paragraphPause, p.maxSentence)
+
+	original := make(map[string]bool, len(before))
+	for _, segment := range before {
+		original[segmentKey(segment)] = true
+	}
+	for _, segment := range result.Segments {
+		if !original[segmentKey(segment)] {
+			step.Changes++
+		}
+	}
+	if n := len(result.Segments); n > 0 {
+		step.Details = append(step.Details, fmt.Sprintf("%d segments became %d sentences in %d paragraphs",
+			len(before), n, result.Segments[n-1].Paragraph))
+	}
+	return nil
+}
+
+// segmentKey identifies a segment by its timing and text
+func segmentKey(segment Segment) string {
+	return fmt.Sprintf("%.3f|%.3f|%s", segment.Start, segment.End, segment.Text)
+}
+
+// timedWord is a word of the transcript with the segment it came from
+type timedWord struct {
+	Word
+	source int
+	// last is set for the last word of its source segment
+	last bool
+}
+
+// transcriptWords lists every word of segments in order. Segments without
+// word timings, e.g. read from SRT, have their duration shared among their
+// words in proportion to the words' lengths. So do segments whose words no
+// longer match their text, e.g. after a processor replaced a phrase, as the
+// text is what the transcript shows.
+func transcriptWords(segments []Segment) []timedWord {
+	var words []timedWord
+	for i, segment := range segments {
+		segmentWords := segment.Words
+		if _, aligned := wordSpans(segment.Text, segment.Words); !aligned {
+			segmentWords = interpolateWords(segment)
+		}
+		for j, word := range segmentWords {
+			words = append(words, timedWord{Word: word, source: i, last: j == len(segmentWords)-1})
+		}
+	}
+	return words
+}
+
+// interpolateWords estimates word timings from a segment's text
+func interpolateWords(segment Segment) []Word {
+	fields := strings.Fields(segment.Text)
+	total := 0
+	for _, field := range fields {
+		total += utf8.RuneCountInString(field)
+	}
+	words := make([]Word, 0, len(fields))
+	start, done := segment.Start, 0
+	for _, field := range fields {
+		done += utf8.RuneCountInString(field)
+		end := segment.Start + (segment.End-segment.Start)*float64(done)/float64(total)
+		words = append(words, Word{Start: start, End: end, Text: field})
+		start = end
+	}
+	return words
+}
+
+// endsSentenceWord reports whether a word ends a sentence: it ends with a
+// full stop, question or exclamation mark, possibly followed by closing
+// quotes or brackets, and is not a known abbreviation
+func endsSentenceWord(text string) bool {
+	trimmed := strings.TrimRight(text, "\"'”’»)]")
+	if trimmed == "" || !endsSentence(lastRune(trimmed)) {
+		return false
+	}
+	return !abbreviations[strings.ToLower(trimmed)]
+}
+
+// lastRune returns the last rune of s, or 0 when s is empty
+func lastRune(s string) rune {
+	r, _ := utf8.DecodeLastRuneInString(s)
+	if r == utf8.RuneError {
+		return 0
+	}
+	return r
+}
+
+// resegment rebuilds segments as one segment per sentence. Sentences end at
+// sentence punctuation, at a change of speaker or channel, at a pause of
+// paragraphPause or more, and after maxSentence seconds. Consecutive
+// sentences of one speaker form a paragraph until such a pause; each
+// segment's Paragraph numbers its paragraph from 1.
+func resegment(segments []Segment, language string, paragraphPause, maxSentence float64) []Segment {
+	words := transcriptWords(segments)
+	if len(words) == 0 {
+		return segments
+	}
+	separator := " "
+	if spacelessLanguages[language] {
+		separator = ""
+	}
+
+	var sentences []Segment
+	var current []timedWord
+	paragraph := 1
+	flush := func() {
+		if len(current) == 0 {
+			return
+		}
+		first, last := current[0], current[len(current)-1]
+		source := segments[first.source]
+		sentence := Segment{
+			Start:       first.Start,
+			End:         last.End,
+			Speaker:     source.Speaker,
+			Channel:     source.Channel,
+			SpeakerTurn: last.last && segments[last.source].SpeakerTurn,
+			Paragraph:   paragraph,
+		}
+		texts := make([]string, len(current))
+		for i, word := range current {
+			texts[i] = word.Text
+			if len(segments[word.source].Words) > 0 {
+				sentence.Words = append(sentence.Words, word.Word)
+			}
+			if sentence.Flagged == "" {
+				sentence.Flagged = segments[word.source].Flagged
+			}
+		}
+		sentence.Text = strings.Join(texts, separator)
+		sentence.Tokens = sentenceTokens(segments, current)
+		sentences = append(sentences, sentence)
+		current = nil
+	}
+
+	for i, word := range words {
+		if i > 0 {
+			previous := words[i-1]
+			pause := word.Start - previous.End
+			speakerChange := segments[word.source].Speaker != segments[previous.source].Speaker ||
+				segments[word.source].Channel != segments[previous.source].Channel
+			switch {
+			case speakerChange || pause >= paragraphPause:
+				flush()
+				if len(sentences) > 0 {
+					paragraph = sentences[len(sentences)-1].Paragraph + 1
+				}
+			case endsSentenceWord(previous.Text) || word.Start-current[0].Start >= maxSentence:
+				flush()
+			}
+		}
+		current = append(current, word)
+	}
+	flush()
+	return sentences
+}
+
+// sentenceTokens collects the tokens of the source segments that fall within
+// a sentence's words
+func sentenceTokens(segments []Segment, words []timedWord) []Token {
+	start, end := words[0].Start, words[len(words)-1].End
+	var tokens []Token
+	for source := words[0].source; source <= words[len(words)-1].source; source++ {
+		for _, token := range segments[source].Tokens {
+			if token.Start >= start && token.Start < end {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	return tokens
+}
+
+// sentenceSegments returns the transcript as sentences for formatting. A
+// result that was re-segmented is used as it is; otherwise a copy is
+// re-segmented with the defaults, unless a maximum segment length was asked
+// for, which the caller wants kept.
+func sentenceSegments(result *TranscriptionResult) []Segment {
+	if result.Options.MaxSegmentLength > 0 {
+		return result.Segments
+	}
+	return resegmented(result)
+}
+
+// resegmented returns the segments of a re-segmented result, or those of a
+// copy re-segmented with the defaults
+func resegmented(result *TranscriptionResult) []Segment {
+	if len(result.Segments) == 0 || result.Segments[0].Paragraph > 0 {
+		return result.Segments
+	}
+	return resegment(result.Segments, result.Language, defaultParagraphPause, defaultMaxSentence)
+}
+
+// paragraphSegments groups the sentences of a transcript into one segment
+// per paragraph
+func paragraphSegments(result *TranscriptionResult) []Segment {
+	separator := " "
+	if spacelessLanguages[result.Language] {
+		separator = ""
+	}
+
+	var paragraphs []Segment
+	for _, sentence := range resegmented(result) {
+		n := len(paragraphs)
+		if n == 0 || paragraphs[n-1].Paragraph != sentence.Paragraph {
+			sentence.Tokens = nil
+			paragraphs = append(paragraphs, sentence)
+			continue
+		}
+		paragraph := &paragraphs[n-1]
+		paragraph.End = sentence.End
+		paragraph.Text = displayText(*paragraph) + separator + displayText(sentence)
+		paragraph.Flagged = ""
+		paragraph.Words = append(paragraph.Words, sentence.Words...)
+		paragraph.SpeakerTurn = sentence.SpeakerTurn
+	}
+	return paragraphs
+}
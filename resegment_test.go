@@ -0,0 +1,140 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// timedSegment builds a segment whose words are the fields of text, each
+// lasting step seconds from start
+func timedSegment(start, step float64, text string) Segment {
+	segment := Segment{Start: start, Text: text}
+	for i, field := range strings.Fields(text) {
+		wordStart := start + float64(i)*step
+		segment.Words = append(segment.Words, Word{Start: wordStart, End: wordStart + step, Text: field, Probability: 0.9})
+	}
+	segment.End = start + float64(len(segment.Words))*step
+	return segment
+}
+
+func sentenceTexts(segments []Segment) []string {
+	texts := make([]string, len(segments))
+	for i, segment := range segments {
+		texts[i] = segment.Text
+	}
+	return texts
+}
+
+func TestResegmentSplitsSentences(t *testing.T) {
+	tests := []struct {
+		name       string
+		segments   []Segment
+		want       []string
+		paragraphs []int
+	}{
+		{
+			name: "sentences across segments",
+			segments: []Segment{
+				timedSegment(0, 0.5, "Hello there. This is"),
+				timedSegment(2, 0.5, "a test. Bye."),
+			},
+			want:       []string{"Hello there.", "This is a test.", "Bye."},
+			paragraphs: []int{1, 1, 1},
+		},
+		{
+			name: "abbreviations do not end sentences",
+			segments: []Segment{
+				timedSegment(0, 0.5, "Ask Dr. Smith, e.g. today. Thanks."),
+			},
+			want:       []string{"Ask Dr. Smith, e.g. today.", "Thanks."},
+			paragraphs: []int{1, 1},
+		},
+		{
+			name: "pauses start paragraphs",
+			segments: []Segment{
+				timedSegment(0, 0.5, "First point. Second point."),
+				timedSegment(10, 0.5, "After the break."),
+			},
+			want:       []string{"First point.", "Second point.", "After the break."},
+			paragraphs: []int{1, 1, 2},
+		},
+		{
+			name: "speaker changes end sentences",
+			segments: []Segment{
+				func() Segment { s := timedSegment(0, 0.5, "so what do you"); s.Speaker = "SPEAKER_1"; return s }(),
+				func() Segment { s := timedSegment(2, 0.5, "think about it"); s.Speaker = "SPEAKER_2"; return s }(),
+			},
+			want:       []string{"so what do you", "think about it"},
+			paragraphs: []int{1, 2},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sentences := resegment(test.segments, "en", defaultParagraphPause, defaultMaxSentence)
+			if got := sentenceTexts(sentences); strings.Join(got, "|") != strings.Join(test.want, "|") {
+				t.Fatalf("sentences = %q, want %q", got, test.want)
+			}
+			for i, sentence := range sentences {
+				if sentence.Paragraph != test.paragraphs[i] {
+					t.Errorf("sentence %d paragraph = %d, want %d", i, sentence.Paragraph, test.paragraphs[i])
+				}
+				if len(sentence.Words) == 0 || sentence.Start != sentence.Words[0].Start || sentence.End != sentence.Words[len(sentence.Words)-1].End {
+					t.Errorf("sentence %d spans %.2f-%.2f, not its words", i, sentence.Start, sentence.End)
+				}
+			}
+		})
+	}
+}
+
+func TestResegmentLongSentence(t *testing.T) {
+	segment := timedSegment(0, 1, strings.Repeat("word ", 50))
+	sentences := resegment([]Segment{segment}, "en", defaultParagraphPause, 10)
+	if len(sentences) != 5 {
+		t.Fatalf("got %d sentences, want 5 of at most 10 seconds", len(sentences))
+	}
+}
+
+// Words left stale by a text-only edit must not bring the old wording back
+// into sentence or paragraph output
+func TestResegmentUsesTextWhenWordsDisagree(t *testing.T) {
+	segment := timedSegment(0, 0.5, "We use cooper netties daily.")
+	segment.Text = "We use Kubernetes daily."
+	result := &TranscriptionResult{Language: "en", Segments: []Segment{segment}}
+
+	for _, granularity := range []string{GranularitySentence, GranularityParagraph} {
+		output := FormatResults(result, FormatOptions{Granularity: granularity})
+		if !strings.Contains(output, "We use Kubernetes daily.") || strings.Contains(output, "cooper") {
+			t.Errorf("%s output = %q, want the edited text", granularity, output)
+		}
+	}
+
+	sentences := resegment(result.Segments, "en", defaultParagraphPause, defaultMaxSentence)
+	if len(sentences) != 1 || len(sentences[0].Words) != 4 {
+		t.Fatalf("sentences = %+v, want one sentence with 4 interpolated words", sentences)
+	}
+	if words := sentences[0].Words; words[0].Start != 0 || words[3].End != segment.End || words[2].Text != "Kubernetes" {
+		t.Errorf("interpolated words = %+v", words)
+	}
+}
+
+func TestResegmentProcessorReportsParagraphs(t *testing.T) {
+	result := &TranscriptionResult{Language: "en", Segments: []Segment{
+		timedSegment(0, 0.5, "One. Two."),
+		timedSegment(5, 0.5, "Three."),
+	}}
+	if err := RunProcessors(result, []ProcessorConfig{{Name: "resegment", Options: map[string]string{"pause": "1"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := sentenceTexts(result.Segments); strings.Join(got, "|") != "One.|Two.|Three." {
+		t.Fatalf("segments = %q", got)
+	}
+	if result.Segments[2].Paragraph != 2 {
+		t.Errorf("paragraph = %d, want 2", result.Segments[2].Paragraph)
+	}
+	if result.Text != "One. Two. Three." {
+		t.Errorf("text = %q", result.Text)
+	}
+	if _, err := newProcessor(ProcessorConfig{Name: "resegment", Options: map[string]string{"pause": "-1"}}); err == nil {
+		t.Error("negative pause accepted")
+	}
+}
@@ -17,6 +17,7 @@ type ResourceManager struct {
 	tempDir       string
 	whisperPath   string
 	modelsDir     string
+	jobsDir       string
 	indexHTMLPath string
 }
 
@@ -32,6 +33,7 @@ func NewResourceManager() (*ResourceManager, error) {
 		tempDir:       tempDir,
 		whisperPath:   filepath.Join(tempDir, "whisper"),
 		modelsDir:     filepath.Join(tempDir, "models"),
+		jobsDir:       filepath.Join(tempDir, "jobs"),
 		indexHTMLPath: filepath.Join(tempDir, "index.html"),
 	}
 
@@ -53,6 +55,9 @@ func (rm *ResourceManager) extractResources() error {
 	if err := os.MkdirAll(rm.modelsDir, 0755); err != nil {
 		return fmt.Errorf("failed to create models directory: %v", err)
 	}
+	if err := os.MkdirAll(rm.jobsDir, 0700); err != nil {
+		return fmt.Errorf("failed to create jobs directory: %v", err)
+	}
 
 	// Extract whisper executables and DLLs
 	whisperFiles, err := embeddedResources.ReadDir("bundle/resources/whisper")
@@ -153,6 +158,17 @@ func (rm *ResourceManager) GetTempDir() string {
 	return rm.tempDir
 }
 
+// NewJobDir creates a private working directory for a single job. The
+// caller removes it when the job finishes; anything left over is removed
+// by Cleanup.
+func (rm *ResourceManager) NewJobDir() (string, error) {
+	jobDir, err := os.MkdirTemp(rm.jobsDir, "job-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create job directory: %v", err)
+	}
+	return jobDir, nil
+}
+
 // Cleanup removes all extracted temporary files
 func (rm *ResourceManager) Cleanup() error {
 	if rm.tempDir != "" {
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"localtts/audio"
+	"localtts/diarize"
+)
+
+// speakerTurnMarker is printed by whisper-cli after a segment when
+// tinydiarize predicts that the next segment has a different speaker
+const speakerTurnMarker = "[SPEAKER_TURN]"
+
+// tinydiarizeSuffix marks whisper.cpp models fine-tuned for speaker turns,
+// such as ggml-small.en-tdrz.bin
+const tinydiarizeSuffix = "-tdrz"
+
+// isDiarizationModel reports whether a model predicts speaker turns
+func isDiarizationModel(modelSize string) bool {
+	return strings.HasSuffix(modelSize, tinydiarizeSuffix)
+}
+
+// speakerTurns reports whether speakers are labeled from tinydiarize's
+// turns rather than by clustering voices. Turns only tell two speakers
+// apart, so more speakers are always clustered.
+func (opts TranscribeOptions) speakerTurns() bool {
+	return opts.Diarize && isDiarizationModel(opts.ModelSize) && opts.Speakers <= 2
+}
+
+// speakerID names the n-th speaker, counting from 1
+func speakerID(n int) string {
+	return fmt.Sprintf("SPEAKER_%d", n)
+}
+
+// labelSpeakerTurns assigns speakers from tinydiarize's turn markers.
+// tinydiarize only predicts where the speaker changes, not who speaks, so
+// turns alternate between two speakers; this suits interviews and calls.
+func labelSpeakerTurns(segments []Segment) {
+	speaker := 1
+	for i := range segments {
+		segments[i].Speaker = speakerID(speaker)
+		if segments[i].SpeakerTurn {
+			speaker = 3 - speaker
+		}
+	}
+}
+
+// labelSpeakerClusters assigns speakers by comparing voices in the audio
+// of each segment, for models that do not predict speaker turns. Each
+// segment gets the speaker heard for most of it. decoded is the 16 kHz mono
+// WAV of the whole recording that was prepared for whisper; only the audio
+// of the segments is read from it.
+func labelSpeakerClusters(ctx context.Context, decoded string, segments []Segment, opts TranscribeOptions) error {
+	if len(segments) == 0 {
+		return nil
+	}
+	reader, err := audio.OpenWAV(decoded)
+	if err != nil {
+		return fmt.Errorf("cannot read the decoded audio to label speakers: %w", err)
+	}
+	defer reader.Close()
+	source := func(start, end int64) ([]float32, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return reader.ReadFrames(start, end)
+	}
+
+	regions := make([]diarize.Region, len(segments))
+	for i, segment := range segments {
+		regions[i] = diarize.Region{Start: segment.Start, End: segment.End}
+	}
+	config := diarize.DefaultConfig()
+	config.Speakers = opts.Speakers
+	turns, err := diarize.DetectSource(source, reader.Frames(), audio.WhisperSampleRate, regions, config)
+	if err != nil {
+		return fmt.Errorf("cannot read the decoded audio to label speakers: %w", err)
+	}
+
+	for i := range segments {
+		segment := &segments[i]
+		speaker, longest := 0, 0.0
+		for _, turn := range turns {
+			if overlap := math.Min(turn.End, segment.End) - math.Max(turn.Start, segment.Start); overlap > longest {
+				speaker, longest = turn.Speaker, overlap
+			}
+		}
+		segment.Speaker = speakerID(speaker + 1)
+	}
+	return nil
+}
+
+// stripSpeakerTurn removes a trailing turn marker from a segment's text and
+// reports whether there was one
+func stripSpeakerTurn(text string) (string, bool) {
+	trimmed := strings.TrimSpace(text)
+	if !strings.HasSuffix(trimmed, speakerTurnMarker) {
+		return text, false
+	}
+	return strings.TrimSpace(strings.TrimSuffix(trimmed, speakerTurnMarker)), true
+}
+
+// ParseSpeakerNames reads speaker names given as "SPEAKER_1=Alice,
+// SPEAKER_2=Bob". Entries may be separated by commas or newlines.
+func ParseSpeakerNames(value string) (map[string]string, error) {
+	names := make(map[string]string)
+	for _, entry := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' }) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, name, ok := strings.Cut(entry, "=")
+		id, name = strings.TrimSpace(id), strings.TrimSpace(name)
+		if !ok || id == "" || name == "" {
+			return nil, fmt.Errorf("invalid speaker name %q (use SPEAKER_1=Alice)", entry)
+		}
+		names[id] = name
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	return names, nil
+}
+
+// speakerLabel returns the name given to a speaker, or its ID
+func speakerLabel(speaker string, names map[string]string) string {
+	if name, ok := names[speaker]; ok {
+		return name
+	}
+	return speaker
+}
+
+// labeledLineRegex matches the label of a line written by FormatResults:
+// "[00:00:01 - 00:00:04] SPEAKER_1: text" or a "SPEAKER_1:" heading
+var labeledLineRegex = regexp.MustCompile(`^(\[[^\]]*\] )?([^:\[\]]+):( |$)`)
+
+// RenameSpeakers replaces speaker labels in a transcript written by
+// FormatResults, so speakers can be named after they were identified
+func RenameSpeakers(transcript string, names map[string]string) string {
+	lines := strings.Split(transcript, "\n")
+	for i, line := range lines {
+		match := labeledLineRegex.FindStringSubmatchIndex(line)
+		if match == nil {
+			continue
+		}
+		label := line[match[4]:match[5]]
+		if name, ok := names[label]; ok {
+			lines[i] = line[:match[4]] + name + line[match[5]:]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// resultSpeakers lists the speakers of a result in order of appearance
+func resultSpeakers(result *TranscriptionResult) []string {
+	seen := make(map[string]int)
+	for _, segment := range result.Segments {
+		if _, ok := seen[segment.Speaker]; !ok && segment.Speaker != "" {
+			seen[segment.Speaker] = len(seen)
+		}
+	}
+	speakers := make([]string, 0, len(seen))
+	for speaker := range seen {
+		speakers = append(speakers, speaker)
+	}
+	sort.Slice(speakers, func(i, j int) bool {
+		return seen[speakers[i]] < seen[speakers[j]]
+	})
+	return speakers
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestStripSpeakerTurn(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+		turn bool
+	}{
+		{" Hello there. [SPEAKER_TURN]", "Hello there.", true},
+		{"Hello there.[SPEAKER_TURN] ", "Hello there.", true},
+		{" Hello there.", " Hello there.", false},
+		{"[SPEAKER_TURN] Hello there.", "[SPEAKER_TURN] Hello there.", false},
+		{"[SPEAKER_TURN]", "", true},
+	}
+	for _, test := range tests {
+		if text, turn := stripSpeakerTurn(test.text); text != test.want || turn != test.turn {
+			t.Errorf("stripSpeakerTurn(%q) = %q, %v, want %q, %v", test.text, text, turn, test.want, test.turn)
+		}
+	}
+}
+
+// speakerTurnSRT is whisper's output for a tinydiarize model: a marker ends
+// each segment after which the speaker changes
+const speakerTurnSRT = `1
+00:00:00,000 --> 00:00:02,000
+ How was the trip? [SPEAKER_TURN]
+
+2
+00:00:02,000 --> 00:00:04,000
+ Long.
+
+3
+00:00:04,000 --> 00:00:06,000
+ The train was late. [SPEAKER_TURN]
+
+4
+00:00:06,000 --> 00:00:08,000
+ Again? [SPEAKER_TURN]
+
+5
+00:00:08,000 --> 00:00:10,000
+ Yes.
+`
+
+func TestLabelSpeakerTurns(t *testing.T) {
+	segments := (&WhisperTranscriber{}).parseSRTFormat(speakerTurnSRT)
+	labelSpeakerTurns(segments)
+	want := []string{"SPEAKER_1", "SPEAKER_2", "SPEAKER_2", "SPEAKER_1", "SPEAKER_2"}
+	if len(segments) != len(want) {
+		t.Fatalf("segments = %+v", segments)
+	}
+	for i, segment := range segments {
+		if segment.Speaker != want[i] {
+			t.Errorf("segment %d %q speaker = %s, want %s", i, segment.Text, segment.Speaker, want[i])
+		}
+		if strings.Contains(segment.Text, "SPEAKER_TURN") {
+			t.Errorf("segment %d keeps the marker: %q", i, segment.Text)
+		}
+	}
+}
+
+// Diarizing with an installed tinydiarize model labels speakers from its
+// turns and leaves no markers in the transcript
+func TestTranscribeLabelsSpeakerTurns(t *testing.T) {
+	wt, _ := newStubTranscriber(t, `printf '%s' "$SRT" > "$of.srt"`)
+	t.Setenv("SRT", speakerTurnSRT)
+	if err := os.WriteFile(wt.resourceManager.GetModelPath("base"+tinydiarizeSuffix), []byte("model"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := wt.TranscribeContext(context.Background(), writeSpeechWAV(t, 10, 0, 10), TranscribeOptions{Diarize: true, Speakers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Model.Name != "base"+tinydiarizeSuffix {
+		t.Errorf("model = %s, want the tinydiarize variant", result.Model.Name)
+	}
+	var speakers []string
+	for _, segment := range result.Segments {
+		speakers = append(speakers, segment.Speaker)
+	}
+	if got := strings.Join(speakers, ","); got != "SPEAKER_1,SPEAKER_2,SPEAKER_2,SPEAKER_1,SPEAKER_2" {
+		t.Errorf("speakers = %s", got)
+	}
+	if strings.Contains(result.Text, "SPEAKER_TURN") || result.Text != "How was the trip? Long. The train was late. Again? Yes." {
+		t.Errorf("text = %q", result.Text)
+	}
+}
+
+func TestParseSpeakerNames(t *testing.T) {
+	names, err := ParseSpeakerNames("SPEAKER_1=Alice, SPEAKER_2 = Bob\n")
+	if err != nil || names["SPEAKER_1"] != "Alice" || names["SPEAKER_2"] != "Bob" {
+		t.Errorf("ParseSpeakerNames = %v, %v", names, err)
+	}
+	if _, err := ParseSpeakerNames("SPEAKER_1"); err == nil {
+		t.Error("a name without = accepted")
+	}
+}
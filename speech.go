@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"localtts/audio"
+	"localtts/vad"
+)
+
+// vadGap is the silence inserted between speech regions so whisper hears a
+// pause where audio was skipped
+const vadGap = 500 * time.Millisecond
+
+// VADReport summarizes what voice activity detection passed to whisper
+type VADReport struct {
+	Regions       []vad.Region `json:"regions"`
+	SpeechSeconds float64      `json:"speechSeconds"`
+	TotalSeconds  float64      `json:"totalSeconds"`
+}
+
+func newVADReport(regions []vad.Region, totalSeconds float64) *VADReport {
+	report := &VADReport{
+		Regions:      append([]vad.Region{}, regions...),
+		TotalSeconds: totalSeconds,
+	}
+	for _, region := range regions {
+		report.SpeechSeconds += region.Duration()
+	}
+	report.SpeechSeconds = math.Round(report.SpeechSeconds*1000) / 1000
+	return report
+}
+
+// decodedAudioPath is where prepareAudio keeps the decoded audio for the
+// whisper input dst on the original timeline. Without VAD that is dst
+// itself; with VAD, dst only holds the speech.
+func decodedAudioPath(dst string, opts TranscribeOptions) string {
+	if !opts.VAD {
+		return dst
+	}
+	return strings.TrimSuffix(dst, ".wav") + "-decoded.wav"
+}
+
+// prepareAudio decodes inputFile into the 16 kHz mono WAV at dst that whisper
+// reads, from one channel or, with audio.AllChannels, their mix. With VAD
+// enabled only the detected speech is written, and the returned timeline
+// maps whisper's timestamps back onto the original audio. When no speech is
+// found dst is not written and the timeline is nil. The input is decoded
+// once, into decodedAudioPath(dst), and streamed rather than held in memory.
+func prepareAudio(ctx context.Context, inputFile, dst string, channel int, opts TranscribeOptions) (*vad.Timeline, *VADReport, error) {
+	if !opts.VAD {
+		_, err := audio.ConvertChannel(ctx, inputFile, dst, channel)
+		return nil, nil, err
+	}
+
+	// Measure the speech while decoding
+	decoded := decodedAudioPath(dst, opts)
+	config := opts.vadConfig()
+	meter := vad.NewMeter(audio.WhisperSampleRate, config.FrameSize)
+	writer, err := audio.CreateWAV(decoded, audio.WhisperSampleRate, 1)
+	if err != nil {
+		return nil, nil, err
+	}
+	_, err = audio.Stream(ctx, inputFile, channel, func(samples []float32) error {
+		meter.Write(samples)
+		return writer.Write(samples)
+	})
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(decoded)
+		return nil, nil, err
+	}
+	regions := meter.Detect(config)
+	report := newVADReport(regions, meter.Duration())
+	if len(regions) == 0 {
+		return nil, report, nil
+	}
+
+	// Copy only the speech to whisper's input
+	timeline, err := condenseWAV(ctx, decoded, dst, regions)
+	if err != nil {
+		os.Remove(dst)
+		return nil, nil, err
+	}
+	return timeline, report, nil
+}
+
+// condenseWAV writes the speech regions of the 16 kHz mono WAV src to dst,
+// separated by vadGap of silence, reading src a block at a time
+func condenseWAV(ctx context.Context, src, dst string, regions []vad.Region) (*vad.Timeline, error) {
+	decoder, err := audio.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer decoder.Close()
+
+	writer, err := audio.CreateWAV(dst, audio.WhisperSampleRate, 1)
+	if err != nil {
+		return nil, err
+	}
+	condenser := vad.NewCondenser(audio.WhisperSampleRate, regions, vadGap, writer.Write)
+	samples := make([]float32, 8192)
+	for {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		n, readErr := decoder.Read(samples)
+		if err = condenser.Write(samples[:n]); err != nil {
+			break
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			err = fmt.Errorf("failed to read decoded audio: %v", readErr)
+			break
+		}
+	}
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return condenser.Timeline(), nil
+}
+
+// remapTimestamps moves segment, word and token times from the condensed
+// audio whisper heard back onto the original timeline
+func remapTimestamps(segments []Segment, timeline *vad.Timeline) {
+	for i := range segments {
+		segment := &segments[i]
+		segment.Start = timeline.Map(segment.Start)
+		segment.End = timeline.Map(segment.End)
+		for j := range segment.Words {
+			segment.Words[j].Start = timeline.Map(segment.Words[j].Start)
+			segment.Words[j].End = timeline.Map(segment.Words[j].End)
+		}
+		for j := range segment.Tokens {
+			segment.Tokens[j].Start = timeline.Map(segment.Tokens[j].Start)
+			segment.Tokens[j].End = timeline.Map(segment.Tokens[j].End)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"localtts/audio"
+)
+
+// writeSpeechWAV writes a 16 kHz WAV with a tone from start to end seconds
+// and silence elsewhere, standing in for speech
+func writeSpeechWAV(t *testing.T, seconds, start, end float64) string {
+	t.Helper()
+	samples := make([]float32, int(seconds*audio.WhisperSampleRate))
+	for i := int(start * audio.WhisperSampleRate); i < int(end*audio.WhisperSampleRate); i++ {
+		samples[i] = float32(0.3 * math.Sin(2*math.Pi*200*float64(i)/audio.WhisperSampleRate))
+	}
+	path := filepath.Join(t.TempDir(), "speech.wav")
+	if err := audio.WriteWAV(path, samples, audio.WhisperSampleRate); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPrepareAudioWithVAD(t *testing.T) {
+	input := writeSpeechWAV(t, 20, 8, 11)
+	opts, err := TranscribeOptions{VAD: true}.Normalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(t.TempDir(), "input.wav")
+
+	timeline, report, err := prepareAudio(context.Background(), input, dst, audio.AllChannels, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.TotalSeconds != 20 || len(report.Regions) != 1 || math.Abs(report.SpeechSeconds-3.4) > 0.05 {
+		t.Fatalf("report = %+v, want one region of about 3.4s", report)
+	}
+	if got := timeline.Map(1); math.Abs(got-8.8) > 0.05 {
+		t.Errorf("Map(1) = %v, want about 8.8", got)
+	}
+
+	// Whisper hears only the speech; the whole recording is kept decoded
+	// for later analysis
+	condensed, err := audio.Probe(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seconds := condensed.Duration.Seconds(); math.Abs(seconds-report.SpeechSeconds) > 0.05 {
+		t.Errorf("whisper input is %vs, want %vs", seconds, report.SpeechSeconds)
+	}
+	decoded, err := audio.Probe(decodedAudioPath(dst, opts))
+	if err != nil || decoded.Duration.Seconds() != 20 {
+		t.Errorf("decoded audio = %v, %v", decoded, err)
+	}
+}
+
+func TestPrepareAudioWithoutSpeech(t *testing.T) {
+	input := writeSpeechWAV(t, 5, 0, 0)
+	opts, err := TranscribeOptions{VAD: true}.Normalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(t.TempDir(), "input.wav")
+	timeline, report, err := prepareAudio(context.Background(), input, dst, audio.AllChannels, opts)
+	if err != nil || timeline != nil || report == nil || len(report.Regions) != 0 {
+		t.Fatalf("prepareAudio = %v, %+v, %v", timeline, report, err)
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Error("whisper input written without speech")
+	}
+}
@@ -0,0 +1,132 @@
+package vad
+
+import (
+	"sort"
+	"time"
+)
+
+// span maps a stretch of condensed audio back to the original recording
+type span struct {
+	condensedStart float64
+	originalStart  float64
+	length         float64
+}
+
+// Timeline maps times in condensed audio, which holds only the speech
+// regions, back onto the original audio
+type Timeline struct {
+	spans []span
+}
+
+// Condense writes the speech regions of samples to sink, separated by gap
+// of silence so words from different regions do not run together. The
+// returned timeline maps times in the written audio back to the original.
+func Condense(samples []float32, sampleRate int, regions []Region, gap time.Duration, sink func([]float32) error) (*Timeline, error) {
+	condenser := NewCondenser(sampleRate, regions, gap, sink)
+	if err := condenser.Write(samples); err != nil {
+		return nil, err
+	}
+	return condenser.Timeline(), nil
+}
+
+// Condenser does what Condense does for audio that arrives block by block,
+// so long recordings never have to be held in memory
+type Condenser struct {
+	sampleRate int
+	regions    []Region
+	sink       func([]float32) error
+	silence    []float32
+	timeline   *Timeline
+
+	region   int   // Index of the next region to write
+	started  bool  // Whether the region's first samples were written
+	position int64 // Samples of the original audio seen so far
+	written  int64 // Samples written to sink
+	length   int64 // Samples written of the current region
+}
+
+// NewCondenser returns a condenser writing the speech regions to sink
+func NewCondenser(sampleRate int, regions []Region, gap time.Duration, sink func([]float32) error) *Condenser {
+	return &Condenser{
+		sampleRate: sampleRate,
+		regions:    regions,
+		sink:       sink,
+		silence:    make([]float32, int(gap.Seconds()*float64(sampleRate))),
+		timeline:   &Timeline{},
+	}
+}
+
+// Write takes the next block of the original audio and passes on the part
+// of it inside speech regions
+func (c *Condenser) Write(samples []float32) error {
+	blockStart := c.position
+	blockEnd := blockStart + int64(len(samples))
+	c.position = blockEnd
+
+	for c.region < len(c.regions) {
+		region := c.regions[c.region]
+		start := int64(region.Start * float64(c.sampleRate))
+		end := int64(region.End * float64(c.sampleRate))
+		if start >= blockEnd {
+			return nil
+		}
+
+		from, to := max(start, blockStart), min(end, blockEnd)
+		if from < to {
+			if !c.started {
+				if c.written > 0 {
+					if err := c.sink(c.silence); err != nil {
+						return err
+					}
+					c.written += int64(len(c.silence))
+				}
+				c.timeline.spans = append(c.timeline.spans, span{
+					condensedStart: float64(c.written) / float64(c.sampleRate),
+					originalStart:  float64(from) / float64(c.sampleRate),
+				})
+				c.started, c.length = true, 0
+			}
+			if err := c.sink(samples[from-blockStart : to-blockStart]); err != nil {
+				return err
+			}
+			c.written += to - from
+			c.length += to - from
+			c.timeline.spans[len(c.timeline.spans)-1].length = float64(c.length) / float64(c.sampleRate)
+		}
+		if end > blockEnd {
+			return nil
+		}
+		c.region++
+		c.started = false
+	}
+	return nil
+}
+
+// Timeline returns the mapping of the audio written so far back to the
+// original
+func (c *Condenser) Timeline() *Timeline {
+	return c.timeline
+}
+
+// Map converts a time in seconds in the condensed audio to the original
+// audio. Times inside an inserted gap map to the end of the preceding region.
+func (t *Timeline) Map(seconds float64) float64 {
+	if len(t.spans) == 0 {
+		return seconds
+	}
+
+	// Find the last span starting at or before the time
+	i := sort.Search(len(t.spans), func(i int) bool {
+		return t.spans[i].condensedStart > seconds
+	}) - 1
+	if i < 0 {
+		return t.spans[0].originalStart
+	}
+
+	s := t.spans[i]
+	offset := seconds - s.condensedStart
+	if offset > s.length {
+		offset = s.length
+	}
+	return s.originalStart + offset
+}
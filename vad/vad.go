@@ -0,0 +1,267 @@
+// Package vad finds speech in decoded PCM using frame energy, so silence
+// can be skipped before transcription.
+package vad
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Config tunes speech detection
+type Config struct {
+	// Threshold is how far above the estimated noise floor, in dB, a frame
+	// must be to count as speech
+	Threshold float64
+
+	// MinEnergy is the absolute level in dBFS below which a frame is never
+	// speech, so digital silence and faint hiss are skipped
+	MinEnergy float64
+
+	// MinSpeech drops detected regions shorter than this, e.g. clicks
+	MinSpeech time.Duration
+
+	// MinSilence merges regions separated by shorter pauses
+	MinSilence time.Duration
+
+	// Padding is kept before and after each region so word onsets and
+	// endings are not clipped
+	Padding time.Duration
+
+	// FrameSize is the analysis window length
+	FrameSize time.Duration
+}
+
+// DefaultConfig returns settings that work for typical meeting recordings
+func DefaultConfig() Config {
+	return Config{
+		Threshold:  10,
+		MinEnergy:  -55,
+		MinSpeech:  250 * time.Millisecond,
+		MinSilence: 700 * time.Millisecond,
+		Padding:    200 * time.Millisecond,
+		FrameSize:  30 * time.Millisecond,
+	}
+}
+
+// Region is a span of speech in seconds from the start of the audio
+type Region struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// Duration returns the length of the region in seconds
+func (r Region) Duration() float64 {
+	return r.End - r.Start
+}
+
+// Noise floor and speech level percentiles of the frame energies
+const (
+	noisePercentile  = 0.10
+	speechPercentile = 0.90
+	// speechHeadroom keeps the threshold below the typical speech level
+	// when a recording has almost no pauses to estimate the noise from
+	speechHeadroom = 6.0
+)
+
+// Detect returns the speech regions in mono samples, in order and without
+// overlaps
+func Detect(samples []float32, sampleRate int, config Config) []Region {
+	meter := NewMeter(sampleRate, config.FrameSize)
+	meter.Write(samples)
+	return meter.Detect(config)
+}
+
+// Meter measures the energy of a stream of mono samples frame by frame, so
+// long recordings can be analyzed without holding them in memory
+type Meter struct {
+	sampleRate  int
+	frameLength int
+	energies    []float64
+	sum         float64 // Sum of squares in the current frame
+	count       int     // Samples in the current frame
+	samples     int64
+}
+
+// NewMeter returns a meter using frames of frameSize
+func NewMeter(sampleRate int, frameSize time.Duration) *Meter {
+	frameLength := int(frameSize.Seconds() * float64(sampleRate))
+	if frameLength < 1 {
+		frameLength = 1
+	}
+	return &Meter{sampleRate: sampleRate, frameLength: frameLength}
+}
+
+// Write adds samples to the measurement
+func (m *Meter) Write(samples []float32) {
+	for _, sample := range samples {
+		m.sum += float64(sample) * float64(sample)
+		m.count++
+		if m.count == m.frameLength {
+			m.energies = append(m.energies, level(m.sum, m.count))
+			m.sum, m.count = 0, 0
+		}
+	}
+	m.samples += int64(len(samples))
+}
+
+// level converts a sum of squares to an RMS level in dBFS
+func level(sum float64, count int) float64 {
+	// The small offset keeps digital silence finite
+	return 10 * math.Log10(sum/float64(count)+1e-10)
+}
+
+// Duration returns the length of the measured audio in seconds
+func (m *Meter) Duration() float64 {
+	return float64(m.samples) / float64(m.sampleRate)
+}
+
+// frameSeconds returns the length of one frame in seconds
+func (m *Meter) frameSeconds() float64 {
+	return float64(m.frameLength) / float64(m.sampleRate)
+}
+
+// frameEnergies returns the level of every frame, including a final
+// partial one
+func (m *Meter) frameEnergies() []float64 {
+	if m.count == 0 {
+		return m.energies
+	}
+	energies := append([]float64(nil), m.energies...)
+	return append(energies, level(m.sum, m.count))
+}
+
+// Detect returns the speech regions in the measured audio
+func (m *Meter) Detect(config Config) []Region {
+	energies := m.frameEnergies()
+	if len(energies) == 0 {
+		return nil
+	}
+	threshold := energyThreshold(energies, config)
+
+	// Collect runs of loud frames
+	frameSeconds := m.frameSeconds()
+	var regions []Region
+	inSpeech := false
+	for i, energy := range energies {
+		switch {
+		case energy >= threshold && !inSpeech:
+			regions = append(regions, Region{Start: float64(i) * frameSeconds})
+			inSpeech = true
+		case energy < threshold && inSpeech:
+			regions[len(regions)-1].End = float64(i) * frameSeconds
+			inSpeech = false
+		}
+	}
+	total := m.Duration()
+	if inSpeech {
+		regions[len(regions)-1].End = total
+	}
+
+	regions = mergeGaps(regions, config.MinSilence.Seconds())
+	regions = dropShort(regions, config.MinSpeech.Seconds())
+	return pad(regions, config.Padding.Seconds(), total)
+}
+
+// quietWindow is the span over which energy is averaged when looking for
+// a pause, so a single quiet frame inside a word is not mistaken for one
+const quietWindow = 500 * time.Millisecond
+
+// Quietest returns the time in seconds, between from and to, at the center
+// of the quietest stretch of audio. It is used to cut long recordings in
+// pauses rather than mid-word.
+func (m *Meter) Quietest(from, to float64) float64 {
+	energies := m.frameEnergies()
+	frameSeconds := m.frameSeconds()
+	window := int(quietWindow.Seconds() / frameSeconds)
+	if window < 1 {
+		window = 1
+	}
+
+	first := int(math.Max(0, from) / frameSeconds)
+	last := int(to/frameSeconds) - window
+	if last > len(energies)-window {
+		last = len(energies) - window
+	}
+	if first > last {
+		return math.Max(0, math.Min((from+to)/2, m.Duration()))
+	}
+
+	// Slide the window across the range, summing power rather than dB
+	power := func(i int) float64 {
+		return math.Pow(10, energies[i]/10)
+	}
+	var sum float64
+	for i := first; i < first+window; i++ {
+		sum += power(i)
+	}
+	best, bestSum := first, sum
+	for i := first + 1; i <= last; i++ {
+		sum += power(i+window-1) - power(i-1)
+		if sum < bestSum {
+			best, bestSum = i, sum
+		}
+	}
+	return roundMillis((float64(best) + float64(window)/2) * frameSeconds)
+}
+
+// energyThreshold places the speech threshold above the noise floor, but
+// never above the typical speech level or below the absolute minimum
+func energyThreshold(energies []float64, config Config) float64 {
+	sorted := append([]float64(nil), energies...)
+	sort.Float64s(sorted)
+	noiseFloor := sorted[int(noisePercentile*float64(len(sorted)-1))]
+	speechLevel := sorted[int(speechPercentile*float64(len(sorted)-1))]
+
+	// Without pauses the noise floor estimate is the signal itself, so the
+	// threshold falls back to it and the audio is kept rather than dropped
+	threshold := noiseFloor + config.Threshold
+	if ceiling := math.Max(speechLevel-speechHeadroom, noiseFloor); threshold > ceiling {
+		threshold = ceiling
+	}
+	return math.Max(threshold, config.MinEnergy)
+}
+
+// mergeGaps joins regions separated by less than minGap seconds
+func mergeGaps(regions []Region, minGap float64) []Region {
+	var merged []Region
+	for _, region := range regions {
+		if n := len(merged); n > 0 && region.Start-merged[n-1].End < minGap {
+			merged[n-1].End = region.End
+			continue
+		}
+		merged = append(merged, region)
+	}
+	return merged
+}
+
+// dropShort removes regions shorter than minLength seconds
+func dropShort(regions []Region, minLength float64) []Region {
+	var kept []Region
+	for _, region := range regions {
+		if region.Duration() >= minLength {
+			kept = append(kept, region)
+		}
+	}
+	return kept
+}
+
+// pad widens regions by padding seconds, clamped to the audio, and merges
+// regions that come to overlap
+func pad(regions []Region, padding, total float64) []Region {
+	var padded []Region
+	for _, region := range regions {
+		region.Start = roundMillis(math.Max(0, region.Start-padding))
+		region.End = roundMillis(math.Min(total, region.End+padding))
+		if n := len(padded); n > 0 && region.Start <= padded[n-1].End {
+			padded[n-1].End = region.End
+			continue
+		}
+		padded = append(padded, region)
+	}
+	return padded
+}
+
+func roundMillis(seconds float64) float64 {
+	return math.Round(seconds*1000) / 1000
+}
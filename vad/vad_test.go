@@ -0,0 +1,133 @@
+package vad
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+const testRate = 16000
+
+// tone returns seconds of a 200 Hz sine at amplitude, or silence for 0
+func tone(seconds, amplitude float64) []float32 {
+	samples := make([]float32, int(seconds*testRate))
+	for i := range samples {
+		samples[i] = float32(amplitude * math.Sin(2*math.Pi*200*float64(i)/testRate))
+	}
+	return samples
+}
+
+// concat joins blocks of samples
+func concat(blocks ...[]float32) []float32 {
+	var samples []float32
+	for _, block := range blocks {
+		samples = append(samples, block...)
+	}
+	return samples
+}
+
+func TestDetect(t *testing.T) {
+	samples := concat(tone(2, 0), tone(1, 0.3), tone(0.3, 0), tone(1, 0.3), tone(3, 0), tone(0.1, 0.3), tone(2, 0))
+	regions := Detect(samples, testRate, DefaultConfig())
+
+	// The short pause is bridged, the click is dropped and the speech is
+	// padded by 200 ms
+	if len(regions) != 1 {
+		t.Fatalf("regions = %+v, want one", regions)
+	}
+	if math.Abs(regions[0].Start-1.8) > 0.05 || math.Abs(regions[0].End-4.5) > 0.05 {
+		t.Errorf("region = %+v, want about 1.8s-4.5s", regions[0])
+	}
+}
+
+func TestDetectSilenceAndConstantSpeech(t *testing.T) {
+	if regions := Detect(tone(5, 0), testRate, DefaultConfig()); len(regions) != 0 {
+		t.Errorf("silence has speech: %+v", regions)
+	}
+	// Without pauses there is no noise floor to measure, so everything is
+	// kept rather than dropped
+	regions := Detect(tone(5, 0.3), testRate, DefaultConfig())
+	if len(regions) != 1 || regions[0].Start != 0 || regions[0].End != 5 {
+		t.Errorf("regions = %+v, want all of the audio", regions)
+	}
+}
+
+func TestMeterQuietest(t *testing.T) {
+	meter := NewMeter(testRate, DefaultConfig().FrameSize)
+	meter.Write(concat(tone(4, 0.3), tone(1, 0.001), tone(4, 0.3)))
+	if got := meter.Quietest(2, 8); got < 4 || got > 5 {
+		t.Errorf("Quietest = %v, want a time in the pause from 4s to 5s", got)
+	}
+	if meter.Duration() != 9 {
+		t.Errorf("Duration = %v", meter.Duration())
+	}
+}
+
+func TestCondense(t *testing.T) {
+	samples := make([]float32, 10*testRate)
+	for i := range samples {
+		samples[i] = float32(i)
+	}
+	regions := []Region{{Start: 1, End: 2}, {Start: 5, End: 6.5}, {Start: 9.5, End: 12}}
+	gap := 500 * time.Millisecond
+
+	var written []float32
+	timeline, err := Condense(samples, testRate, regions, gap, func(block []float32) error {
+		written = append(written, block...)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 1s + gap + 1.5s + gap + the 0.5s left of the last region
+	if want := int((1 + 0.5 + 1.5 + 0.5 + 0.5) * testRate); len(written) != want {
+		t.Fatalf("wrote %d samples, want %d", len(written), want)
+	}
+	if written[0] != float32(testRate) || written[int(1.5*testRate)] != float32(5*testRate) {
+		t.Errorf("regions written from the wrong place")
+	}
+
+	for condensed, original := range map[float64]float64{0: 1, 0.5: 1.5, 1.2: 2, 1.5: 5, 2.5: 6, 3.5: 9.5, 3.9: 9.9} {
+		if got := timeline.Map(condensed); math.Abs(got-original) > 1e-9 {
+			t.Errorf("Map(%v) = %v, want %v", condensed, got, original)
+		}
+	}
+}
+
+// Audio arriving in blocks of any size is condensed as if it came at once
+func TestCondenserBlocks(t *testing.T) {
+	samples := tone(6, 0.3)
+	regions := []Region{{Start: 0.25, End: 1}, {Start: 1.0625, End: 3.3}, {Start: 5.9, End: 7}}
+
+	var whole []float32
+	wholeTimeline, _ := Condense(samples, testRate, regions, 100*time.Millisecond, func(block []float32) error {
+		whole = append(whole, block...)
+		return nil
+	})
+
+	for _, size := range []int{1, 1000, 4093, len(samples)} {
+		var streamed []float32
+		condenser := NewCondenser(testRate, regions, 100*time.Millisecond, func(block []float32) error {
+			streamed = append(streamed, block...)
+			return nil
+		})
+		for start := 0; start < len(samples); start += size {
+			if err := condenser.Write(samples[start:min(start+size, len(samples))]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if len(streamed) != len(whole) {
+			t.Fatalf("blocks of %d: wrote %d samples, want %d", size, len(streamed), len(whole))
+		}
+		for i := range whole {
+			if streamed[i] != whole[i] {
+				t.Fatalf("blocks of %d: sample %d differs", size, i)
+			}
+		}
+		for _, seconds := range []float64{0, 0.7, 0.8, 2, 3.2, 3.35} {
+			if got, want := condenser.Timeline().Map(seconds), wholeTimeline.Map(seconds); math.Abs(got-want) > 1e-9 {
+				t.Errorf("blocks of %d: Map(%v) = %v, want %v", size, seconds, got, want)
+			}
+		}
+	}
+}
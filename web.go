@@ -1,19 +1,31 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"localtts/audio"
 )
 
 type WebServer struct {
 	port            string
 	resourceManager *ResourceManager
-	transcriber     *WhisperTranscriber
+	transcriber     Engine
+	jobs            *JobStore
+	// config holds the project settings, e.g. the processors run when a
+	// request names none
+	config *ProjectConfig
 }
 
 type TranscriptionRequest struct {
@@ -21,17 +33,108 @@ type TranscriptionRequest struct {
 }
 
 type TranscriptionResponse struct {
-	Success bool   `json:"success"`
-	Results string `json:"results"`
-	Error   string `json:"error,omitempty"`
+	Success             bool    `json:"success"`
+	Results             string  `json:"results"`
+	Language            string  `json:"language,omitempty"`
+	LanguageProbability float64 `json:"languageProbability,omitempty"`
+	Task                string  `json:"task,omitempty"`
+	// Options echoes the normalized options so a run can be reproduced
+	Options *TranscribeOptions `json:"options,omitempty"`
+	Audio   *AudioDetails      `json:"audio,omitempty"`
+	// VAD lists the speech regions transcribed when VAD was enabled
+	VAD *VADReport `json:"vad,omitempty"`
+	// Speakers lists the speaker IDs in order of appearance when speakers
+	// were labeled
+	Speakers []string `json:"speakers,omitempty"`
+	// Cached is set when the transcript came from the transcript cache
+	Cached bool `json:"cached,omitempty"`
+	// Processing lists the processors that ran on the transcript
+	Processing []ProcessingStep `json:"processing,omitempty"`
+	// Redactions maps masked text back to the original when the request
+	// asked for the redaction map
+	Redactions []Redaction `json:"redactions,omitempty"`
+	Error      string           `json:"error,omitempty"`
+}
+
+// AudioDetails describes the uploaded audio file
+type AudioDetails struct {
+	Container       string  `json:"container"`
+	Codec           string  `json:"codec"`
+	SampleRate      int     `json:"sampleRate"`
+	Channels        int     `json:"channels"`
+	BitDepth        int     `json:"bitDepth,omitempty"`
+	DurationSeconds float64 `json:"durationSeconds"`
+}
+
+func newAudioDetails(info audio.Info) *AudioDetails {
+	return &AudioDetails{
+		Container:       info.Container,
+		Codec:           info.Codec,
+		SampleRate:      info.SampleRate,
+		Channels:        info.Channels,
+		BitDepth:        info.BitDepth,
+		DurationSeconds: info.Duration.Seconds(),
+	}
+}
+
+// ProgressEvent is streamed to clients that ask for progress updates
+type ProgressEvent struct {
+	Percent        float64 `json:"percent"`
+	ElapsedSeconds float64 `json:"elapsedSeconds"`
+	ETASeconds     float64 `json:"etaSeconds,omitempty"`
+}
+
+type progressMessage struct {
+	Progress ProgressEvent `json:"progress"`
+}
+
+// audioMessage is streamed before the first progress event
+type audioMessage struct {
+	Audio *AudioDetails `json:"audio"`
+}
+
+// jobMessage is streamed first, so a client can collect the result from
+// /jobs/{id} if the server restarts before responding
+type jobMessage struct {
+	Job JobEvent `json:"job"`
+}
+
+type JobEvent struct {
+	ID string `json:"id"`
+}
+
+// JobStatusResponse is returned by /jobs/{id}
+type JobStatusResponse struct {
+	ID     string                 `json:"id"`
+	Status string                 `json:"status"`
+	Error  string                 `json:"error,omitempty"`
+	Result *TranscriptionResponse `json:"result,omitempty"`
+}
+
+// finishedJobRetention is how long results of jobs resumed after a restart
+// are kept for clients to collect
+const finishedJobRetention = 24 * time.Hour
+
+// ProcessorInfo describes a processor available to requests
+type ProcessorInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// ProcessorsResponse is returned by /post-processing
+type ProcessorsResponse struct {
+	Available []ProcessorInfo `json:"available"`
+	// Default is the project's pipeline, run when a request names none
+	Default []ProcessorConfig `json:"default"`
 }
 
-func NewWebServer(port string, resourceManager *ResourceManager) *WebServer {
-	transcriber := NewWhisperTranscriber(resourceManager)
+func NewWebServer(port string, resourceManager *ResourceManager, transcriber Engine, jobs *JobStore, config *ProjectConfig) *WebServer {
 	return &WebServer{
 		port:            port,
 		resourceManager: resourceManager,
 		transcriber:     transcriber,
+		jobs:            jobs,
+		config:          config,
 	}
 }
 
@@ -78,15 +181,54 @@ func (ws *WebServer) handleTranscribe(w http.ResponseWriter, r *http.Request) {
 	defer file.Close()
 
 	// Get options
-	modelSize := r.FormValue("modelSize")
+	opts, err := ws.parseTranscribeOptions(r)
+	if err != nil {
+		ws.sendJSONResponse(w, TranscriptionResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
 
-	if modelSize == "" {
-		modelSize = "base"
+	granularity := r.FormValue("timestamps")
+	if granularity == "" {
+		granularity = GranularitySentence
+	}
+	if !validGranularity(granularity) {
+		ws.sendJSONResponse(w, TranscriptionResponse{
+			Success: false,
+			Error:   "Invalid timestamps option (use paragraph, sentence or word)",
+		})
+		return
 	}
 
-	// Save uploaded file temporarily
-	tempDir := os.TempDir()
-	tempFile := filepath.Join(tempDir, header.Filename)
+	speakerNames, err := ParseSpeakerNames(r.FormValue("speakerNames"))
+	if err != nil {
+		ws.sendJSONResponse(w, TranscriptionResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	format := FormatOptions{Granularity: granularity, SpeakerNames: speakerNames}
+	format.IncludeRedactions = r.FormValue("redactionMap") == "true" && r.FormValue("redact") != ""
+
+	// Save the upload in the job's own directory so concurrent uploads with
+	// the same name never collide, and an interrupted job can be resumed when
+	// the server restarts. Only the extension of the client-supplied name is
+	// kept, so it cannot escape the directory.
+	job, err := ws.jobs.Create(JobSourceWeb, opts, format)
+	if err != nil {
+		log.Printf("Failed to create job: %v", err)
+		ws.sendJSONResponse(w, TranscriptionResponse{
+			Success: false,
+			Error:   "Failed to save uploaded file",
+		})
+		return
+	}
+	defer job.Remove() // Clean up once the client has the response
+	tempFile := filepath.Join(job.Dir(), "upload"+filepath.Ext(filepath.Base(header.Filename)))
 	
 	outFile, err := os.Create(tempFile)
 	if err != nil {
@@ -96,10 +238,7 @@ func (ws *WebServer) handleTranscribe(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	defer func() {
-		outFile.Close()
-		os.Remove(tempFile) // Clean up
-	}()
+	defer outFile.Close()
 
 	_, err = io.Copy(outFile, file)
 	if err != nil {
@@ -111,8 +250,40 @@ func (ws *WebServer) handleTranscribe(w http.ResponseWriter, r *http.Request) {
 	}
 	outFile.Close()
 
-	// Process the audio file
-	results, err := ws.processAudio(tempFile, modelSize)
+	// Reject empty or corrupt uploads before loading a model
+	info, err := audio.Probe(tempFile)
+	if err != nil {
+		ws.sendJSONResponse(w, TranscriptionResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Invalid audio file: %v", err),
+		})
+		return
+	}
+	log.Printf("Received %s: %s", header.Filename, info)
+	opts.AudioInfo = &info
+	if err := job.SetInput(tempFile, header.Filename); err != nil {
+		ws.sendJSONResponse(w, TranscriptionResponse{
+			Success: false,
+			Error:   "Failed to save uploaded file",
+		})
+		return
+	}
+	opts.CheckpointDir = job.CheckpointDir()
+
+	// Clients sending progress=true receive newline-delimited JSON: the job
+	// ID, progress events while whisper runs, then the final response
+	if r.FormValue("progress") == "true" {
+		opts.Progress = ws.progressStreamer(w)
+		ws.streamJSON(w, jobMessage{Job: JobEvent{ID: job.ID}})
+		ws.streamJSON(w, audioMessage{Audio: newAudioDetails(info)})
+	}
+
+	// Process the audio file; whisper is stopped if the client disconnects
+	result, results, err := ws.processAudio(r.Context(), tempFile, opts, format)
+	if errors.Is(err, ErrTranscriptionCanceled) {
+		log.Printf("Transcription of %s canceled: client disconnected", header.Filename)
+		return
+	}
 	if err != nil {
 		ws.sendJSONResponse(w, TranscriptionResponse{
 			Success: false,
@@ -121,30 +292,301 @@ func (ws *WebServer) handleTranscribe(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ws.sendJSONResponse(w, TranscriptionResponse{
-		Success: true,
-		Results: results,
-	})
+	ws.sendJSONResponse(w, newTranscriptionResponse(result, results, format))
 }
 
-func (ws *WebServer) processAudio(inputFile, modelSize string) (string, error) {
-	log.Printf("Processing audio file: %s with model: %s", inputFile, modelSize)
+// newTranscriptionResponse describes a successful transcription
+func newTranscriptionResponse(result *TranscriptionResult, results string, format FormatOptions) TranscriptionResponse {
+	response := TranscriptionResponse{
+		Success:             true,
+		Results:             results,
+		Language:            result.Language,
+		LanguageProbability: result.LanguageProbability,
+		Task:                result.Task,
+		Options:             &result.Options,
+		Audio:               newAudioDetails(result.Audio),
+		VAD:                 result.VAD,
+		Speakers:            resultSpeakers(result),
+		Cached:              result.Cached,
+		Processing:          result.Processing,
+	}
+	if format.IncludeRedactions {
+		response.Redactions = result.Redactions
+	}
+	return response
+}
+
+// handleProcessors lists the processors a request may name in its
+// postProcessing field, and the pipeline run when it names none
+func (ws *WebServer) handleProcessors(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response := ProcessorsResponse{Default: ws.config.PostProcessing}
+	for _, name := range ProcessorNames() {
+		response.Available = append(response.Available, ProcessorInfo{Name: name, Description: ProcessorDescription(name)})
+	}
+	if response.Default == nil {
+		response.Default = []ProcessorConfig{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleJob reports the status of a job and, once it has completed, its
+// result. Clients use it to collect jobs resumed after a server restart.
+func (ws *WebServer) handleJob(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	job, err := ws.jobs.Load(strings.TrimPrefix(r.URL.Path, "/jobs/"))
+	if err != nil || job.Source != JobSourceWeb {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	status := JobStatusResponse{ID: job.ID, Status: job.Status, Error: job.Error}
+	if job.Status == JobCompleted {
+		status.Result = &TranscriptionResponse{}
+		if err := job.LoadResult(status.Result); err != nil {
+			http.Error(w, "Job result not available", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// resumeJobs finishes web jobs that were interrupted by a restart, one at a
+// time, and removes finished jobs whose results were never collected
+func (ws *WebServer) resumeJobs() {
+	jobs, err := ws.jobs.List()
+	if err != nil {
+		log.Printf("Failed to resume jobs: %v", err)
+		return
+	}
+	
+	var pending []*Job
+	for _, job := range jobs {
+		switch {
+		case job.Source != JobSourceWeb:
+			continue
+		case job.Status == JobRunning:
+			pending = append(pending, job)
+		case time.Since(job.Updated) > finishedJobRetention:
+			job.Remove()
+		}
+	}
+	if len(pending) == 0 {
+		return
+	}
+	
+	log.Printf("Resuming %d interrupted job(s)", len(pending))
+	for _, job := range pending {
+		if err := ws.resumeJob(job); err != nil {
+			log.Printf("Job %s failed: %v", job.ID, err)
+			job.Fail(err)
+			continue
+		}
+		log.Printf("Job %s completed", job.ID)
+	}
+}
+
+// resumeJob transcribes an interrupted job, reusing its finished chunks, and
+// keeps the response for the client to collect
+func (ws *WebServer) resumeJob(job *Job) error {
+	if err := job.CheckInput(); err != nil {
+		return err
+	}
+	opts := job.Options
+	opts.CheckpointDir = job.CheckpointDir()
+	
+	result, results, err := ws.processAudio(context.Background(), job.InputFile, opts, job.Format)
+	if err != nil {
+		return err
+	}
+	
+	// The upload is no longer needed once the result is saved
+	response := newTranscriptionResponse(result, results, job.Format)
+	if err := job.Complete(response); err != nil {
+		return err
+	}
+	os.Remove(job.InputFile)
+	return nil
+}
+
+// parseTranscribeOptions reads the transcription options from the form.
+// Fields that are missing or empty keep whisper's defaults.
+func (ws *WebServer) parseTranscribeOptions(r *http.Request) (TranscribeOptions, error) {
+	opts := TranscribeOptions{
+		ModelSize: r.FormValue("modelSize"),
+		Language:  r.FormValue("language"),
+		Task:      r.FormValue("task"),
+		Prompt:    r.FormValue("prompt"),
+	}
+
+	// Glossary terms may be sent as text (one per line) and/or as a file
+	glossary, err := ParseGlossary(strings.NewReader(r.FormValue("glossary")))
+	if err == nil {
+		if glossaryFile, _, fileErr := r.FormFile("glossaryFile"); fileErr == nil {
+			var fileTerms []string
+			fileTerms, err = ParseGlossary(glossaryFile)
+			glossaryFile.Close()
+			glossary = append(glossary, fileTerms...)
+		}
+	}
+	if err != nil {
+		return opts, fmt.Errorf("Invalid glossary: %v", err)
+	}
+	opts.Glossary = glossary
+	if len(opts.Glossary) == 0 {
+		opts.Glossary = ws.config.Glossary
+	}
+
+	// The project's processors run unless the request names others, or
+	// "none" to run none
+	opts.PostProcessing = ws.config.PostProcessing
+	if spec := r.FormValue("postProcessing"); strings.TrimSpace(spec) != "" {
+		if opts.PostProcessing, err = ParseRequestProcessors(spec); err != nil {
+			return opts, fmt.Errorf("Invalid post-processing: %v", err)
+		}
+	}
+	if r.FormValue("clean") == "true" {
+		opts.PostProcessing = withProcessor(opts.PostProcessing, cleanProcessor)
+	}
+	if r.FormValue("correctGlossary") == "true" {
+		if len(opts.Glossary) == 0 {
+			return opts, fmt.Errorf("Glossary correction requires a glossary")
+		}
+		opts.PostProcessing = withProcessor(opts.PostProcessing, glossaryProcessor)
+	}
+	if r.FormValue("filterHallucinations") == "true" {
+		opts.PostProcessing = withProcessor(opts.PostProcessing, hallucinationsProcessor)
+	}
+	if detect := strings.TrimSpace(r.FormValue("redact")); detect != "" {
+		redaction, err := RedactionConfig(detect, r.FormValue("redactMask"))
+		if err != nil {
+			return opts, fmt.Errorf("Invalid redaction: %v", err)
+		}
+		opts.PostProcessing = withRedaction(opts.PostProcessing, redaction)
+	}
+
+	intFields := map[string]*int{
+		"threads":          &opts.Threads,
+		"processors":       &opts.Processors,
+		"beamSize":         &opts.BeamSize,
+		"bestOf":           &opts.BestOf,
+		"maxSegmentLength": &opts.MaxSegmentLength,
+		"workers":          &opts.Workers,
+		"chunkSeconds":     &opts.ChunkSeconds,
+		"vadMinSpeechMs":   &opts.VADMinSpeechMs,
+		"vadMinSilenceMs":  &opts.VADMinSilenceMs,
+		"vadPaddingMs":     &opts.VADPaddingMs,
+		"speakers":         &opts.Speakers,
+	}
+	for field, target := range intFields {
+		if value := strings.TrimSpace(r.FormValue(field)); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return opts, fmt.Errorf("Invalid %s: expected an integer", field)
+			}
+			*target = n
+		}
+	}
+
+	floatFields := map[string]*float64{
+		"temperature":      &opts.Temperature,
+		"entropyThreshold": &opts.EntropyThreshold,
+		"logprobThreshold": &opts.LogprobThreshold,
+		"vadThreshold":     &opts.VADThreshold,
+	}
+	for field, target := range floatFields {
+		if value := strings.TrimSpace(r.FormValue(field)); value != "" {
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return opts, fmt.Errorf("Invalid %s: expected a number", field)
+			}
+			*target = f
+		}
+	}
+	thresholds := []struct {
+		field        string
+		value        float64
+		defaultValue float64
+	}{
+		{"entropyThreshold", opts.EntropyThreshold, defaultEntropyThreshold},
+		{"logprobThreshold", opts.LogprobThreshold, defaultLogprobThreshold},
+	}
+	for _, threshold := range thresholds {
+		if strings.TrimSpace(r.FormValue(threshold.field)) == "" {
+			continue
+		}
+		if err := checkThreshold("value", threshold.value, threshold.defaultValue); err != nil {
+			return opts, fmt.Errorf("Invalid %s: %v", threshold.field, err)
+		}
+	}
+
+	opts.SplitOnWord = r.FormValue("splitOnWord") == "true"
+	opts.VAD = r.FormValue("vad") == "true"
+	opts.Diarize = r.FormValue("diarize") == "true"
+	opts.SplitChannels = r.FormValue("splitChannels") == "true"
+	opts.NoCache = r.FormValue("noCache") == "true"
+
+	return opts.Normalize()
+}
+
+func (ws *WebServer) processAudio(ctx context.Context, inputFile string, opts TranscribeOptions, format FormatOptions) (*TranscriptionResult, string, error) {
+	log.Printf("Processing audio file: %s with model: %s", inputFile, opts.ModelSize)
 	
 	// Load the model
-	if err := ws.transcriber.LoadModel(modelSize); err != nil {
-		return "", fmt.Errorf("failed to load model: %v", err)
+	if err := ws.transcriber.LoadModel(opts.ModelSize); err != nil {
+		return nil, "", fmt.Errorf("failed to load model: %v", err)
 	}
 	
 	// Transcribe the audio
-	result, err := ws.transcriber.TranscribeFile(inputFile, modelSize)
+	result, err := ws.transcriber.TranscribeContext(ctx, inputFile, opts)
 	if err != nil {
-		return "", fmt.Errorf("transcription failed: %v", err)
+		return nil, "", fmt.Errorf("transcription failed: %w", err)
 	}
 	
 	// Format the results
-	formattedOutput := ws.transcriber.FormatResults(result)
+	formattedOutput := FormatResults(result, format)
 	
-	return formattedOutput, nil
+	return result, formattedOutput, nil
+}
+
+// progressStreamer returns a progress callback that writes each update as a
+// JSON line and flushes it to the client immediately
+func (ws *WebServer) progressStreamer(w http.ResponseWriter) ProgressFunc {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	
+	var mu sync.Mutex
+	return func(p Progress) {
+		mu.Lock()
+		defer mu.Unlock()
+		
+		ws.streamJSON(w, progressMessage{
+			Progress: ProgressEvent{
+				Percent:        p.Percent,
+				ElapsedSeconds: p.Elapsed.Seconds(),
+				ETASeconds:     p.ETA.Seconds(),
+			},
+		})
+	}
+}
+
+// streamJSON writes one JSON line and flushes it to the client
+func (ws *WebServer) streamJSON(w http.ResponseWriter, message interface{}) {
+	json.NewEncoder(w).Encode(message)
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
 }
 
 func (ws *WebServer) sendJSONResponse(w http.ResponseWriter, response TranscriptionResponse) {
@@ -156,6 +598,10 @@ func (ws *WebServer) sendJSONResponse(w http.ResponseWriter, response Transcript
 func (ws *WebServer) Start() {
 	http.HandleFunc("/", ws.handleIndex)
 	http.HandleFunc("/transcribe", ws.handleTranscribe)
+	http.HandleFunc("/jobs/", ws.handleJob)
+	http.HandleFunc("/post-processing", ws.handleProcessors)
+	
+	go ws.resumeJobs()
 	
 	fmt.Printf("OfflineTranscribe Web Interface starting on http://localhost:%s\n", ws.port)
 	fmt.Println("Open your web browser and navigate to the URL above")
@@ -177,10 +623,32 @@ func main() {
 	defer resourceManager.Cleanup()
 	
 	// Verify resources
-	if err := resourceManager.VerifyResources(); err != nil {
-		log.Fatalf("Resource verification failed: %v", err)
+	config := LoadEngineConfig()
+	if config.NeedsResources() {
+		if err := resourceManager.VerifyResources(); err != nil {
+			log.Fatalf("Resource verification failed: %v", err)
+		}
+	}
+	
+	transcriber, err := NewEngine(config, resourceManager)
+	if err != nil {
+		log.Fatalf("Failed to create transcription engine: %v", err)
+	}
+	defer transcriber.Close()
+	
+	jobs, err := OpenDefaultJobStore()
+	if err != nil {
+		log.Fatalf("Failed to open job store: %v", err)
+	}
+	
+	projectConfig, err := LoadProjectConfig(".")
+	if err != nil {
+		log.Fatalf("Failed to load project config: %v", err)
+	}
+	if projectConfig.Path() != "" {
+		log.Printf("Using project config %s", projectConfig.Path())
 	}
 	
-	server := NewWebServer(port, resourceManager)
+	server := NewWebServer(port, resourceManager, transcriber, jobs, projectConfig)
 	server.Start()
 }
\ No newline at end of file
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// newFakeServer returns the web server on the fake engine, with jobs kept
+// in a temporary directory
+func newFakeServer(t *testing.T, config *ProjectConfig) (*WebServer, *FakeEngine, string) {
+	t.Helper()
+	dir := t.TempDir()
+	jobs, err := OpenJobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := NewFakeEngine()
+	return NewWebServer("", nil, engine, jobs, config), engine, dir
+}
+
+// transcribeRequest builds a /transcribe upload of the file at path with
+// the given form fields
+func transcribeRequest(t *testing.T, path string, fields map[string]string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		form.WriteField(name, value)
+	}
+	part, err := form.CreateFormFile("audioFile", "meeting.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	form.Close()
+
+	request := httptest.NewRequest("POST", "/transcribe", &body)
+	request.Header.Set("Content-Type", form.FormDataContentType())
+	return request
+}
+
+func TestWebTranscribe(t *testing.T) {
+	server, engine, jobsDir := newFakeServer(t, &ProjectConfig{})
+	request := transcribeRequest(t, writeSpeechWAV(t, 2, 0, 2), map[string]string{
+		"modelSize":      "small",
+		"timestamps":     "word",
+		"postProcessing": "replace:find=Fake;with=Mock",
+	})
+	recorder := httptest.NewRecorder()
+	server.handleTranscribe(recorder, request)
+
+	var response TranscriptionResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if !response.Success {
+		t.Fatalf("response = %+v", response)
+	}
+	if !strings.Contains(response.Results, "Mock") || !strings.Contains(response.Results, "small") {
+		t.Errorf("results = %q", response.Results)
+	}
+	if response.Options == nil || response.Options.ModelSize != "small" || response.Audio == nil || response.Audio.DurationSeconds != 2 {
+		t.Errorf("options = %+v, audio = %+v", response.Options, response.Audio)
+	}
+	if len(response.Processing) != 1 || response.Processing[0].Changes != 1 {
+		t.Errorf("processing = %+v", response.Processing)
+	}
+	if len(engine.Calls) != 1 {
+		t.Errorf("engine calls = %v", engine.Calls)
+	}
+
+	// The upload is removed with its job once the response is sent
+	if entries, _ := os.ReadDir(jobsDir); len(entries) != 0 {
+		t.Errorf("%d job(s) left behind", len(entries))
+	}
+}
+
+func TestWebTranscribeStreamsProgress(t *testing.T) {
+	server, _, _ := newFakeServer(t, &ProjectConfig{})
+	request := transcribeRequest(t, writeSpeechWAV(t, 2, 0, 2), map[string]string{"progress": "true"})
+	recorder := httptest.NewRecorder()
+	server.handleTranscribe(recorder, request)
+
+	var lines []map[string]json.RawMessage
+	scanner := bufio.NewScanner(recorder.Body)
+	for scanner.Scan() {
+		var line map[string]json.RawMessage
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("line %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+
+	// The job, the audio, four progress events and the response
+	if len(lines) != 7 {
+		t.Fatalf("got %d lines, want 7", len(lines))
+	}
+	for i, key := range []string{"job", "audio", "progress", "progress", "progress", "progress", "success"} {
+		if _, ok := lines[i][key]; !ok {
+			t.Errorf("line %d has no %s: %v", i, key, lines[i])
+		}
+	}
+	if string(lines[6]["success"]) != "true" {
+		t.Errorf("final line = %v", lines[6])
+	}
+}
+
+func TestWebTranscribeRejectsBadRequests(t *testing.T) {
+	server, engine, _ := newFakeServer(t, &ProjectConfig{})
+	notAudio := t.TempDir() + "/notes.wav"
+	if err := os.WriteFile(notAudio, []byte("not audio"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	speech := writeSpeechWAV(t, 2, 0, 2)
+
+	tests := []struct {
+		path   string
+		fields map[string]string
+		want   string
+	}{
+		{notAudio, nil, "Invalid audio file"},
+		{speech, map[string]string{"language": "klingon"}, "unsupported language"},
+		{speech, map[string]string{"timestamps": "minute"}, "Invalid timestamps option"},
+		{speech, map[string]string{"postProcessing": "shout"}, "Invalid post-processing"},
+		{speech, map[string]string{"postProcessing": "glossary:file=/etc/passwd"}, "only accepted from the command line"},
+		{speech, map[string]string{"postProcessing": "Redact:wordsfile=/etc/passwd"}, "only accepted from the command line"},
+		{speech, map[string]string{"entropyThreshold": "0"}, "Invalid entropyThreshold: value cannot be 0"},
+		{speech, map[string]string{"logprobThreshold": "0.0"}, "Invalid logprobThreshold: value cannot be 0"},
+		{speech, map[string]string{"modelSize": "huge"}, "failed to load model"},
+	}
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		server.handleTranscribe(recorder, transcribeRequest(t, test.path, test.fields))
+		var response TranscriptionResponse
+		if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		if response.Success || !strings.Contains(response.Error, test.want) {
+			t.Errorf("fields %v: response = %+v, want an error containing %q", test.fields, response, test.want)
+		}
+	}
+	if len(engine.Calls) != 0 {
+		t.Errorf("engine called for bad requests: %v", engine.Calls)
+	}
+
+	recorder := httptest.NewRecorder()
+	server.handleTranscribe(recorder, httptest.NewRequest("GET", "/transcribe", io.NopCloser(strings.NewReader(""))))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET returned %d", recorder.Code)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -8,30 +9,119 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
+
+	"localtts/audio"
+	"localtts/proctree"
 )
 
 type WhisperTranscriber struct {
 	executablePath string
 	resourceManager *ResourceManager
+	// cache, when set, holds earlier results for the same audio, model
+	// and options
+	cache *TranscriptCache
 }
 
 type TranscriptionResult struct {
 	Text      string
 	Segments  []Segment
+	Language  string
+	// LanguageProbability is set when the language was auto-detected
+	LanguageProbability float64
+	Task      string
+	Model     ModelInfo
+	// Options are the normalized options the transcription ran with
+	Options   TranscribeOptions
+	// Audio describes the input file as probed before transcription
+	Audio     audio.Info
+	// VAD reports the speech regions that were transcribed when voice
+	// activity detection was enabled, nil otherwise
+	VAD       *VADReport
+	// Cached is set when the result came from the transcript cache
+	Cached    bool
+	// Processing lists every processor that ran after whisper, in the
+	// order they ran, including those that changed nothing
+	Processing []ProcessingStep
+	// Redactions lists the text the redact processor masked, with the
+	// original wording; it is only shared when a redaction map is asked for
+	Redactions []Redaction
 	Error     error
 }
 
+// ModelInfo describes the model that produced a transcription
+type ModelInfo struct {
+	Name         string
+	Path         string
+	Type         string
+	Multilingual bool
+	Vocab        int
+}
+
 type Segment struct {
-	Start float64
-	End   float64
-	Text  string
-	Words []Word
+	Start  float64
+	End    float64
+	Text   string
+	Words  []Word
+	Tokens []Token
+	// Speaker identifies who spoke, e.g. SPEAKER_1, when speakers were
+	// labeled; FormatOptions.SpeakerNames maps it to a name
+	Speaker string
+	// SpeakerTurn is set when tinydiarize predicted that the speaker
+	// changes after this segment
+	SpeakerTurn bool
+	// Channel is the audio channel the segment was heard on, counting
+	// from 1, when channels were transcribed separately; 0 otherwise
+	Channel int
+	// Paragraph numbers the paragraph the segment belongs to, counting
+	// from 1, once segments were re-segmented into sentences; 0 otherwise
+	Paragraph int
+	// Flagged gives the reason the segment is suspected of not having been
+	// spoken, e.g. a repetition loop, when it was kept but marked
+	Flagged string
 }
 
 type Word struct {
-	Start float64
-	End   float64
-	Text  string
+	Start       float64
+	End         float64
+	Text        string
+	Probability float64
+}
+
+// Token is a single decoder token with whisper's timing and confidence
+type Token struct {
+	ID          int
+	Start       float64
+	End         float64
+	Text        string
+	Probability float64
+}
+
+// Timestamp granularities supported by FormatResults
+const (
+	GranularityParagraph = "paragraph"
+	GranularitySentence  = "sentence"
+	GranularityWord      = "word"
+)
+
+// validGranularity reports whether FormatResults supports a granularity
+func validGranularity(granularity string) bool {
+	switch granularity {
+	case GranularityParagraph, GranularitySentence, GranularityWord:
+		return true
+	}
+	return false
+}
+
+// FormatOptions controls how FormatResults renders a transcription
+type FormatOptions struct {
+	Granularity string `json:"granularity"`
+	// SpeakerNames maps speaker IDs such as SPEAKER_1 to the names shown
+	SpeakerNames map[string]string `json:"speakerNames,omitempty"`
+	// RedactionMap is the file the redacted originals are written to, if any
+	RedactionMap string `json:"redactionMap,omitempty"`
+	// IncludeRedactions returns the redacted originals in a web response
+	IncludeRedactions bool `json:"includeRedactions,omitempty"`
 }
 
 func NewWhisperTranscriber(resourceManager *ResourceManager) *WhisperTranscriber {
@@ -55,75 +145,343 @@ func (wt *WhisperTranscriber) LoadModel(modelSize string) error {
 	return nil
 }
 
-func (wt *WhisperTranscriber) TranscribeFile(inputFile string, modelSize string) (*TranscriptionResult, error) {
-	// Check if file exists
-	if _, err := os.Stat(inputFile); os.IsNotExist(err) {
-		return nil, fmt.Errorf("audio file not found: %s", inputFile)
+func (wt *WhisperTranscriber) TranscribeFile(inputFile string, opts TranscribeOptions) (*TranscriptionResult, error) {
+	return wt.TranscribeContext(context.Background(), inputFile, opts)
+}
+
+// TranscribeContext decodes inputFile and runs whisper-cli on it. The decoded
+// audio and whisper's output are written to a private job directory that is
+// removed on every exit path. With opts.VAD only the detected speech is
+// transcribed and timestamps still refer to the original audio. Long
+// recordings are split into chunks transcribed in parallel, and with
+// opts.SplitChannels each channel is transcribed on its own; with
+// opts.CheckpointDir set, each chunk's result is saved there and reused by a
+// later call. Finished results are kept in the transcript cache and returned
+// without running whisper when the same file is transcribed again; the
+// processors in opts.PostProcessing run on the result either way. If ctx is
+// canceled or its deadline expires, the whole whisper process tree is killed
+// and an error matching ErrTranscriptionCanceled is returned.
+func (wt *WhisperTranscriber) TranscribeContext(ctx context.Context, inputFile string, opts TranscribeOptions) (*TranscriptionResult, error) {
+	if ctx.Err() != nil {
+		return nil, canceledError(ctx)
+	}
+	
+	opts, err := opts.Normalize()
+	if err != nil {
+		return nil, err
 	}
+	if opts.Diarize && opts.Speakers <= 2 {
+		opts.ModelSize = wt.diarizationModel(opts.ModelSize)
+	}
+	language := opts.Language
+	task := opts.Task
 	
-	// Prepare output file
-	outputDir := filepath.Dir(inputFile)
-	baseName := strings.TrimSuffix(filepath.Base(inputFile), filepath.Ext(inputFile))
-	outputFile := filepath.Join(outputDir, baseName+"_whisper_output")
+	prompt, err := buildPrompt(opts.Prompt, opts.Glossary)
+	if err != nil {
+		return nil, err
+	}
+	
+	// Reject missing, empty and corrupt files before doing any work
+	audioInfo, err := probeInput(inputFile, opts)
+	if err != nil {
+		return nil, err
+	}
 	
 	// Get model path from resource manager
-	modelPath := wt.resourceManager.GetModelPath(modelSize)
+	modelPath := wt.resourceManager.GetModelPath(opts.ModelSize)
+	
+	// The same audio, model and options always give the same transcript
+	var cacheKey string
+	if !opts.NoCache {
+		cacheKey = wt.cache.Key(inputFile, modelPath, opts)
+	}
+	if result, ok := wt.cache.Get(cacheKey); ok {
+		result.Options = opts
+		result.Audio = audioInfo
+		result.Model.Path = modelPath
+		result.Cached = true
+		if err := RunProcessors(result, opts.PostProcessing); err != nil {
+			return nil, err
+		}
+		if opts.Progress != nil {
+			opts.Progress(Progress{Percent: 100})
+		}
+		return result, nil
+	}
+	
+	// Each job writes into its own private directory so concurrent jobs never
+	// collide and nothing is written beside the input file
+	jobDir, err := wt.resourceManager.NewJobDir()
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(jobDir)
+	
+	run := whisperRun{
+		transcriber: wt,
+		modelPath:   modelPath,
+		prompt:      prompt,
+		opts:        opts,
+	}
+	var result *TranscriptionResult
+	if opts.SplitChannels {
+		result, err = run.transcribeChannels(ctx, inputFile, jobDir, audioInfo.Channels)
+	} else {
+		result, err = run.transcribeAudio(ctx, inputFile, jobDir, audio.AllChannels)
+	}
+	if err != nil {
+		return nil, err
+	}
+	
+	result.Model.Name = opts.ModelSize
+	result.Task = task
+	result.Options = opts
+	result.Audio = audioInfo
+	if opts.speakerTurns() {
+		labelSpeakerTurns(result.Segments)
+	} else if opts.Diarize {
+		// The audio decoded for whisper is reused rather than decoded again
+		decoded := decodedAudioPath(whisperInputPath(jobDir, audio.AllChannels), opts)
+		if err := labelSpeakerClusters(ctx, decoded, result.Segments, opts); err != nil {
+			if ctx.Err() != nil {
+				return nil, canceledError(ctx)
+			}
+			return nil, err
+		}
+	}
+	if result.Model.Path == "" {
+		result.Model.Path = modelPath
+	}
+	
+	// Record the requested language; otherwise the detected one is kept
+	if language != LanguageAuto {
+		result.Language = language
+		result.LanguageProbability = 0
+	}
+	
+	// A result that cannot be cached is still a good result. The cache
+	// keeps whisper's own output so the processors can be changed later.
+	wt.cache.Put(cacheKey, filepath.Base(inputFile), result)
+	if err := RunProcessors(result, opts.PostProcessing); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// probeInput returns opts.AudioInfo, or probes inputFile when the front-end
+// has not, so each job inspects its input once
+func probeInput(inputFile string, opts TranscribeOptions) (audio.Info, error) {
+	if opts.AudioInfo != nil {
+		return *opts.AudioInfo, nil
+	}
+	info, err := audio.Probe(inputFile)
+	if err != nil {
+		return info, fmt.Errorf("cannot read %s: %w", filepath.Base(inputFile), err)
+	}
+	return info, nil
+}
+
+// whisperInputPath is where the audio whisper reads for one channel, or
+// the mix of all channels for audio.AllChannels, is written in jobDir
+func whisperInputPath(jobDir string, channel int) string {
+	if channel == audio.AllChannels {
+		return filepath.Join(jobDir, "input.wav")
+	}
+	return filepath.Join(jobDir, fmt.Sprintf("input-channel-%d.wav", channel+1))
+}
+
+// transcribeAudio transcribes one channel of inputFile, or the mix of all
+// channels for audio.AllChannels, with timestamps on the original timeline
+func (run whisperRun) transcribeAudio(ctx context.Context, inputFile, jobDir string, channel int) (*TranscriptionResult, error) {
+	// Decode the input and hand whisper a clean 16 kHz mono WAV, holding
+	// only the speech when VAD is enabled. Unsupported files are rejected
+	// here with an error naming the codec.
+	whisperInput := whisperInputPath(jobDir, channel)
+	timeline, vadReport, err := prepareAudio(ctx, inputFile, whisperInput, channel, run.opts)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, canceledError(ctx)
+		}
+		return nil, fmt.Errorf("cannot read %s: %w", filepath.Base(inputFile), err)
+	}
+	
+	if vadReport != nil && len(vadReport.Regions) == 0 {
+		// Nothing to transcribe when VAD found no speech
+		return &TranscriptionResult{VAD: vadReport}, nil
+	}
+	
+	chunks, err := planChunks(whisperInput, run.opts)
+	if err != nil {
+		return nil, err
+	}
+	if run.checkpoint, err = openCheckpoint(run.opts.CheckpointDir, whisperInput, run.modelPath, run.opts, chunks); err != nil {
+		return nil, err
+	}
+	var result *TranscriptionResult
+	if len(chunks) > 1 {
+		result, err = run.transcribeChunks(ctx, whisperInput, jobDir, chunks)
+	} else {
+		result, err = run.transcribeWhole(ctx, whisperInput, jobDir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	
+	result.VAD = vadReport
+	if timeline != nil {
+		remapTimestamps(result.Segments, timeline)
+	}
+	return result, nil
+}
+
+// diarizationModel picks the tinydiarize variant of modelSize if one is
+// installed, e.g. small.en-tdrz for small.en. Otherwise modelSize is kept
+// and speakers are told apart by clustering voices.
+func (wt *WhisperTranscriber) diarizationModel(modelSize string) string {
+	variant := modelSize + tinydiarizeSuffix
+	if isDiarizationModel(modelSize) {
+		return modelSize
+	}
+	if _, err := os.Stat(wt.resourceManager.GetModelPath(variant)); err == nil {
+		return variant
+	}
+	return modelSize
+}
+
+// whisperRun holds what every whisper-cli invocation of one job shares
+type whisperRun struct {
+	transcriber *WhisperTranscriber
+	modelPath   string
+	prompt      string
+	opts        TranscribeOptions
+	checkpoint  *checkpoint
+}
+
+// transcribeWhole transcribes input in a single pass, or returns the result
+// checkpointed by an earlier attempt
+func (run whisperRun) transcribeWhole(ctx context.Context, input, jobDir string) (*TranscriptionResult, error) {
+	if result, ok := run.checkpoint.load("whole"); ok {
+		return result, nil
+	}
+
+	result, err := run.transcribe(ctx, input, filepath.Join(jobDir, "whisper_output"), run.opts.Progress)
+	if err != nil {
+		return nil, err
+	}
+	if err := run.checkpoint.save("whole", result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// transcribe runs whisper-cli on a 16 kHz mono WAV file. Its output files
+// are written next to outputFile, and progress lines go to onProgress. The
+// detected language is recorded when the language is "auto".
+func (run whisperRun) transcribe(ctx context.Context, input, outputFile string, onProgress ProgressFunc) (*TranscriptionResult, error) {
+	opts := run.opts
 	
 	// Build whisper command
 	var args []string
-	args = append(args, "-m", modelPath)
-	args = append(args, "-f", inputFile)
+	args = append(args, "-m", run.modelPath)
+	args = append(args, "-f", input)
 	args = append(args, "-of", outputFile)
+	args = append(args, "-l", opts.Language)
+	if opts.Task == TaskTranslate {
+		args = append(args, "-tr") // Translate into English
+	}
+	if opts.speakerTurns() {
+		args = append(args, "-tdrz") // Predict speaker turns with tinydiarize
+	}
+	if run.prompt != "" {
+		args = append(args, "--prompt", run.prompt)
+	}
+	args = append(args, opts.decodingArgs()...)
 	args = append(args, "-osrt")  // Always use SRT format for sentence-level timestamps
+	args = append(args, "-ojf")   // Full JSON with per-token timings for word-level timestamps
 	args = append(args, "-np")    // No print special tokens
+	if onProgress != nil {
+		args = append(args, "-pp") // Print progress to stderr
+	}
 	
-	// Execute whisper
-	cmd := exec.Command(wt.executablePath, args...)
-	output, err := cmd.CombinedOutput()
+	// Execute whisper in its own process group so cancellation kills the whole tree
+	cmd := exec.CommandContext(ctx, run.transcriber.executablePath, args...)
+	proctree.Prepare(cmd)
+	cmd.Cancel = func() error {
+		return proctree.Kill(cmd)
+	}
+	cmd.WaitDelay = 5 * time.Second
+	
+	// Stream stdout and stderr through one writer so progress lines are
+	// reported as soon as whisper prints them
+	output := newProgressWriter(onProgress)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return nil, canceledError(ctx)
+	}
 	if err != nil {
-		outputStr := string(output)
-		if strings.Contains(outputStr, "failed to read audio") {
-			return nil, fmt.Errorf("invalid audio file: %s\nWhisper supports: WAV, MP3, FLAC, MP4, M4A, OGG\nError: %v", inputFile, err)
-		}
-		return nil, fmt.Errorf("whisper execution failed: %v\nOutput: %s", err, outputStr)
+		return nil, fmt.Errorf("whisper execution failed: %v\nOutput: %s", err, output.String())
 	}
 	
-	// Read the generated transcription file (always SRT format)
-	transcriptionFile := outputFile + ".srt"
-	content, readErr := os.ReadFile(transcriptionFile)
-	if readErr != nil {
-		// Fallback to other possible files
-		possibleFiles := []string{
-			outputFile + ".srt",
-			outputFile + ".txt",
-			filepath.Join(outputDir, baseName + ".srt"),
-		}
-		
-		for _, possibleFile := range possibleFiles {
-			if _, statErr := os.Stat(possibleFile); statErr == nil {
-				content, readErr = os.ReadFile(possibleFile)
-				transcriptionFile = possibleFile
-				break
-			}
+	output.finish()
+	
+	// Prefer whisper's full JSON output and fall back to the SRT file
+	result, err := run.transcriber.readResult(outputFile)
+	if err != nil {
+		return nil, fmt.Errorf("%v\nWhisper output: %s", err, output.String())
+	}
+	
+	if detected, probability, ok := parseDetectedLanguage(output.String()); ok && opts.Language == LanguageAuto {
+		result.Language = detected
+		result.LanguageProbability = probability
+	}
+	
+	return result, nil
+}
+
+// readResult loads the transcription written by whisper. The full JSON
+// output carries token timings, probabilities, language and model details;
+// the SRT file only has segment timings and is used when JSON is missing.
+func (wt *WhisperTranscriber) readResult(outputFile string) (*TranscriptionResult, error) {
+	jsonOutput, jsonErr := readWhisperJSON(outputFile + ".json")
+	if jsonErr == nil {
+		return jsonOutput.toResult(), nil
+	}
+	
+	// Read the generated SRT transcription file. Only files inside the
+	// job directory are considered, never files beside the input.
+	var content []byte
+	readErr := jsonErr
+	for _, possibleFile := range []string{outputFile + ".srt", outputFile + ".txt"} {
+		if content, readErr = os.ReadFile(possibleFile); readErr == nil {
+			break
 		}
 	}
 	
 	if readErr != nil {
-		return nil, fmt.Errorf("whisper did not create expected output file.\nWhisper output: %s", string(output))
+		return nil, fmt.Errorf("whisper did not create expected output file (JSON: %v)", jsonErr)
 	}
 	
-	// Clean up temporary files
-	os.Remove(transcriptionFile)
-	
 	// Parse SRT format for timestamps
 	segments := wt.parseSRTFormat(string(content))
 	
 	return &TranscriptionResult{
-		Text:     string(content),
+		Text:     segmentsText(segments),
 		Segments: segments,
 	}, nil
 }
 
+// segmentsText joins segment texts into a single plain-text transcript
+func segmentsText(segments []Segment) string {
+	var texts []string
+	for _, segment := range segments {
+		texts = append(texts, segment.Text)
+	}
+	return strings.Join(texts, " ")
+}
+
 // parseSRTFormat parses Whisper's SRT subtitle format
 func (wt *WhisperTranscriber) parseSRTFormat(content string) []Segment {
 	var segments []Segment
@@ -158,11 +516,12 @@ func (wt *WhisperTranscriber) parseSRTFormat(content string) []Segment {
 				}
 				
 				if len(textLines) > 0 {
-					text := strings.Join(textLines, " ")
+					text, turn := stripSpeakerTurn(strings.Join(textLines, " "))
 					segment := Segment{
-						Start: startTime,
-						End:   endTime,
-						Text:  text,
+						Start:       startTime,
+						End:         endTime,
+						Text:        text,
+						SpeakerTurn: turn,
 					}
 					segments = append(segments, segment)
 				}
@@ -191,19 +550,86 @@ func (wt *WhisperTranscriber) parseSRTTimestamp(timestamp string) float64 {
 	return float64(hours*3600 + minutes*60) + seconds
 }
 
-func (wt *WhisperTranscriber) FormatResults(result *TranscriptionResult) string {
+// FormatResults renders a transcription result as timestamped text, one
+// block per paragraph, sentence or word. Sentences are found from word
+// timings and punctuation unless the result was already re-segmented or a
+// maximum segment length was requested. Word granularity falls back to
+// sentences when no word timings exist.
+func FormatResults(result *TranscriptionResult, opts FormatOptions) string {
 	var output strings.Builder
 	
-	// Sentence-level output using whisper's native segment timestamps
-	for _, segment := range result.Segments {
+	if opts.Granularity == GranularityWord && hasWordTimestamps(result) {
+		// Word-level output, one word per line under a heading for each
+		// change of speaker
+		speaker := ""
+		for _, segment := range result.Segments {
+			if segment.Speaker != "" && segment.Speaker != speaker {
+				if speaker != "" {
+					output.WriteString("\n")
+				}
+				speaker = segment.Speaker
+				output.WriteString(speakerLabel(speaker, opts.SpeakerNames) + ":\n")
+			}
+			for _, word := range segment.Words {
+				output.WriteString(fmt.Sprintf("[%s] %s\n", formatTimestampMillis(word.Start), word.Text))
+			}
+		}
+		return output.String()
+	}
+	
+	segments := sentenceSegments(result)
+	if opts.Granularity == GranularityParagraph {
+		segments = paragraphSegments(result)
+	}
+	for _, segment := range segments {
 		startTime := formatTimestamp(segment.Start)
 		endTime := formatTimestamp(segment.End)
-		output.WriteString(fmt.Sprintf("[%s - %s] %s\n\n", startTime, endTime, segment.Text))
+		text := displayText(segment)
+		if segment.Speaker != "" {
+			text = speakerLabel(segment.Speaker, opts.SpeakerNames) + ": " + text
+		}
+		output.WriteString(fmt.Sprintf("[%s - %s] %s\n\n", startTime, endTime, text))
 	}
 	
 	return output.String()
 }
 
+// flaggedMarker precedes the text of flagged segments in formatted output
+const flaggedMarker = "(?)"
+
+// displayText returns a segment's text as it is formatted, marked when the
+// segment was flagged
+func displayText(segment Segment) string {
+	if segment.Flagged != "" {
+		return flaggedMarker + " " + segment.Text
+	}
+	return segment.Text
+}
+
+// hasWordTimestamps reports whether any segment carries word timings
+func hasWordTimestamps(result *TranscriptionResult) bool {
+	for _, segment := range result.Segments {
+		if len(segment.Words) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Capabilities reports the features supported by the whisper-cli backend
+func (wt *WhisperTranscriber) Capabilities() EngineCapabilities {
+	models, _ := wt.resourceManager.ListAvailableModels()
+	return EngineCapabilities{
+		Name:              EngineWhisperCLI,
+		Models:            models,
+		WordTimestamps:    true,
+		Progress:          true,
+		LanguageDetection: true,
+		Translation:       true,
+		Diarization:       true,
+	}
+}
+
 func (wt *WhisperTranscriber) Close() {
 	// Nothing to close for executable-based approach
 }
@@ -215,6 +641,16 @@ func formatTimestamp(seconds float64) string {
 	return fmt.Sprintf("%02d:%02d:%02d", hours, minutes, secs)
 }
 
+// formatTimestampMillis formats seconds as HH:MM:SS.mmm
+func formatTimestampMillis(seconds float64) string {
+	totalMillis := int64(seconds*1000 + 0.5)
+	hours := totalMillis / 3600000
+	minutes := (totalMillis % 3600000) / 60000
+	secs := (totalMillis % 60000) / 1000
+	millis := totalMillis % 1000
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", hours, minutes, secs, millis)
+}
+
 // parseWhisperTimestamps parses timestamp format from whisper output
 func parseWhisperTimestamps(line string) (float64, float64, string) {
 	// Whisper typically outputs: [00:00:00.000 --> 00:00:03.000]  Text here
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// whisperJSONOutput mirrors the file written by whisper-cli with -ojf
+type whisperJSONOutput struct {
+	SystemInfo    string               `json:"systeminfo"`
+	Model         whisperJSONModel     `json:"model"`
+	Params        whisperJSONParams    `json:"params"`
+	Result        whisperJSONResult    `json:"result"`
+	Transcription []whisperJSONSegment `json:"transcription"`
+}
+
+type whisperJSONModel struct {
+	Type         string `json:"type"`
+	Multilingual bool   `json:"multilingual"`
+	Vocab        int    `json:"vocab"`
+	Mels         int    `json:"mels"`
+	FType        int    `json:"ftype"`
+}
+
+type whisperJSONParams struct {
+	Model     string `json:"model"`
+	Language  string `json:"language"`
+	Translate bool   `json:"translate"`
+}
+
+type whisperJSONResult struct {
+	Language string `json:"language"`
+}
+
+type whisperJSONSegment struct {
+	Offsets whisperJSONOffsets `json:"offsets"`
+	Text    jsonBytes          `json:"text"`
+	Tokens  []whisperJSONToken `json:"tokens"`
+	// SpeakerTurnNext is written with -tdrz when the speaker changes
+	// after this segment
+	SpeakerTurnNext bool `json:"speaker_turn_next"`
+}
+
+type whisperJSONToken struct {
+	Text        jsonBytes          `json:"text"`
+	Offsets     whisperJSONOffsets `json:"offsets"`
+	ID          int                `json:"id"`
+	Probability float64            `json:"p"`
+}
+
+// whisperJSONOffsets holds start and end times in milliseconds
+type whisperJSONOffsets struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+}
+
+// jsonBytes is a JSON string decoded to its raw bytes. whisper-cli writes
+// token text byte for byte, so a character split across tokens is not valid
+// UTF-8 in either token, and decoding each as a string would turn both
+// halves into U+FFFD.
+type jsonBytes []byte
+
+func (b *jsonBytes) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	if len(data) < 2 || data[0] != '"' || data[len(data)-1] != '"' {
+		return fmt.Errorf("expected a string, got %s", data)
+	}
+	data = data[1 : len(data)-1]
+	decoded := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		if data[i] != '\\' {
+			decoded = append(decoded, data[i])
+			continue
+		}
+		if i++; i == len(data) {
+			return fmt.Errorf("unterminated escape in string")
+		}
+		switch data[i] {
+		case '"', '\\', '/':
+			decoded = append(decoded, data[i])
+		case 'b':
+			decoded = append(decoded, '\b')
+		case 'f':
+			decoded = append(decoded, '\f')
+		case 'n':
+			decoded = append(decoded, '\n')
+		case 'r':
+			decoded = append(decoded, '\r')
+		case 't':
+			decoded = append(decoded, '\t')
+		case 'u':
+			r, n, err := unescapeUnicode(data[i+1:])
+			if err != nil {
+				return err
+			}
+			decoded = utf8.AppendRune(decoded, r)
+			i += n
+		default:
+			return fmt.Errorf("invalid escape \\%c in string", data[i])
+		}
+	}
+	*b = decoded
+	return nil
+}
+
+// unescapeUnicode decodes the hex digits of a \u escape, and the low half
+// of a surrogate pair that follows it, returning the bytes consumed
+func unescapeUnicode(data []byte) (rune, int, error) {
+	hex := func(data []byte) (rune, bool) {
+		if len(data) < 4 {
+			return 0, false
+		}
+		value, err := strconv.ParseUint(string(data[:4]), 16, 16)
+		return rune(value), err == nil
+	}
+	r, ok := hex(data)
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid \\u escape in string")
+	}
+	if utf16.IsSurrogate(r) && len(data) >= 10 && data[4] == '\\' && data[5] == 'u' {
+		if low, ok := hex(data[6:]); ok {
+			if pair := utf16.DecodeRune(r, low); pair != utf8.RuneError {
+				return pair, 10, nil
+			}
+		}
+	}
+	return r, 4, nil
+}
+
+// validText converts decoded bytes to a string, replacing bytes that are
+// not valid UTF-8
+func validText(b []byte) string {
+	return strings.ToValidUTF8(string(b), "\uFFFD")
+}
+
+// endsMidRune reports whether text ends with the first bytes of a
+// multibyte character whose remaining bytes are missing
+func endsMidRune(text string) bool {
+	for i := len(text) - 1; i >= 0 && i >= len(text)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(text[i]) {
+			return text[i] >= utf8.RuneSelf && !utf8.FullRuneInString(text[i:])
+		}
+	}
+	return false
+}
+
+// readWhisperJSON decodes a full JSON file produced by whisper-cli
+func readWhisperJSON(path string) (*whisperJSONOutput, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var output whisperJSONOutput
+	if err := json.Unmarshal(content, &output); err != nil {
+		return nil, fmt.Errorf("failed to parse whisper JSON output: %v", err)
+	}
+	return &output, nil
+}
+
+// isSpecialToken reports whether a token is a control token such as
+// [_BEG_], [_TT_150] or <|endoftext|> rather than spoken text
+func isSpecialToken(text string) bool {
+	return strings.HasPrefix(text, "[_") || strings.HasPrefix(text, "<|")
+}
+
+// tokens converts the segment's spoken tokens, dropping control tokens.
+// Tokens holding parts of one character are joined before their text is
+// decoded, keeping the first ID and the lowest probability.
+func (s whisperJSONSegment) tokens() []Token {
+	var tokens []Token
+	split := false
+	for _, token := range s.Tokens {
+		text := string(token.Text)
+		if isSpecialToken(text) || text == "" {
+			continue
+		}
+		if split {
+			last := &tokens[len(tokens)-1]
+			last.Text += text
+			last.End = millisToSeconds(token.Offsets.To)
+			last.Probability = min(last.Probability, token.Probability)
+		} else {
+			tokens = append(tokens, Token{
+				ID:          token.ID,
+				Start:       millisToSeconds(token.Offsets.From),
+				End:         millisToSeconds(token.Offsets.To),
+				Text:        text,
+				Probability: token.Probability,
+			})
+		}
+		split = endsMidRune(tokens[len(tokens)-1].Text)
+	}
+	for i := range tokens {
+		tokens[i].Text = validText([]byte(tokens[i].Text))
+	}
+	return tokens
+}
+
+// words groups the segment's sub-word tokens into words. A token starting
+// with a space begins a new word; the word's probability is the mean of
+// its tokens.
+func (s whisperJSONSegment) words() []Word {
+	var words []Word
+	var probSum float64
+	var tokenCount int
+
+	flush := func() {
+		if tokenCount == 0 {
+			return
+		}
+		last := &words[len(words)-1]
+		last.Text = strings.TrimSpace(last.Text)
+		last.Probability = probSum / float64(tokenCount)
+		probSum, tokenCount = 0, 0
+	}
+
+	for _, token := range s.tokens() {
+		if len(words) == 0 || strings.HasPrefix(token.Text, " ") {
+			flush()
+			words = append(words, Word{Start: token.Start})
+		}
+
+		current := &words[len(words)-1]
+		current.Text += token.Text
+		current.End = token.End
+		probSum += token.Probability
+		tokenCount++
+	}
+	flush()
+
+	// Drop words that were only whitespace
+	filtered := words[:0]
+	for _, word := range words {
+		if word.Text != "" {
+			filtered = append(filtered, word)
+		}
+	}
+	return filtered
+}
+
+// toResult converts whisper's JSON output into a TranscriptionResult
+func (o *whisperJSONOutput) toResult() *TranscriptionResult {
+	var segments []Segment
+	for _, jsonSegment := range o.Transcription {
+		text, turn := stripSpeakerTurn(validText(jsonSegment.Text))
+		text = strings.TrimSpace(text)
+		if text == "" {
+			// Keep a turn predicted after an empty segment
+			if turn || jsonSegment.SpeakerTurnNext {
+				if n := len(segments); n > 0 {
+					segments[n-1].SpeakerTurn = true
+				}
+			}
+			continue
+		}
+		segments = append(segments, Segment{
+			Start:       millisToSeconds(jsonSegment.Offsets.From),
+			End:         millisToSeconds(jsonSegment.Offsets.To),
+			Text:        text,
+			Words:       jsonSegment.words(),
+			Tokens:      jsonSegment.tokens(),
+			SpeakerTurn: turn || jsonSegment.SpeakerTurnNext,
+		})
+	}
+
+	return &TranscriptionResult{
+		Text:     segmentsText(segments),
+		Segments: segments,
+		Language: o.Result.Language,
+		Model: ModelInfo{
+			Path:         o.Params.Model,
+			Type:         o.Model.Type,
+			Multilingual: o.Model.Multilingual,
+			Vocab:        o.Model.Vocab,
+		},
+	}
+}
+
+func millisToSeconds(ms int64) float64 {
+	return float64(ms) / 1000.0
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// jsonToken is a token of whisper's full JSON output; text may hold part
+// of a character, as whisper writes it byte for byte
+func jsonToken(text string, from, to int64, p float64) string {
+	return fmt.Sprintf(`{"text": "%s", "offsets": {"from": %d, "to": %d}, "id": 1, "p": %g}`, text, from, to, p)
+}
+
+// parseWhisperJSON decodes a full JSON document written as whisper-cli would
+func parseWhisperJSON(t *testing.T, document string) *whisperJSONOutput {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "output.json")
+	if err := os.WriteFile(path, []byte(document), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output, err := readWhisperJSON(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return output
+}
+
+func TestWhisperJSONWords(t *testing.T) {
+	output := parseWhisperJSON(t, `{"transcription": [{
+		"offsets": {"from": 0, "to": 2000},
+		"text": " Hello wonderful world.",
+		"tokens": [`+
+		jsonToken("[_BEG_]", 0, 0, 1)+`, `+
+		jsonToken(" Hello", 0, 400, 0.9)+`, `+
+		jsonToken(" wonder", 400, 800, 0.8)+`, `+
+		jsonToken("ful", 800, 1000, 0.6)+`, `+
+		jsonToken(" world", 1000, 1600, 0.7)+`, `+
+		jsonToken(".", 1600, 2000, 0.5)+`, `+
+		jsonToken("[_TT_100]", 2000, 2000, 1)+`]}]}`)
+
+	words := output.Transcription[0].words()
+	want := []Word{
+		{Start: 0, End: 0.4, Text: "Hello", Probability: 0.9},
+		{Start: 0.4, End: 1, Text: "wonderful", Probability: 0.7},
+		{Start: 1, End: 2, Text: "world.", Probability: 0.6},
+	}
+	if len(words) != len(want) {
+		t.Fatalf("words = %+v, want %+v", words, want)
+	}
+	for i := range want {
+		got := words[i]
+		if got.Text != want[i].Text || got.Start != want[i].Start || got.End != want[i].End || math.Abs(got.Probability-want[i].Probability) > 1e-9 {
+			t.Errorf("word %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+	if tokens := output.Transcription[0].tokens(); len(tokens) != 5 {
+		t.Errorf("tokens = %+v, want the control tokens dropped", tokens)
+	}
+}
+
+// A character whisper splits across tokens is decoded whole
+func TestWhisperJSONSplitCharacters(t *testing.T) {
+	// "café" with é split in two, and "東京" with 京 split in three
+	output := parseWhisperJSON(t, "{\"transcription\": [{\"offsets\": {\"from\": 0, \"to\": 2000}, \"text\": \" café 東京\", \"tokens\": ["+
+		jsonToken(" caf", 0, 400, 0.9)+", "+
+		jsonToken("\xc3", 400, 500, 0.6)+", "+
+		jsonToken("\xa9", 500, 600, 0.8)+", "+
+		jsonToken(" 東", 600, 1000, 0.9)+", "+
+		jsonToken("\xe4", 1000, 1200, 0.7)+", "+
+		jsonToken("\xba", 1200, 1400, 0.7)+", "+
+		jsonToken("\xac", 1400, 2000, 0.7)+"]}]}")
+
+	segment := output.Transcription[0]
+	tokens := segment.tokens()
+	if len(tokens) != 4 || tokens[1].Text != "é" || tokens[3].Text != "京" {
+		t.Fatalf("tokens = %+v, want split characters joined", tokens)
+	}
+	if tokens[1].Start != 0.4 || tokens[1].End != 0.6 || tokens[1].Probability != 0.6 {
+		t.Errorf("joined token = %+v", tokens[1])
+	}
+	words := segment.words()
+	if len(words) != 2 || words[0].Text != "café" || words[1].Text != "東京" || words[1].End != 2 {
+		t.Errorf("words = %+v", words)
+	}
+
+	result := output.toResult()
+	if result.Text != "café 東京" {
+		t.Errorf("text = %q", result.Text)
+	}
+}
+
+func TestJSONBytes(t *testing.T) {
+	tests := []struct {
+		json string
+		want string
+	}{
+		{`"plain"`, "plain"},
+		{`"quote \" slash \/ backslash \\ tab \t"`, "quote \" slash / backslash \\ tab \t"},
+		{`"é 😀"`, "é \U0001F600"},
+		{"\"\xe4\xba\"", "\xe4\xba"},
+	}
+	for _, test := range tests {
+		var b jsonBytes
+		if err := json.Unmarshal([]byte(test.json), &b); err != nil || string(b) != test.want {
+			t.Errorf("decoding %s = %q, %v, want %q", test.json, b, err, test.want)
+		}
+	}
+	var b jsonBytes
+	if err := json.Unmarshal([]byte(`"\x"`), &b); err == nil {
+		t.Error("invalid escape accepted")
+	}
+}
+
+func TestWhisperJSONToResult(t *testing.T) {
+	output := parseWhisperJSON(t, `{
+		"model": {"type": "base", "multilingual": true, "vocab": 51865},
+		"params": {"model": "/models/ggml-base.bin", "language": "auto"},
+		"result": {"language": "de"},
+		"transcription": [
+			{"offsets": {"from": 0, "to": 1500}, "text": " Guten Tag.", "tokens": []},
+			{"offsets": {"from": 1500, "to": 1600}, "text": " ", "speaker_turn_next": true, "tokens": []},
+			{"offsets": {"from": 1600, "to": 3000}, "text": " Hallo.", "tokens": []}
+		]}`)
+
+	result := output.toResult()
+	if result.Language != "de" || result.Model.Type != "base" || !result.Model.Multilingual || result.Model.Path != "/models/ggml-base.bin" {
+		t.Errorf("result = %+v", result)
+	}
+	if len(result.Segments) != 2 || result.Text != "Guten Tag. Hallo." {
+		t.Fatalf("segments = %+v", result.Segments)
+	}
+	// The turn predicted after the empty segment is kept on the one before
+	if !result.Segments[0].SpeakerTurn || result.Segments[1].SpeakerTurn {
+		t.Errorf("speaker turns = %v, %v", result.Segments[0].SpeakerTurn, result.Segments[1].SpeakerTurn)
+	}
+	if result.Segments[1].Start != 1.6 || result.Segments[1].End != 3 {
+		t.Errorf("segment = %+v", result.Segments[1])
+	}
+}
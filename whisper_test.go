@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newStubTranscriber returns a transcriber whose whisper-cli is a shell
+// script running body, with $of set to the -of argument and $dir to a
+// directory the test can inspect
+func newStubTranscriber(t *testing.T, body string) (*WhisperTranscriber, string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the stub whisper-cli is a shell script")
+	}
+	dir := t.TempDir()
+	rm := &ResourceManager{
+		tempDir:     dir,
+		whisperPath: filepath.Join(dir, "whisper"),
+		modelsDir:   filepath.Join(dir, "models"),
+		jobsDir:     filepath.Join(dir, "jobs"),
+	}
+	for _, sub := range []string{rm.whisperPath, rm.modelsDir, rm.jobsDir} {
+		if err := os.MkdirAll(sub, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(rm.GetModelPath("base"), []byte("model"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	script := "#!/bin/sh\ndir=" + strconv.Quote(dir) + "\nof=\"\"\n" +
+		"while [ $# -gt 0 ]; do\n\tif [ \"$1\" = -of ]; then of=\"$2\"; fi\n\tshift\ndone\n" + body
+	if err := os.WriteFile(rm.GetWhisperExecutable(), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return NewWhisperTranscriber(rm), dir
+}
+
+// processAlive reports whether pid is running and not a zombie waiting to
+// be reaped
+func processAlive(pid int) bool {
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return false
+	}
+	// The state follows the command name in parentheses
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
+
+// A deadline stops whisper and every process it started, and removes what
+// it wrote
+func TestTranscribeContextDeadlineKillsProcessTree(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("process states are read from /proc")
+	}
+	wt, dir := newStubTranscriber(t, `echo partial > "$of.srt"
+sleep 60 &
+echo $! > "$dir/child.pid"
+wait
+`)
+	input := writeSpeechWAV(t, 2, 0, 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	result, err := wt.TranscribeContext(ctx, input, TranscribeOptions{})
+	if !errors.Is(err, ErrTranscriptionCanceled) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("TranscribeContext = %v, %v, want a canceled error for the deadline", result, err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("returned after %s", elapsed)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "child.pid"))
+	if err != nil {
+		t.Fatalf("stub did not start its child: %v", err)
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	for deadline := time.Now().Add(2 * time.Second); processAlive(pid) && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if processAlive(pid) {
+		t.Errorf("whisper's child process %d is still running", pid)
+	}
+
+	if entries, _ := os.ReadDir(filepath.Join(dir, "jobs")); len(entries) != 0 {
+		t.Errorf("job directory left behind: %v", entries)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(filepath.Dir(input), "*.srt")); len(matches) != 0 {
+		t.Errorf("output written beside the input: %v", matches)
+	}
+}
+
+func TestTranscribeContextAlreadyCanceled(t *testing.T) {
+	wt, dir := newStubTranscriber(t, `touch "$dir/ran"`)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := wt.TranscribeContext(ctx, writeSpeechWAV(t, 2, 0, 2), TranscribeOptions{})
+	if !errors.Is(err, ErrTranscriptionCanceled) || !errors.Is(err, context.Canceled) {
+		t.Errorf("TranscribeContext = %v, want a canceled error", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ran")); err == nil {
+		t.Error("whisper ran for a canceled context")
+	}
+}
+
+// writeOutputs writes whisper output files named output.<ext> and returns
+// the output path without extension
+func writeOutputs(t *testing.T, files map[string]string) string {
+	t.Helper()
+	base := filepath.Join(t.TempDir(), "output")
+	for ext, content := range files {
+		if err := os.WriteFile(base+"."+ext, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return base
+}
+
+const testSRT = `1
+00:00:00,000 --> 00:00:01,500
+ Good morning. [SPEAKER_TURN]
+
+2
+00:00:01,500 --> 00:01:02,250
+ Morning,
+ everyone.
+`
+
+// Without usable JSON the result is read from the SRT file
+func TestReadResultFallsBackToSRT(t *testing.T) {
+	wt := &WhisperTranscriber{}
+	tests := []struct {
+		name  string
+		files map[string]string
+	}{
+		{"SRT only", map[string]string{"srt": testSRT}},
+		{"corrupt JSON", map[string]string{"json": `{"transcription": [`, "srt": testSRT}},
+		{"text file", map[string]string{"txt": testSRT}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := wt.readResult(writeOutputs(t, test.files))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Text != "Good morning. Morning, everyone." || len(result.Segments) != 2 {
+				t.Fatalf("result = %+v", result)
+			}
+			first, second := result.Segments[0], result.Segments[1]
+			if first.Start != 0 || first.End != 1.5 || first.Text != "Good morning." || !first.SpeakerTurn {
+				t.Errorf("first segment = %+v", first)
+			}
+			if second.Start != 1.5 || second.End != 62.25 || second.SpeakerTurn || second.Words != nil {
+				t.Errorf("second segment = %+v", second)
+			}
+		})
+	}
+}
+
+func TestReadResultPrefersJSON(t *testing.T) {
+	wt := &WhisperTranscriber{}
+	result, err := wt.readResult(writeOutputs(t, map[string]string{
+		"json": `{"result": {"language": "en"}, "transcription": [{"offsets": {"from": 0, "to": 1000}, "text": " From JSON.", "tokens": []}]}`,
+		"srt":  testSRT,
+	}))
+	if err != nil || result.Text != "From JSON." || result.Language != "en" {
+		t.Errorf("readResult = %+v, %v", result, err)
+	}
+
+	if _, err := wt.readResult(writeOutputs(t, nil)); err == nil || !strings.Contains(err.Error(), "did not create expected output") {
+		t.Errorf("readResult with no output = %v", err)
+	}
+}
+
+func TestParseSRTTimestamp(t *testing.T) {
+	wt := &WhisperTranscriber{}
+	tests := map[string]float64{
+		"00:00:01,000": 1,
+		"00:01:02,250": 62.25,
+		"01:00:00.500": 3600.5,
+		"12,000":       0,
+	}
+	for timestamp, want := range tests {
+		if got := wt.parseSRTTimestamp(timestamp); got != want {
+			t.Errorf("parseSRTTimestamp(%q) = %v, want %v", timestamp, got, want)
+		}
+	}
+}
+
+// jobDirStub records the job directory whisper runs in and what it holds,
+// then waits until two jobs run at once before writing its output. With
+// $dir/fail present it fails instead.
+const jobDirStub = `job=$(dirname "$of")
+name=$(basename "$job")
+ls "$job" > "$dir/$name.files"
+if [ -e "$dir/fail" ]; then exit 1; fi
+touch "$dir/$name.started"
+i=0
+while [ $(ls "$dir"/*.started | wc -l) -lt 2 ] && [ $i -lt 100 ]; do sleep 0.05; i=$((i+1)); done
+printf '1\n00:00:00,000 --> 00:00:01,000\n Hello.\n' > "$of.srt"
+`
+
+// Every job runs in a directory of its own, which is removed however the
+// job ends
+func TestTranscribeJobDirectories(t *testing.T) {
+	wt, dir := newStubTranscriber(t, jobDirStub)
+	input := writeSpeechWAV(t, 2, 0, 2)
+	jobsDir := filepath.Join(dir, "jobs")
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := wt.TranscribeContext(context.Background(), input, TranscribeOptions{})
+			errs <- err
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	listings, _ := filepath.Glob(filepath.Join(dir, "*.files"))
+	started, _ := filepath.Glob(filepath.Join(dir, "*.started"))
+	if len(listings) != 2 || len(started) != 2 {
+		t.Fatalf("jobs ran in %v, want two directories used at once", listings)
+	}
+	for _, listing := range listings {
+		if !strings.HasPrefix(filepath.Base(listing), "job-") {
+			t.Errorf("whisper ran in %s, not a job directory", listing)
+		}
+		// Each job only sees its own input
+		if files, _ := os.ReadFile(listing); strings.TrimSpace(string(files)) != "input.wav" {
+			t.Errorf("%s held %q", filepath.Base(listing), files)
+		}
+	}
+	if entries, _ := os.ReadDir(jobsDir); len(entries) != 0 {
+		t.Errorf("job directories left after success: %v", entries)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "fail"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wt.TranscribeContext(context.Background(), input, TranscribeOptions{}); err == nil {
+		t.Fatal("failing whisper gave a result")
+	}
+	if listings, _ := filepath.Glob(filepath.Join(dir, "*.files")); len(listings) != 3 {
+		t.Errorf("failed job listings = %v", listings)
+	}
+	if entries, _ := os.ReadDir(jobsDir); len(entries) != 0 {
+		t.Errorf("job directory left after failure: %v", entries)
+	}
+
+	// A lone job waits for a second one until its deadline cancels it
+	os.Remove(filepath.Join(dir, "fail"))
+	for _, file := range started {
+		os.Remove(file)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if _, err := wt.TranscribeContext(ctx, input, TranscribeOptions{}); !errors.Is(err, ErrTranscriptionCanceled) {
+		t.Fatalf("TranscribeContext = %v, want a canceled error", err)
+	}
+	if listings, _ := filepath.Glob(filepath.Join(dir, "*.files")); len(listings) != 4 {
+		t.Errorf("canceled job listings = %v", listings)
+	}
+	if entries, _ := os.ReadDir(jobsDir); len(entries) != 0 {
+		t.Errorf("job directory left after cancellation: %v", entries)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(filepath.Dir(input), "*")); len(matches) != 1 {
+		t.Errorf("files written beside the input: %v", matches)
+	}
+}